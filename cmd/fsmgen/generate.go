@@ -0,0 +1,497 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	gofsm "github.com/xgfone/go-fsm"
+)
+
+// Config is the configuration to generate the code.
+type Config struct {
+	Source  string // The name of the definition file.
+	Package string // The package name of the generated code.
+	Type    string // The type name of the state machine.
+	Prefix  string // The prefix of the state and event constants.
+}
+
+// reservedMethods is the methods of the generated machine type.
+var reservedMethods = []string{"FSM", "Current"}
+
+type generator struct {
+	Config
+	def gofsm.Definition
+	buf bytes.Buffer
+
+	states  []gofsm.State
+	events  []gofsm.Event
+	names   map[string]string // The Go identifiers of the names.
+	actions []string
+	guards  []string
+	hooks   []string
+}
+
+// Generate generates the Go code of the type-safe state machine
+// from the definition.
+func Generate(def gofsm.Definition, c Config) ([]byte, error) {
+	if c.Package == "" {
+		c.Package = "main"
+	}
+	if c.Type == "" {
+		if c.Type = goIdent(def.Name); c.Type == "" {
+			c.Type = "Machine"
+		}
+	}
+	if !isExportedIdent(c.Type) {
+		return nil, fmt.Errorf("invalid type name '%s'", c.Type)
+	}
+
+	g := generator{Config: c, def: def, names: make(map[string]string, 32)}
+	if err := g.collect(); err != nil {
+		return nil, err
+	}
+
+	g.generate()
+	code, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("fail to format the generated code: %v", err)
+	}
+	return code, nil
+}
+
+func (g *generator) collect() (err error) {
+	g.states = getStates(g.def)
+	for _, t := range g.def.Transitions {
+		if !hasEvent(g.events, t.Event) {
+			g.events = append(g.events, t.Event)
+		}
+		g.actions = appendName(g.actions, t.Action)
+		g.guards = appendName(g.guards, t.Guard)
+	}
+	for _, p := range g.def.Pseudos {
+		for _, b := range p.Branches {
+			g.guards = appendName(g.guards, b.Guard)
+		}
+	}
+	for _, s := range g.def.States {
+		g.hooks = appendName(g.hooks, s.OnEnter)
+		g.hooks = appendName(g.hooks, s.OnExit)
+	}
+
+	// Check the conflicts of the Go identifiers.
+	idents := make(map[string]string, 32)
+	check := func(kind, name, ident string) error {
+		if ident == "" {
+			return fmt.Errorf("cannot convert the %s '%s' to the Go identifier", kind, name)
+		}
+		if other, ok := idents[ident]; ok {
+			return fmt.Errorf("the %s '%s' conflicts with %s as the Go identifier '%s'", kind, name, other, ident)
+		}
+		idents[ident] = fmt.Sprintf("the %s '%s'", kind, name)
+		return nil
+	}
+
+	for _, state := range g.states {
+		ident := goIdent(string(state))
+		if err = check("state", string(state), g.stateConst(ident)); err != nil {
+			return
+		}
+		g.names["state:"+string(state)] = ident
+	}
+
+	for _, event := range g.events {
+		ident := goIdent(string(event))
+		if err = check("event", string(event), g.eventConst(ident)); err != nil {
+			return
+		}
+		if hasString(reservedMethods, ident) {
+			return fmt.Errorf("the event '%s' conflicts with the method '%s'", event, ident)
+		}
+		if err = check("event", string(event), "method:"+ident); err != nil {
+			return
+		}
+		if err = check("event", string(event), "method:Can"+ident); err != nil {
+			return
+		}
+		g.names["event:"+string(event)] = ident
+	}
+
+	// The actions, guards and hooks are the methods of the same interface.
+	for _, methods := range []struct {
+		kind  string
+		names []string
+	}{{"action", g.actions}, {"guard", g.guards}, {"hook", g.hooks}} {
+		kind := methods.kind
+		for _, name := range methods.names {
+			ident := goIdent(name)
+			if err = check(kind, name, "interface:"+ident); err != nil {
+				return
+			}
+			g.names[kind+":"+name] = ident
+		}
+	}
+
+	return
+}
+
+func (g *generator) stateConst(ident string) string {
+	if ident == "" {
+		return ""
+	}
+	return g.Prefix + "State" + ident
+}
+
+func (g *generator) eventConst(ident string) string {
+	if ident == "" {
+		return ""
+	}
+	return g.Prefix + "Event" + ident
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) generate() {
+	if g.Source != "" {
+		g.printf("// Code generated by fsmgen from %s. DO NOT EDIT.\n\n", g.Source)
+	} else {
+		g.printf("// Code generated by fsmgen. DO NOT EDIT.\n\n")
+	}
+
+	g.printf("package %s\n\n", g.Package)
+	g.printf("import (\n\"context\"\n\n\"github.com/xgfone/go-fsm\"\n)\n\n")
+
+	g.generateConsts()
+	g.generateInterface()
+	g.generateMachine()
+	g.generateDefinition()
+}
+
+func (g *generator) generateConsts() {
+	g.printf("// The states of the state machine %s.\n", g.Type)
+	g.printf("const (\n")
+	for _, state := range g.states {
+		g.printf("%s fsm.State = %s\n", g.stateConst(g.names["state:"+string(state)]), strconv.Quote(string(state)))
+	}
+	g.printf(")\n\n")
+
+	g.printf("// The events of the state machine %s.\n", g.Type)
+	g.printf("const (\n")
+	for _, event := range g.events {
+		g.printf("%s fsm.Event = %s\n", g.eventConst(g.names["event:"+string(event)]), strconv.Quote(string(event)))
+	}
+	g.printf(")\n\n")
+}
+
+func (g *generator) generateInterface() {
+	g.printf("// %sActions is the actions, guards and hooks of the state machine %s,\n", g.Type, g.Type)
+	g.printf("// which must be implemented by the user.\n")
+	g.printf("type %sActions interface {\n", g.Type)
+	for _, name := range g.actions {
+		g.printf("// %s is the action %s.\n", g.names["action:"+name], strconv.Quote(name))
+		g.printf("%s(fsm *fsm.FSM, data interface{}) bool\n\n", g.names["action:"+name])
+	}
+	for _, name := range g.guards {
+		g.printf("// %s is the guard %s.\n", g.names["guard:"+name], strconv.Quote(name))
+		g.printf("%s(fsm *fsm.FSM, data interface{}) bool\n\n", g.names["guard:"+name])
+	}
+	for _, name := range g.hooks {
+		g.printf("// %s is the state hook %s.\n", g.names["hook:"+name], strconv.Quote(name))
+		g.printf("%s(state fsm.State)\n\n", g.names["hook:"+name])
+	}
+	g.printf("}\n\n")
+}
+
+func (g *generator) generateMachine() {
+	typ, recv := g.Type, "m"
+	defvar := lowerFirst(typ) + "Definition"
+
+	g.printf("// %s is the type-safe state machine.\n", typ)
+	g.printf("type %s struct{ fsm *fsm.FSM }\n\n", typ)
+
+	g.printf("// New%s returns a new state machine %s with the actions.\n", typ, typ)
+	g.printf("func New%s(actions %sActions) *%s {\n", typ, typ, typ)
+	g.printf("registry := fsm.NewRegistry()\n")
+	for _, name := range g.actions {
+		g.printf("registry.RegisterAction(%s, actions.%s)\n", strconv.Quote(name), g.names["action:"+name])
+	}
+	for _, name := range g.guards {
+		g.printf("registry.RegisterGuard(%s, actions.%s)\n", strconv.Quote(name), g.names["guard:"+name])
+	}
+	for _, name := range g.hooks {
+		g.printf("registry.RegisterHook(%s, actions.%s)\n", strconv.Quote(name), g.names["hook:"+name])
+	}
+	g.printf("\nf, err := %s.Build(registry)\n", defvar)
+	g.printf("if err != nil {\npanic(err)\n}\n")
+	g.printf("return &%s{fsm: f}\n}\n\n", typ)
+
+	g.printf("// FSM returns the underlying state machine.\n")
+	g.printf("func (%s *%s) FSM() *fsm.FSM { return %s.fsm }\n\n", recv, typ, recv)
+
+	g.printf("// Current returns the current state.\n")
+	g.printf("func (%s *%s) Current() fsm.State { return %s.fsm.Current() }\n\n", recv, typ, recv)
+
+	for _, event := range g.events {
+		ident := g.names["event:"+string(event)]
+		eventConst := g.eventConst(ident)
+
+		g.printf("// %s sends the event %s with the data to the state machine.\n", ident, eventConst)
+		g.printf("//\n// If the context is done, the event is not sent and return its error.\n")
+		g.printf("func (%s *%s) %s(ctx context.Context, data interface{}) error {\n", recv, typ, ident)
+		g.printf("if err := ctx.Err(); err != nil {\nreturn err\n}\n")
+		g.printf("return %s.fsm.SendEvent(%s, data)\n}\n\n", recv, eventConst)
+
+		g.printf("// Can%s reports whether the event %s with the data can trigger the state transition,\n", ident, eventConst)
+		g.printf("// which evaluates the guard of the transition.\n")
+		g.printf("func (%s *%s) Can%s(data interface{}) bool {\n", recv, typ, ident)
+		g.printf("return %s.fsm.TestEventWith(%s, data)\n}\n\n", recv, eventConst)
+	}
+}
+
+func (g *generator) generateDefinition() {
+	def := g.def
+	g.printf("var %sDefinition = fsm.Definition{\n", lowerFirst(g.Type))
+	if def.Name != "" {
+		g.printf("Name: %s,\n", strconv.Quote(def.Name))
+	}
+	if def.Version != 0 {
+		g.printf("Version: %d,\n", def.Version)
+	}
+	if def.Initial != "" {
+		g.printf("Initial: %s,\n", g.state(def.Initial))
+	}
+	if len(def.Finals) > 0 {
+		g.printf("Finals: []fsm.State{")
+		for _, state := range def.Finals {
+			g.printf("%s, ", g.state(state))
+		}
+		g.printf("},\n")
+	}
+	if len(def.Metadata) > 0 {
+		g.printf("Metadata: %s,\n", formatMetadata(def.Metadata))
+	}
+
+	if len(def.States) > 0 {
+		g.printf("States: []fsm.StateDefinition{\n")
+		for _, s := range def.States {
+			g.printf("{Name: %s", g.state(s.Name))
+			if s.OnEnter != "" {
+				g.printf(", OnEnter: %s", strconv.Quote(s.OnEnter))
+			}
+			if s.OnExit != "" {
+				g.printf(", OnExit: %s", strconv.Quote(s.OnExit))
+			}
+			if len(s.Metadata) > 0 {
+				g.printf(", Metadata: %s", formatMetadata(s.Metadata))
+			}
+			g.printf("},\n")
+		}
+		g.printf("},\n")
+	}
+
+	if len(def.Pseudos) > 0 {
+		g.printf("Pseudos: []fsm.PseudoDefinition{\n")
+		for _, p := range def.Pseudos {
+			kind := "fsm.Choice"
+			if p.Kind == gofsm.Junction {
+				kind = "fsm.Junction"
+			}
+
+			g.printf("{Name: %s, Kind: %s, Branches: []fsm.BranchDefinition{\n", strconv.Quote(string(p.Name)), kind)
+			for _, b := range p.Branches {
+				if b.Guard == "" {
+					g.printf("{Target: %s},\n", g.state(b.Target))
+				} else {
+					g.printf("{Target: %s, Guard: %s},\n", g.state(b.Target), strconv.Quote(b.Guard))
+				}
+			}
+			g.printf("}},\n")
+		}
+		g.printf("},\n")
+	}
+
+	g.printf("Transitions: []fsm.TransitionDefinition{\n")
+	for _, t := range def.Transitions {
+		g.printf("{Event: %s, Source: %s", g.eventConst(g.names["event:"+string(t.Event)]), g.state(t.Source))
+		if t.Target != "" {
+			g.printf(", Target: %s", g.state(t.Target))
+		}
+		switch t.Kind {
+		case gofsm.Internal:
+			g.printf(", Kind: fsm.Internal")
+		case gofsm.Reentrant:
+			g.printf(", Kind: fsm.Reentrant")
+		}
+		if t.Guard != "" {
+			g.printf(", Guard: %s", strconv.Quote(t.Guard))
+		}
+		if t.Action != "" {
+			g.printf(", Action: %s", strconv.Quote(t.Action))
+		}
+		if len(t.Metadata) > 0 {
+			g.printf(", Metadata: %s", formatMetadata(t.Metadata))
+		}
+		g.printf("},\n")
+	}
+	g.printf("},\n")
+
+	g.printf("}\n")
+}
+
+// state returns the constant of the state, or the quoted pseudo state.
+func (g *generator) state(state gofsm.State) string {
+	if ident, ok := g.names["state:"+string(state)]; ok {
+		return g.stateConst(ident)
+	}
+	return strconv.Quote(string(state))
+}
+
+func formatMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteString("map[string]string{")
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, "%s: %s", strconv.Quote(key), strconv.Quote(metadata[key]))
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// getStates returns all the non-pseudo states in the order of the appearance.
+func getStates(def gofsm.Definition) (states []gofsm.State) {
+	pseudos := make(map[gofsm.State]struct{}, len(def.Pseudos))
+	for _, p := range def.Pseudos {
+		pseudos[p.Name] = struct{}{}
+	}
+
+	add := func(state gofsm.State) {
+		if _, ok := pseudos[state]; !ok && state != "" && !hasState(states, state) {
+			states = append(states, state)
+		}
+	}
+
+	add(def.Initial)
+	for _, s := range def.States {
+		add(s.Name)
+	}
+	for _, t := range def.Transitions {
+		add(t.Source)
+		add(t.Target)
+	}
+	for _, p := range def.Pseudos {
+		for _, b := range p.Branches {
+			add(b.Target)
+		}
+	}
+	for _, state := range def.Finals {
+		add(state)
+	}
+	return
+}
+
+// goIdent converts the name to the exported Go identifier, such as
+// "approve order" or "approve-order" to "ApproveOrder".
+//
+// Return "" if failing to convert it.
+func goIdent(name string) string {
+	var buf bytes.Buffer
+	upper := true
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if upper {
+				r = unicode.ToUpper(r)
+				upper = false
+			}
+			buf.WriteRune(r)
+		default:
+			upper = true
+		}
+	}
+
+	ident := buf.String()
+	if !isExportedIdent(ident) {
+		return ""
+	}
+	return ident
+}
+
+func isExportedIdent(ident string) bool {
+	for i, r := range ident {
+		if i == 0 && !unicode.IsUpper(r) {
+			return false
+		} else if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return false
+		}
+	}
+	return ident != ""
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func appendName(names []string, name string) []string {
+	if name != "" && !hasString(names, name) {
+		names = append(names, name)
+	}
+	return names
+}
+
+func hasString(ss []string, s string) bool {
+	for _, _s := range ss {
+		if s == _s {
+			return true
+		}
+	}
+	return false
+}
+
+func hasState(ss []gofsm.State, s gofsm.State) bool {
+	for _, _s := range ss {
+		if s == _s {
+			return true
+		}
+	}
+	return false
+}
+
+func hasEvent(es []gofsm.Event, e gofsm.Event) bool {
+	for _, _e := range es {
+		if e == _e {
+			return true
+		}
+	}
+	return false
+}
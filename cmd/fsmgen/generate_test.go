@@ -0,0 +1,121 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	gofsm "github.com/xgfone/go-fsm"
+)
+
+const testDefinition = `
+machine "order"
+version 3
+initial Pending
+final Approved, Rejected
+
+state Pending {
+  enter logState
+}
+
+choice Check {
+  [isPassed] --> Approved
+  else --> Rejected
+}
+
+Pending --Review/review--> Check
+Pending --"send-remind"[canRemind]-->
+`
+
+func TestGenerate(t *testing.T) {
+	def, err := gofsm.LoadDefinition(strings.NewReader(testDefinition), gofsm.FormatDSL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := Generate(def, Config{Source: "order.fsm", Package: "order"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkCode(t, code)
+
+	src := string(code)
+	for _, expect := range []string{
+		"// Code generated by fsmgen from order.fsm. DO NOT EDIT.",
+		"package order",
+		`StatePending  fsm.State = "Pending"`,
+		`EventSendRemind fsm.Event = "send-remind"`,
+		"type OrderActions interface {",
+		"Review(fsm *fsm.FSM, data interface{}) bool",
+		"IsPassed(fsm *fsm.FSM, data interface{}) bool",
+		"LogState(state fsm.State)",
+		"func NewOrder(actions OrderActions) *Order {",
+		"func (m *Order) SendRemind(ctx context.Context, data interface{}) error {",
+		"func (m *Order) CanReview(data interface{}) bool {",
+		"Version: 3,",
+	} {
+		if !strings.Contains(src, expect) {
+			t.Errorf("missing '%s' in the generated code:\n%s", expect, src)
+		}
+	}
+}
+
+// checkCode parses and type-checks the generated code.
+func checkCode(t *testing.T, code []byte) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "order_fsm.go", code, 0)
+	if err != nil {
+		t.Fatalf("invalid generated code: %v", err)
+	}
+
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err = conf.Check("order", fset, []*ast.File{file}, nil); err != nil {
+		t.Fatalf("invalid generated code: %v\n%s", err, code)
+	}
+}
+
+func TestGenerateConflict(t *testing.T) {
+	def := gofsm.Definition{Transitions: []gofsm.TransitionDefinition{
+		{Event: "do-it", Source: "A", Target: "B"},
+		{Event: "do_it", Source: "B", Target: "A"},
+	}}
+	if _, err := Generate(def, Config{}); err == nil {
+		t.Error("expect a conflict error, but got nil")
+	}
+
+	def = gofsm.Definition{Transitions: []gofsm.TransitionDefinition{
+		{Event: "FSM", Source: "A", Target: "B"},
+	}}
+	if _, err := Generate(def, Config{}); err == nil {
+		t.Error("expect a reserved method error, but got nil")
+	}
+
+	// SendEvent is not generated, so it can be used as the event.
+	def = gofsm.Definition{Transitions: []gofsm.TransitionDefinition{
+		{Event: "SendEvent", Source: "A", Target: "B"},
+	}}
+	if code, err := Generate(def, Config{}); err != nil {
+		t.Error(err)
+	} else {
+		checkCode(t, code)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command fsmgen generates the type-safe state machine from the definition
+// file, which is friendly to go:generate, for example,
+//
+//	//go:generate go run github.com/xgfone/go-fsm/cmd/fsmgen -type Order order.fsm
+//
+// The format of the definition file is detected by the file extension:
+//
+//	.json         => json
+//	.yaml, .yml   => yaml
+//	.scxml, .xml  => scxml
+//	.fsm, .dsl    => dsl
+//
+// Or, it may be specified by the flag -format, such as "xstate".
+//
+// For each event, it generates the method "<Event>(ctx, data)" to send
+// the event, which is not sent if the context is done, and "Can<Event>(data)"
+// to test it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gofsm "github.com/xgfone/go-fsm"
+	_ "github.com/xgfone/go-fsm/fsmyaml"
+)
+
+var (
+	defformat = flag.String("format", "", "The format of the definition file, which is detected by the file extension by default.")
+	output    = flag.String("output", "", "The output file, which is <input>_fsm.go by default.")
+	pkgname   = flag.String("package", "", "The package name, which is $GOPACKAGE by default.")
+	typname   = flag.String("type", "", "The type name of the state machine, which is the definition name by default.")
+	prefix    = flag.String("prefix", "", "The prefix of the state and event constants.")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <definition-file>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0)); err != nil {
+		fmt.Fprintf(os.Stderr, "fsmgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(input string) (err error) {
+	if *defformat == "" {
+		if *defformat = detectFormat(input); *defformat == "" {
+			return fmt.Errorf("unknown format of the definition file '%s'", input)
+		}
+	}
+
+	if *pkgname == "" {
+		if *pkgname = os.Getenv("GOPACKAGE"); *pkgname == "" {
+			*pkgname = "main"
+		}
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(input, filepath.Ext(input)) + "_fsm.go"
+	}
+
+	file, err := os.Open(input)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	def, err := gofsm.LoadDefinition(file, *defformat)
+	if err != nil {
+		return
+	}
+
+	code, err := Generate(def, Config{
+		Source:  filepath.Base(input),
+		Package: *pkgname,
+		Type:    *typname,
+		Prefix:  *prefix,
+	})
+	if err != nil {
+		return
+	}
+
+	return ioutil.WriteFile(*output, code, 0644)
+}
+
+func detectFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return gofsm.FormatJSON
+	case ".yaml", ".yml":
+		return gofsm.FormatYAML
+	case ".scxml", ".xml":
+		return gofsm.FormatSCXML
+	case ".fsm", ".dsl":
+		return gofsm.FormatDSL
+	default:
+		return ""
+	}
+}
@@ -30,18 +30,83 @@ type State string
 // Action is a function that is called when the state is transitioned.
 type Action func(fsm *FSM, data interface{}) (transition bool)
 
+// Guard is a function to report whether a transition or a branch
+// is allowed to be taken, which should not have any side effect.
+type Guard func(fsm *FSM, data interface{}) bool
+
+// TransitionKind represents the kind of the state transition.
+type TransitionKind uint8
+
+const (
+	// External is the default transition kind, which exits the source state,
+	// enters the target state, and calls all the hooks, even if the source
+	// is equal to the target.
+	External TransitionKind = iota
+
+	// Internal is a transition that only calls the action without exiting
+	// or entering the state, so no hook is called and the state is not changed.
+	// Its target is always the same as the source.
+	Internal
+
+	// Reentrant is a self-transition that exits and re-enters the source
+	// state and calls all the hooks. Its target is always the same as the source.
+	Reentrant
+)
+
+func (k TransitionKind) String() string {
+	switch k {
+	case External:
+		return "external"
+	case Internal:
+		return "internal"
+	case Reentrant:
+		return "reentrant"
+	default:
+		return fmt.Sprintf("TransitionKind(%d)", k)
+	}
+}
+
+// MarshalText implements the interface encoding.TextMarshaler.
+func (k TransitionKind) MarshalText() ([]byte, error) {
+	switch k {
+	case External, Internal, Reentrant:
+		return []byte(k.String()), nil
+	default:
+		return nil, fmt.Errorf("unknown transition kind %d", k)
+	}
+}
+
+// UnmarshalText implements the interface encoding.TextUnmarshaler.
+func (k *TransitionKind) UnmarshalText(text []byte) error {
+	switch s := string(text); s {
+	case "", "external":
+		*k = External
+	case "internal":
+		*k = Internal
+	case "reentrant":
+		*k = Reentrant
+	default:
+		return fmt.Errorf("unknown transition kind '%s'", s)
+	}
+	return nil
+}
+
 // TransitionError is an transition error.
 type TransitionError struct {
 	Event Event
 
 	// If empty, the error represents no transition to support the event.
-	// Or, represents the state transition is suspended by Action.
+	// Or, represents the state transition is suspended by Guard or Action.
 	Source State
 	Target State
+
+	// If not empty, the error represents that no branch of the choice
+	// or junction pseudo-state matches.
+	Pseudo State
 }
 
 // IsSuspended reports whether the error is that the state transition
-// is suspended by Action.
+// is suspended by Guard or Action.
 func IsSuspended(err error) bool {
 	if te, ok := err.(TransitionError); ok {
 		return te.IsSuspended()
@@ -58,17 +123,34 @@ func IsNoTransition(err error) bool {
 	return false
 }
 
-// IsSuspended reports whether the state transition is suspended by Action.
-func (e TransitionError) IsSuspended() bool { return len(e.Source) > 0 }
+// IsNoBranch reports whether the error is that no branch of the choice
+// or junction pseudo-state matches.
+func IsNoBranch(err error) bool {
+	if te, ok := err.(TransitionError); ok {
+		return te.IsNoBranch()
+	}
+	return false
+}
+
+// IsSuspended reports whether the state transition is suspended by Guard or Action.
+func (e TransitionError) IsSuspended() bool { return len(e.Source) > 0 && len(e.Pseudo) == 0 }
 
 // IsNoTransition reports whether there is no state transition to support the event.
-func (e TransitionError) IsNoTransition() bool { return len(e.Source) > 0 }
+func (e TransitionError) IsNoTransition() bool { return len(e.Source) == 0 }
+
+// IsNoBranch reports whether no branch of the choice or junction pseudo-state matches.
+func (e TransitionError) IsNoBranch() bool { return len(e.Pseudo) > 0 }
 
 func (e TransitionError) Error() string {
 	if e.Source == "" {
 		return fmt.Sprintf("no transition for the event '%s'", e.Event)
 	}
 
+	if e.Pseudo != "" {
+		const s = "no branch of the pseudo state '%s' matches for the event '%s'"
+		return fmt.Sprintf(s, e.Pseudo, e.Event)
+	}
+
 	const s = "source state '%s' transition for the event '%s' is suspended"
 	return fmt.Sprintf(s, e.Source, e.Event)
 }
@@ -84,6 +166,26 @@ type Transition struct {
 	// Or, call it before transitioning the state and transition the state
 	// from source to target only if returning true.
 	Action Action
+
+	// If Guard is not nil, it is called before the action, and the state
+	// transition is suspended if returning false.
+	Guard Guard
+
+	// Kind is the kind of the transition, which is External by default.
+	Kind TransitionKind
+
+	// ActionName and GuardName are the names of the action and the guard,
+	// which are used to describe the transition, such as the definition.
+	ActionName string
+	GuardName  string
+
+	// Metadata is the extra information of the transition.
+	Metadata map[string]string
+
+	// Chains is the events that the action may set by SetEvent to continue
+	// to transition the state, which is only used by Validate to find
+	// the loops of the chained events.
+	Chains []Event
 }
 
 // NewTransition returns a Transition.
@@ -121,6 +223,52 @@ func (t Transition) WithAction(action Action) Transition {
 	return t
 }
 
+// WithNamedAction returns a new Transition with the action and its name.
+func (t Transition) WithNamedAction(name string, action Action) Transition {
+	t.Action, t.ActionName = action, name
+	return t
+}
+
+// WithGuard returns a new Transition with the guard and its name.
+func (t Transition) WithGuard(name string, guard Guard) Transition {
+	t.Guard, t.GuardName = guard, name
+	return t
+}
+
+// WithMetadata returns a new Transition with the metadata key and value.
+func (t Transition) WithMetadata(key, value string) Transition {
+	metadata := make(map[string]string, len(t.Metadata)+1)
+	for k, v := range t.Metadata {
+		metadata[k] = v
+	}
+	metadata[key] = value
+	t.Metadata = metadata
+	return t
+}
+
+// WithChains returns a new Transition with the events that the action
+// may set by SetEvent.
+func (t Transition) WithChains(events ...Event) Transition {
+	t.Chains = append([]Event(nil), events...)
+	return t
+}
+
+// WithKind returns a new Transition with the transition kind.
+func (t Transition) WithKind(kind TransitionKind) Transition {
+	t.Kind = kind
+	return t
+}
+
+// IsInternal reports whether the transition is an internal transition.
+func (t Transition) IsInternal() bool { return t.Kind == Internal }
+
+func (t Transition) normalize() Transition {
+	if t.Target == "" && (t.Kind == Internal || t.Kind == Reentrant) {
+		t.Target = t.Source
+	}
+	return t
+}
+
 // Add is a handy proxy method to add the current transition into the given FSM.
 func (t Transition) Add(fsm *FSM) { fsm.AddTransitions(t) }
 
@@ -129,10 +277,32 @@ type FSM struct {
 	exit        func(State)
 	enter       func(State)
 	transition  func(last, current State)
+	tracer      func(TraceEntry)
 	exitStates  map[State]func(State)
 	enterStates map[State]func(State)
 	transitions []Transition
-
+	shadowed    map[int][]Transition // The index to the replaced transitions in order.
+	pseudos     map[State]pseudoState
+
+	initial State
+	finals  []State
+	done    chan struct{}
+	closed  bool
+	ondone  func(State)
+
+	transactional bool
+	compensations []func()
+	intx          bool
+
+	name          string
+	version       int
+	migrations    *Migrations
+	metadata      map[string]string
+	stateMetadata map[State]map[string]string
+	enterNames    map[State]string
+	exitNames     map[State]string
+
+	vars    map[string]interface{}
 	current State
 	event   Event
 	data    interface{}
@@ -143,19 +313,38 @@ func New() *FSM {
 	return &FSM{
 		enterStates: make(map[State]func(State), 16),
 		exitStates:  make(map[State]func(State), 16),
+		pseudos:     make(map[State]pseudoState, 4),
 	}
 }
 
 // Reset resets the machine to the initial state.
+//
+// The channel returned by Done is closed if not yet, so that the goroutines
+// waiting for it are released instead of blocking forever.
 func (f *FSM) Reset() {
+	if f.done != nil && !f.closed {
+		close(f.done)
+	}
+
 	for key := range f.exitStates {
 		delete(f.exitStates, key)
 	}
 	for key := range f.enterStates {
 		delete(f.enterStates, key)
 	}
+	for key := range f.pseudos {
+		delete(f.pseudos, key)
+	}
+	for key := range f.vars {
+		delete(f.vars, key)
+	}
 
-	*f = FSM{exitStates: f.exitStates, enterStates: f.enterStates}
+	*f = FSM{
+		exitStates:  f.exitStates,
+		enterStates: f.enterStates,
+		pseudos:     f.pseudos,
+		vars:        f.vars,
+	}
 }
 
 // SetCurrent resets the current state to current.
@@ -163,21 +352,25 @@ func (f *FSM) SetCurrent(current State) {
 	if current == "" {
 		panic("the current state must not be empty")
 	}
+	if f.IsPseudo(current) {
+		panic(fmt.Sprintf("the current state '%s' must not be a pseudo state", current))
+	}
 	f.current = current
+	f.updateDone()
 }
 
 // Current returns the current state.
 func (f *FSM) Current() State { return f.current }
 
-// States returns all the states.
+// States returns all the states, which does not contain the pseudo states.
 func (f *FSM) States() (states []State) {
-	transitions := f.Transitions()
+	transitions := f.edges()
 	states = make([]State, 0, len(transitions))
 	for _, t := range transitions {
-		if !hasState(states, t.Source) {
+		if !hasState(states, t.Source) && !f.IsPseudo(t.Source) {
 			states = append(states, t.Source)
 		}
-		if !hasState(states, t.Target) {
+		if !hasState(states, t.Target) && !f.IsPseudo(t.Target) {
 			states = append(states, t.Target)
 		}
 	}
@@ -197,9 +390,16 @@ func (f *FSM) Events() (events []Event) {
 }
 
 // Terminations returns all the termination states.
+//
+// If the final states are declared, return them. Or, guess them as
+// the targets that are never the sources.
 func (f *FSM) Terminations() (states []State) {
+	if len(f.finals) > 0 {
+		return f.Finals()
+	}
+
 	var sources, targets []State
-	for _, t := range f.Transitions() {
+	for _, t := range f.edges() {
 		if !hasState(sources, t.Source) {
 			sources = append(sources, t.Source)
 		}
@@ -209,7 +409,7 @@ func (f *FSM) Terminations() (states []State) {
 	}
 
 	for _, state := range targets {
-		if !hasState(sources, state) {
+		if !hasState(sources, state) && !f.IsPseudo(state) {
 			states = append(states, state)
 		}
 	}
@@ -230,17 +430,40 @@ func (f *FSM) GetTransition(source State, event Event) (transition Transition, o
 
 // AddTransitions appends a set of transitions to transfer the state.
 //
+// If a transition has the same source and event as an added one,
+// it replaces the added one, which is reported by Validate as shadowed.
+//
 // Notice: the current implementation requires that the source, target
-// and event must be set.
+// and event must be set. But the target of the Internal or Reentrant
+// transition may be empty, which is set to the source.
 func (f *FSM) AddTransitions(transitions ...Transition) {
 	for _, t := range transitions {
+		t = t.normalize()
 		if t.Source == "" || t.Target == "" || t.Event == "" {
 			panic("invalid state transition: source, target, or event is empty")
 		}
+		if f.IsPseudo(t.Source) {
+			panic(fmt.Sprintf("invalid state transition: the source '%s' is a pseudo state", t.Source))
+		}
+
+		switch t.Kind {
+		case External:
+		case Internal, Reentrant:
+			if t.Target != t.Source {
+				panic("invalid state transition: the target of the internal or reentrant transition is not the source")
+			}
+		default:
+			panic(fmt.Sprintf("invalid state transition: unknown kind %d", t.Kind))
+		}
 	}
 
 	for _, t := range transitions {
+		t = t.normalize()
 		if index := f.indexTransition(t.Source, t.Event); index > -1 {
+			if f.shadowed == nil {
+				f.shadowed = make(map[int][]Transition, 4)
+			}
+			f.shadowed[index] = append(f.shadowed[index], f.transitions[index])
 			f.transitions[index] = t
 		} else {
 			f.transitions = append(f.transitions, t)
@@ -264,18 +487,53 @@ func (f *FSM) OnEnter(fn func(State)) { f.enter = fn }
 func (f *FSM) OnExit(fn func(State)) { f.exit = fn }
 
 // OnEnterState sets a function that will be called when entering a specific state.
-func (f *FSM) OnEnterState(state State, fn func(State)) { f.enterStates[state] = fn }
+func (f *FSM) OnEnterState(state State, fn func(State)) {
+	f.enterStates[state] = fn
+	delete(f.enterNames, state)
+}
 
 // OnExitState sets a function that will be called when exiting a specific state.
-func (f *FSM) OnExitState(state State, fn func(State)) { f.exitStates[state] = fn }
+func (f *FSM) OnExitState(state State, fn func(State)) {
+	f.exitStates[state] = fn
+	delete(f.exitNames, state)
+}
 
 // OnTransition sets a function that will be called
 // when the state is transferred from last to current.
 func (f *FSM) OnTransition(fn func(last, current State)) { f.transition = fn }
 
-// TestEvent reports whether the event can trigger the state transition.
+// TestEvent reports whether the current state has the transition
+// for the event.
+//
+// It returns false if the state machine is done. But the guard is not
+// evaluated, so use TestEventWith to test the event with the data.
 func (f *FSM) TestEvent(event Event) bool {
-	return f.indexTransition(f.Current(), event) > -1
+	return !f.IsDone() && f.indexTransition(f.Current(), event) > -1
+}
+
+// TestEventWith is the same as TestEvent, but also evaluates the guard
+// of the transition and the branches of the junctions with the data,
+// so it reports false if SendEvent rejects the event by them.
+//
+// The branches of the choices are not evaluated, because they depend
+// on the action, which is not called.
+func (f *FSM) TestEventWith(event Event, data interface{}) bool {
+	if f.IsDone() {
+		return false
+	}
+
+	index := f.indexTransition(f.Current(), event)
+	if index < 0 {
+		return false
+	}
+
+	t := f.transitions[index]
+	if t.Guard != nil && !t.Guard(f, data) {
+		return false
+	}
+
+	_, ok := f.resolvePseudo(t.Target, data, true)
+	return ok
 }
 
 // SetEvent sets the event with the data as the new input to continue
@@ -291,10 +549,22 @@ func (f *FSM) SendEvent(event Event, data interface{}) (err error) {
 		panic("FSM: the event must not be empty")
 	}
 
+	if f.IsDone() {
+		return ErrDone
+	}
+
+	if f.transactional && !f.intx {
+		return f.sendEventTx(event, data)
+	}
+
 	for {
 		f.SetEvent("", nil)
 		err = f.sendEvent(event, data)
-		if f.event == "" || (err != nil && !IsSuspended(err)) {
+		if f.event == "" || (err != nil && (f.intx || !IsSuspended(err))) {
+			f.SetEvent("", nil)
+			break
+		} else if f.IsDone() {
+			f.SetEvent("", nil)
 			break
 		}
 		event, data = f.event, f.data
@@ -307,11 +577,32 @@ func (f *FSM) sendEvent(event Event, data interface{}) error {
 	current := f.Current()
 	for _, t := range f.Transitions() {
 		if t.Source == current && t.Event == event {
+			if t.Guard != nil && !t.Guard(f, data) {
+				// Transition is suspended.
+				return TransitionError{Event: event, Source: t.Source, Target: t.Target}
+			}
+
+			// The junction is evaluated statically before the action.
+			target, ok := f.resolvePseudo(t.Target, data, true)
+			if !ok {
+				return TransitionError{Event: event, Source: t.Source, Target: t.Target, Pseudo: target}
+			}
+
 			if t.Action != nil && !t.Action(f, data) {
 				// Transition is suspended.
 				return TransitionError{Event: event, Source: t.Source, Target: t.Target}
 			}
 
+			if t.Kind == Internal {
+				f.trace(event, current, current)
+				return nil
+			}
+
+			// The choice is evaluated dynamically after the action.
+			if target, ok = f.resolvePseudo(target, data, false); !ok {
+				return TransitionError{Event: event, Source: t.Source, Target: t.Target, Pseudo: target}
+			}
+
 			if fn, ok := f.exitStates[current]; ok {
 				fn(current)
 			}
@@ -319,17 +610,23 @@ func (f *FSM) sendEvent(event Event, data interface{}) error {
 				f.exit(current)
 			}
 
-			f.SetCurrent(t.Target)
+			f.SetCurrent(target)
 
-			if fn, ok := f.enterStates[t.Target]; ok {
-				fn(t.Target)
+			if fn, ok := f.enterStates[target]; ok {
+				fn(target)
 			}
 			if f.enter != nil {
-				f.enter(t.Target)
+				f.enter(target)
 			}
 
 			if f.transition != nil {
-				f.transition(current, t.Target)
+				f.transition(current, target)
+			}
+			f.trace(event, current, target)
+
+			// In the transaction, it is notified only when committing.
+			if !f.intx && f.IsFinal(target) && f.ondone != nil {
+				f.ondone(target)
 			}
 
 			return nil
@@ -356,6 +653,8 @@ func (ss sortedStates) Len() int           { return len(ss) }
 func (ss sortedStates) Swap(i, j int)      { ss[i], ss[j] = ss[j], ss[i] }
 func (ss sortedStates) Less(i, j int) bool { return ss[i] < ss[j] }
 
+func sortStates(ss []State) { sort.Sort(sortedStates(ss)) }
+
 func cloneAndSortTransitions(ts []Transition) []Transition {
 	transitions := make(sortedTransitions, len(ts))
 	copy(transitions, ts)
@@ -0,0 +1,232 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "fmt"
+
+// PseudoKind is the kind of the pseudo state.
+type PseudoKind uint8
+
+const (
+	// Choice is a pseudo state whose branches are evaluated dynamically
+	// after the action of the incoming transition has been called.
+	Choice PseudoKind = iota + 1
+
+	// Junction is a pseudo state whose branches are evaluated statically
+	// before the action of the incoming transition is called.
+	Junction
+)
+
+func (k PseudoKind) String() string {
+	switch k {
+	case Choice:
+		return "choice"
+	case Junction:
+		return "junction"
+	default:
+		return fmt.Sprintf("PseudoKind(%d)", k)
+	}
+}
+
+// MarshalText implements the interface encoding.TextMarshaler.
+func (k PseudoKind) MarshalText() ([]byte, error) {
+	switch k {
+	case Choice, Junction:
+		return []byte(k.String()), nil
+	default:
+		return nil, fmt.Errorf("unknown pseudo kind %d", k)
+	}
+}
+
+// UnmarshalText implements the interface encoding.TextUnmarshaler.
+func (k *PseudoKind) UnmarshalText(text []byte) error {
+	switch s := string(text); s {
+	case "", "choice":
+		*k = Choice
+	case "junction":
+		*k = Junction
+	default:
+		return fmt.Errorf("unknown pseudo kind '%s'", s)
+	}
+	return nil
+}
+
+// Branch is an outgoing branch of the choice or junction pseudo state.
+type Branch struct {
+	Target State
+
+	// If Guard is nil, the branch is the else branch, which is taken
+	// only if no other branch matches.
+	Guard Guard
+
+	// GuardName is the name of the guard, which is only used to describe
+	// the branch, such as the visualizers.
+	GuardName string
+}
+
+// When returns a new Branch to the target with the named guard.
+func When(target State, guardName string, guard Guard) Branch {
+	if guard == nil {
+		panic("the guard of the branch must not be nil")
+	}
+	return Branch{Target: target, Guard: guard, GuardName: guardName}
+}
+
+// Else returns a new else Branch to the target.
+func Else(target State) Branch { return Branch{Target: target} }
+
+// IsElse reports whether the branch is the else branch.
+func (b Branch) IsElse() bool { return b.Guard == nil }
+
+// Label returns the label of the branch, such as "[guard]" or "[else]".
+func (b Branch) Label() string {
+	switch {
+	case b.Guard == nil:
+		return "[else]"
+	case b.GuardName != "":
+		return "[" + b.GuardName + "]"
+	default:
+		return ""
+	}
+}
+
+type pseudoState struct {
+	kind     PseudoKind
+	branches []Branch
+}
+
+// AddChoice adds a choice pseudo state with the branches, which may be used
+// as the target of the transitions.
+//
+// When transitioning to the choice, the guards of the branches are evaluated
+// in turn with the data of the event after the action of the transition
+// has been called, and the first matching branch decides the real target.
+// If no guard matches, the else branch is taken.
+func (f *FSM) AddChoice(choice State, branches ...Branch) {
+	f.addPseudo(choice, Choice, branches)
+}
+
+// AddJunction adds a junction pseudo state with the branches, which may be
+// used as the target of the transitions.
+//
+// It is the same as the choice, but the guards of the branches are evaluated
+// before the action of the transition is called. So, if no branch matches,
+// the action is not called.
+func (f *FSM) AddJunction(junction State, branches ...Branch) {
+	f.addPseudo(junction, Junction, branches)
+}
+
+func (f *FSM) addPseudo(state State, kind PseudoKind, branches []Branch) {
+	if state == "" {
+		panic("the pseudo state must not be empty")
+	} else if len(branches) == 0 {
+		panic(fmt.Sprintf("the pseudo state '%s' has no branches", state))
+	}
+
+	for _, b := range branches {
+		if b.Target == "" {
+			panic(fmt.Sprintf("the branch target of the pseudo state '%s' is empty", state))
+		}
+	}
+
+	for _, t := range f.transitions {
+		if t.Source == state {
+			panic(fmt.Sprintf("the pseudo state '%s' is used as the source of the transition", state))
+		}
+	}
+
+	if f.current == state {
+		panic(fmt.Sprintf("the pseudo state '%s' is used as the current state", state))
+	}
+
+	f.pseudos[state] = pseudoState{kind: kind, branches: append([]Branch(nil), branches...)}
+}
+
+// IsPseudo reports whether the state is a choice or junction pseudo state.
+func (f *FSM) IsPseudo(state State) bool {
+	_, ok := f.pseudos[state]
+	return ok
+}
+
+// Pseudo returns the kind and the branches of the pseudo state.
+//
+// If the pseudo state does not exist, return (0, nil).
+func (f *FSM) Pseudo(state State) (kind PseudoKind, branches []Branch) {
+	if p, ok := f.pseudos[state]; ok {
+		kind, branches = p.kind, p.branches
+	}
+	return
+}
+
+// Pseudos returns all the choice and junction pseudo states.
+func (f *FSM) Pseudos() (states []State) {
+	states = make([]State, 0, len(f.pseudos))
+	for state := range f.pseudos {
+		states = append(states, state)
+	}
+	sortStates(states)
+	return
+}
+
+// resolvePseudo resolves the target until it is not a pseudo state.
+// If onlyJunction is true, only resolve the junctions.
+//
+// If failing to resolve it, return the unresolved pseudo state and false.
+func (f *FSM) resolvePseudo(target State, data interface{}, onlyJunction bool) (State, bool) {
+	for i := 0; i <= len(f.pseudos); i++ {
+		p, ok := f.pseudos[target]
+		if !ok || (onlyJunction && p.kind != Junction) {
+			return target, true
+		}
+
+		next, ok := p.match(f, data)
+		if !ok {
+			return target, false
+		}
+		target = next
+	}
+
+	return target, false // There is a loop among the pseudo states.
+}
+
+func (p pseudoState) match(f *FSM, data interface{}) (target State, ok bool) {
+	for _, b := range p.branches {
+		if b.Guard == nil {
+			if !ok {
+				target, ok = b.Target, true
+			}
+		} else if b.Guard(f, data) {
+			return b.Target, true
+		}
+	}
+	return
+}
+
+// edges returns all the transitions, and the branches of the pseudo states
+// as the transitions without the event.
+func (f *FSM) edges() []Transition {
+	if len(f.pseudos) == 0 {
+		return f.transitions
+	}
+
+	edges := make([]Transition, 0, len(f.transitions)+len(f.pseudos)*2)
+	edges = append(edges, f.transitions...)
+	for _, state := range f.Pseudos() {
+		for _, b := range f.pseudos[state].branches {
+			edges = append(edges, Transition{Source: state, Target: b.Target})
+		}
+	}
+	return edges
+}
@@ -0,0 +1,480 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// Predefine some definition formats.
+//
+// FormatYAML is registered by importing the package
+// github.com/xgfone/go-fsm/fsmyaml, so that this package does not depend
+// on any third-party package.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+type definitionFormat struct {
+	unmarshal func([]byte, *Definition) error
+	marshal   func(Definition) ([]byte, error)
+}
+
+var (
+	formatsLock sync.RWMutex
+	formats     = make(map[string]definitionFormat, 4)
+)
+
+// RegisterFormat registers the codec of the definition format, which is used
+// by LoadDefinition and MarshalDefinition. If the format has been registered,
+// it is overridden.
+//
+// The built-in formats, such as FormatJSON, cannot be overridden.
+func RegisterFormat(format string, unmarshal func(data []byte, def *Definition) error,
+	marshal func(def Definition) ([]byte, error)) {
+	if format == "" || unmarshal == nil || marshal == nil {
+		panic("the definition format, unmarshal or marshal must not be empty")
+	}
+
+	formatsLock.Lock()
+	formats[format] = definitionFormat{unmarshal: unmarshal, marshal: marshal}
+	formatsLock.Unlock()
+}
+
+func getFormat(format string) (f definitionFormat, err error) {
+	formatsLock.RLock()
+	f, ok := formats[format]
+	formatsLock.RUnlock()
+
+	if !ok {
+		err = fmt.Errorf("unknown definition format '%s'", format)
+	}
+	return
+}
+
+// Definition is the declarative description of the state machine,
+// which may be loaded from or marshaled to JSON, YAML, etc.
+type Definition struct {
+	Name     string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Version  int               `json:"version,omitempty" yaml:"version,omitempty"`
+	Initial  State             `json:"initial,omitempty" yaml:"initial,omitempty"`
+	Finals   []State           `json:"finals,omitempty" yaml:"finals,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	States      []StateDefinition      `json:"states,omitempty" yaml:"states,omitempty"`
+	Pseudos     []PseudoDefinition     `json:"pseudos,omitempty" yaml:"pseudos,omitempty"`
+	Transitions []TransitionDefinition `json:"transitions" yaml:"transitions"`
+}
+
+// StateDefinition is the description of the state.
+type StateDefinition struct {
+	Name     State             `json:"name" yaml:"name"`
+	OnEnter  string            `json:"onEnter,omitempty" yaml:"onEnter,omitempty"`
+	OnExit   string            `json:"onExit,omitempty" yaml:"onExit,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+// PseudoDefinition is the description of the choice or junction pseudo state.
+type PseudoDefinition struct {
+	Name     State              `json:"name" yaml:"name"`
+	Kind     PseudoKind         `json:"kind" yaml:"kind"`
+	Branches []BranchDefinition `json:"branches" yaml:"branches"`
+}
+
+// BranchDefinition is the description of the branch of the pseudo state.
+//
+// If Guard is empty, it is the else branch.
+type BranchDefinition struct {
+	Target State  `json:"target" yaml:"target"`
+	Guard  string `json:"guard,omitempty" yaml:"guard,omitempty"`
+}
+
+// TransitionDefinition is the description of the transition.
+type TransitionDefinition struct {
+	Event    Event             `json:"event" yaml:"event"`
+	Source   State             `json:"source" yaml:"source"`
+	Target   State             `json:"target,omitempty" yaml:"target,omitempty"`
+	Kind     TransitionKind    `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Guard    string            `json:"guard,omitempty" yaml:"guard,omitempty"`
+	Action   string            `json:"action,omitempty" yaml:"action,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+// Registry is used to resolve the actions, guards and hooks by the name.
+type Registry struct {
+	actions map[string]Action
+	guards  map[string]Guard
+	hooks   map[string]func(State)
+}
+
+// NewRegistry returns a new registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		actions: make(map[string]Action, 8),
+		guards:  make(map[string]Guard, 8),
+		hooks:   make(map[string]func(State), 8),
+	}
+}
+
+// RegisterAction registers the action with the name, and returns itself.
+func (r *Registry) RegisterAction(name string, action Action) *Registry {
+	if name == "" || action == nil {
+		panic("the action name or function must not be empty")
+	}
+	r.actions[name] = action
+	return r
+}
+
+// RegisterGuard registers the guard with the name, and returns itself.
+func (r *Registry) RegisterGuard(name string, guard Guard) *Registry {
+	if name == "" || guard == nil {
+		panic("the guard name or function must not be empty")
+	}
+	r.guards[name] = guard
+	return r
+}
+
+// RegisterHook registers the state hook with the name, and returns itself.
+func (r *Registry) RegisterHook(name string, hook func(State)) *Registry {
+	if name == "" || hook == nil {
+		panic("the hook name or function must not be empty")
+	}
+	r.hooks[name] = hook
+	return r
+}
+
+// Action returns the registered action by the name.
+func (r *Registry) Action(name string) (action Action, ok bool) {
+	if r != nil {
+		action, ok = r.actions[name]
+	}
+	return
+}
+
+// Guard returns the registered guard by the name.
+func (r *Registry) Guard(name string) (guard Guard, ok bool) {
+	if r != nil {
+		guard, ok = r.guards[name]
+	}
+	return
+}
+
+// Hook returns the registered state hook by the name.
+func (r *Registry) Hook(name string) (hook func(State), ok bool) {
+	if r != nil {
+		hook, ok = r.hooks[name]
+	}
+	return
+}
+
+// LoadDefinition loads the definition of the state machine from r
+// with the format, such as FormatJSON, FormatSCXML, FormatXState, FormatDSL,
+// or the registered format like FormatYAML. See RegisterFormat.
+func LoadDefinition(r io.Reader, format string) (def Definition, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	switch format {
+	case FormatJSON:
+		err = json.Unmarshal(data, &def)
+	case FormatSCXML:
+		return ParseSCXML(bytes.NewReader(data))
+	case FormatXState:
+		return ParseXState(bytes.NewReader(data))
+	case FormatDSL:
+		return ParseDSL(bytes.NewReader(data))
+	default:
+		var f definitionFormat
+		if f, err = getFormat(format); err == nil {
+			err = f.unmarshal(data, &def)
+		}
+	}
+
+	if err != nil {
+		err = fmt.Errorf("fail to load the definition: %v", err)
+	}
+	return
+}
+
+// LoadFSM loads the definition of the state machine from r with the format
+// by LoadDefinition, and builds the state machine by the registry.
+func LoadFSM(r io.Reader, format string, registry *Registry) (*FSM, error) {
+	def, err := LoadDefinition(r, format)
+	if err != nil {
+		return nil, err
+	}
+	return def.Build(registry)
+}
+
+// MarshalDefinition exports the definition of the state machine
+// with the format, such as FormatJSON, FormatSCXML, FormatXState, FormatDSL,
+// or the registered format like FormatYAML. See RegisterFormat.
+func MarshalDefinition(f *FSM, format string) (data []byte, err error) {
+	def, err := f.Definition()
+	if err != nil {
+		return
+	}
+
+	switch format {
+	case FormatJSON:
+		data, err = json.MarshalIndent(def, "", "  ")
+	case FormatSCXML:
+		data, err = MarshalSCXML(def)
+	case FormatXState:
+		data, err = MarshalXState(def)
+	case FormatDSL:
+		data, err = MarshalDSL(def)
+	default:
+		var f definitionFormat
+		if f, err = getFormat(format); err == nil {
+			data, err = f.marshal(def)
+		}
+	}
+	return
+}
+
+// Build builds a new state machine from the definition, and the actions,
+// guards and hooks referenced by the name are resolved by the registry.
+func (d Definition) Build(r *Registry) (f *FSM, err error) {
+	f = New()
+	if err = d.buildTo(f, r); err != nil {
+		f = nil
+	}
+	return
+}
+
+func (d Definition) buildTo(f *FSM, r *Registry) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("invalid definition: %v", v)
+		}
+	}()
+
+	f.SetName(d.Name)
+	f.SetVersion(d.Version)
+	for key, value := range d.Metadata {
+		f.SetMetadata(key, value)
+	}
+
+	for _, s := range d.States {
+		if s.Name == "" {
+			return fmt.Errorf("invalid definition: the state name is empty")
+		}
+
+		for key, value := range s.Metadata {
+			f.SetStateMetadata(s.Name, key, value)
+		}
+
+		if s.OnEnter != "" {
+			hook, ok := r.Hook(s.OnEnter)
+			if !ok {
+				return fmt.Errorf("no hook named '%s' for the state '%s'", s.OnEnter, s.Name)
+			}
+			f.OnEnterState(s.Name, hook)
+			setStateName(&f.enterNames, s.Name, s.OnEnter)
+		}
+
+		if s.OnExit != "" {
+			hook, ok := r.Hook(s.OnExit)
+			if !ok {
+				return fmt.Errorf("no hook named '%s' for the state '%s'", s.OnExit, s.Name)
+			}
+			f.OnExitState(s.Name, hook)
+			setStateName(&f.exitNames, s.Name, s.OnExit)
+		}
+	}
+
+	for _, p := range d.Pseudos {
+		branches := make([]Branch, len(p.Branches))
+		for i, b := range p.Branches {
+			branches[i] = Branch{Target: b.Target, GuardName: b.Guard}
+			if b.Guard != "" {
+				guard, ok := r.Guard(b.Guard)
+				if !ok {
+					return fmt.Errorf("no guard named '%s' for the pseudo state '%s'", b.Guard, p.Name)
+				}
+				branches[i].Guard = guard
+			}
+		}
+		if p.Kind == 0 {
+			p.Kind = Choice
+		}
+		f.addPseudo(p.Name, p.Kind, branches)
+	}
+
+	transitions := make([]Transition, len(d.Transitions))
+	for i, t := range d.Transitions {
+		transitions[i] = Transition{
+			Event:      t.Event,
+			Source:     t.Source,
+			Target:     t.Target,
+			Kind:       t.Kind,
+			ActionName: t.Action,
+			GuardName:  t.Guard,
+			Metadata:   cloneMetadata(t.Metadata),
+		}
+
+		if t.Action != "" {
+			action, ok := r.Action(t.Action)
+			if !ok {
+				return fmt.Errorf("no action named '%s' for the transition '%s' from '%s'",
+					t.Action, t.Event, t.Source)
+			}
+			transitions[i].Action = action
+		}
+
+		if t.Guard != "" {
+			guard, ok := r.Guard(t.Guard)
+			if !ok {
+				return fmt.Errorf("no guard named '%s' for the transition '%s' from '%s'",
+					t.Guard, t.Event, t.Source)
+			}
+			transitions[i].Guard = guard
+		}
+	}
+	f.AddTransitions(transitions...)
+
+	if d.Initial != "" {
+		f.SetInitial(d.Initial)
+	}
+	f.AddFinals(d.Finals...)
+
+	return
+}
+
+// Definition exports the definition of the state machine.
+//
+// If the action, guard or hook is set but not named, return an error.
+func (f *FSM) Definition() (def Definition, err error) {
+	def.Name = f.name
+	def.Version = f.version
+	def.Initial = f.initial
+	def.Finals = f.Finals()
+	def.Metadata = f.Metadata()
+
+	states := f.States()
+	sortStates(states)
+	for _, state := range states {
+		s := StateDefinition{
+			Name:     state,
+			OnEnter:  f.enterNames[state],
+			OnExit:   f.exitNames[state],
+			Metadata: f.StateMetadata(state),
+		}
+
+		if _, ok := f.enterStates[state]; ok && s.OnEnter == "" {
+			return def, fmt.Errorf("the enter hook of the state '%s' is not named", state)
+		}
+		if _, ok := f.exitStates[state]; ok && s.OnExit == "" {
+			return def, fmt.Errorf("the exit hook of the state '%s' is not named", state)
+		}
+
+		if s.OnEnter != "" || s.OnExit != "" || len(s.Metadata) > 0 {
+			def.States = append(def.States, s)
+		}
+	}
+
+	for _, state := range f.Pseudos() {
+		kind, branches := f.Pseudo(state)
+		p := PseudoDefinition{Name: state, Kind: kind}
+		p.Branches = make([]BranchDefinition, len(branches))
+		for i, b := range branches {
+			if b.Guard != nil && b.GuardName == "" {
+				return def, fmt.Errorf("the guard of the branch of the pseudo state '%s' is not named", state)
+			}
+			p.Branches[i] = BranchDefinition{Target: b.Target, Guard: b.GuardName}
+		}
+		def.Pseudos = append(def.Pseudos, p)
+	}
+
+	def.Transitions = make([]TransitionDefinition, len(f.transitions))
+	for i, t := range f.Transitions() {
+		if t.Action != nil && t.ActionName == "" {
+			return def, fmt.Errorf("the action of the transition '%s' from '%s' is not named", t.Event, t.Source)
+		}
+		if t.Guard != nil && t.GuardName == "" {
+			return def, fmt.Errorf("the guard of the transition '%s' from '%s' is not named", t.Event, t.Source)
+		}
+
+		def.Transitions[i] = TransitionDefinition{
+			Event:    t.Event,
+			Source:   t.Source,
+			Target:   t.Target,
+			Kind:     t.Kind,
+			Guard:    t.GuardName,
+			Action:   t.ActionName,
+			Metadata: cloneMetadata(t.Metadata),
+		}
+
+		if t.Kind != External {
+			def.Transitions[i].Target = ""
+		}
+	}
+
+	return
+}
+
+// getDefinitionStates returns all the non-pseudo states of the definition,
+// the initial state first, then in the order of the first appearance,
+// and the final states last.
+func getDefinitionStates(def Definition) []State {
+	states := make([]State, 0, len(def.Transitions)+len(def.Finals)+1)
+	add := func(state State) {
+		if state == "" || hasState(states, state) || hasState(def.Finals, state) {
+			return
+		}
+		for _, p := range def.Pseudos {
+			if p.Name == state {
+				return
+			}
+		}
+		states = append(states, state)
+	}
+
+	add(def.Initial)
+	for _, s := range def.States {
+		add(s.Name)
+	}
+	for _, t := range def.Transitions {
+		add(t.Source)
+		add(t.Target)
+	}
+	for _, p := range def.Pseudos {
+		for _, b := range p.Branches {
+			add(b.Target)
+		}
+	}
+	for _, state := range def.Finals {
+		if !hasState(states, state) {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+func setStateName(names *map[State]string, state State, name string) {
+	if *names == nil {
+		*names = make(map[State]string, 8)
+	}
+	(*names)[state] = name
+}
@@ -0,0 +1,134 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testJSONDefinition = `{
+  "name": "order",
+  "initial": "Pending",
+  "finals": ["Approved", "Rejected"],
+  "metadata": {"owner": "product"},
+  "states": [
+    {"name": "Pending", "onEnter": "logState", "metadata": {"note": "waiting for the review"}}
+  ],
+  "pseudos": [
+    {"name": "Check", "kind": "choice", "branches": [
+      {"target": "Approved", "guard": "isPassed"},
+      {"target": "Rejected"}
+    ]}
+  ],
+  "transitions": [
+    {"event": "Review", "source": "Pending", "target": "Check", "action": "review"},
+    {"event": "Remind", "source": "Pending", "kind": "internal", "guard": "canRemind"}
+  ]
+}`
+
+func testRegistry() *Registry {
+	return NewRegistry().
+		RegisterAction("review", func(*FSM, interface{}) bool { return true }).
+		RegisterGuard("isPassed", func(f *FSM, data interface{}) bool { return data.(int) >= 60 }).
+		RegisterGuard("canRemind", func(*FSM, interface{}) bool { return true }).
+		RegisterHook("logState", func(State) {})
+}
+
+func TestDefinitionRoundTrip(t *testing.T) {
+	def, err := LoadDefinition(strings.NewReader(testJSONDefinition), FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsm, err := def.Build(testRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fsm.SendEvent("Review", 80); err != nil {
+		t.Fatal(err)
+	} else if current := fsm.Current(); current != "Approved" {
+		t.Errorf("expect the state '%s', but got '%s'", "Approved", current)
+	}
+
+	for _, format := range []string{FormatJSON} {
+		data, err := MarshalDefinition(fsm, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		newdef, err := LoadDefinition(strings.NewReader(string(data)), format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(def, newdef) {
+			t.Errorf("%s: expect the definition %+v, but got %+v", format, def, newdef)
+		}
+	}
+}
+
+func TestLoadFSM(t *testing.T) {
+	fsm, err := LoadFSM(strings.NewReader(testJSONDefinition), FormatJSON, testRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fsm.SendEvent("Review", 50); err != nil {
+		t.Fatal(err)
+	} else if current := fsm.Current(); current != "Rejected" {
+		t.Errorf("expect the state '%s', but got '%s'", "Rejected", current)
+	}
+
+	if _, err = LoadFSM(strings.NewReader(testJSONDefinition), FormatJSON, nil); err == nil {
+		t.Error("expect an error for the unregistered action")
+	}
+}
+
+func TestRegisterFormat(t *testing.T) {
+	const format = "test"
+	if _, err := LoadDefinition(strings.NewReader(""), format); err == nil {
+		t.Errorf("expect an error for the unregistered format")
+	}
+
+	RegisterFormat(format,
+		func(data []byte, def *Definition) error { def.Name = string(data); return nil },
+		func(def Definition) ([]byte, error) { return []byte(def.Name), nil })
+
+	def, err := LoadDefinition(strings.NewReader("order"), format)
+	if err != nil {
+		t.Fatal(err)
+	} else if def.Name != "order" {
+		t.Errorf("expect the name '%s', but got '%s'", "order", def.Name)
+	}
+}
+
+func TestDefinitionBuildError(t *testing.T) {
+	def := Definition{Transitions: []TransitionDefinition{
+		{Event: "Review", Source: "Pending", Target: "Approved", Action: "missing"},
+	}}
+
+	if _, err := def.Build(testRegistry()); err == nil {
+		t.Errorf("expect an error for the unregistered action")
+	}
+
+	def.Transitions[0].Action = ""
+	def.Transitions[0].Source = ""
+	if _, err := def.Build(testRegistry()); err == nil {
+		t.Errorf("expect an error for the empty source")
+	}
+}
@@ -0,0 +1,498 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The colors of the added, removed and changed elements in the diagrams
+// rendered by Difference.
+const (
+	DiffAddedColor   = "green"
+	DiffRemovedColor = "red"
+	DiffChangedColor = "orange"
+)
+
+// TransitionChange is a transition which exists in both state machines
+// with the same source and event but has been changed.
+type TransitionChange struct {
+	Old, New Transition
+
+	// Changes is the changed fields of the transition in order,
+	// which are "target", "kind", "guard", "action" and "metadata".
+	Changes []string
+}
+
+// StateChange is a state which exists in both state machines but has been changed.
+type StateChange struct {
+	State State
+
+	// Changes is the changed fields of the state in order, which are "final",
+	// "pseudo", "branches", "onenter", "onexit" and "metadata".
+	Changes []string
+}
+
+// Difference is the structural difference between two state machines.
+type Difference struct {
+	AddedStates   []State
+	RemovedStates []State
+	ChangedStates []StateChange
+
+	AddedEvents   []Event
+	RemovedEvents []Event
+
+	AddedTransitions   []Transition
+	RemovedTransitions []Transition
+	ChangedTransitions []TransitionChange
+
+	// NewlyUnreachable is the states that are unreachable from the initial
+	// state in the new state machine but reachable or absent in the old one.
+	NewlyUnreachable []State
+
+	old, new *FSM
+}
+
+// Diff returns the structural difference from the old state machine
+// to the new one, in which all the lists are sorted.
+//
+// The states are compared by the names, and the transitions are compared
+// by the source and the event. The guards, the actions and the hooks are
+// compared by their names.
+//
+// The nil state machine is regarded as the empty one.
+func Diff(oldFSM, newFSM *FSM) (d Difference) {
+	d.old, d.new = oldFSM, newFSM
+	oldFSM, newFSM = d.machines()
+
+	oldStates, newStates := oldFSM.validateStates(), newFSM.validateStates()
+	for _, state := range newStates {
+		if !hasState(oldStates, state) {
+			d.AddedStates = append(d.AddedStates, state)
+		} else if changes := diffState(oldFSM, newFSM, state); len(changes) > 0 {
+			d.ChangedStates = append(d.ChangedStates, StateChange{State: state, Changes: changes})
+		}
+	}
+	for _, state := range oldStates {
+		if !hasState(newStates, state) {
+			d.RemovedStates = append(d.RemovedStates, state)
+		}
+	}
+
+	oldEvents, newEvents := oldFSM.events(), newFSM.events()
+	for _, event := range newEvents {
+		if !hasEvent(oldEvents, event) {
+			d.AddedEvents = append(d.AddedEvents, event)
+		}
+	}
+	for _, event := range oldEvents {
+		if !hasEvent(newEvents, event) {
+			d.RemovedEvents = append(d.RemovedEvents, event)
+		}
+	}
+
+	for _, t := range cloneAndSortTransitions(newFSM.transitions) {
+		old, ok := oldFSM.GetTransition(t.Source, t.Event)
+		if !ok {
+			d.AddedTransitions = append(d.AddedTransitions, t)
+		} else if changes := diffTransition(old, t); len(changes) > 0 {
+			d.ChangedTransitions = append(d.ChangedTransitions,
+				TransitionChange{Old: old, New: t, Changes: changes})
+		}
+	}
+	for _, t := range cloneAndSortTransitions(oldFSM.transitions) {
+		if _, ok := newFSM.GetTransition(t.Source, t.Event); !ok {
+			d.RemovedTransitions = append(d.RemovedTransitions, t)
+		}
+	}
+
+	oldStart, newStart := oldFSM.startState(), newFSM.startState()
+	if newStart != "" {
+		var oldReachable map[State]struct{}
+		if oldStart != "" {
+			oldReachable = oldFSM.reachableStates(oldStart)
+		}
+
+		newReachable := newFSM.reachableStates(newStart)
+		for _, state := range newStates {
+			if _, ok := newReachable[state]; ok {
+				continue
+			}
+
+			if _, ok := oldReachable[state]; ok || oldStart == "" || !hasState(oldStates, state) {
+				d.NewlyUnreachable = append(d.NewlyUnreachable, state)
+			}
+		}
+	}
+
+	return
+}
+
+func diffState(oldFSM, newFSM *FSM, state State) (changes []string) {
+	if oldFSM.IsFinal(state) != newFSM.IsFinal(state) {
+		changes = append(changes, "final")
+	}
+
+	oldPseudo, oldOK := oldFSM.pseudos[state]
+	newPseudo, newOK := newFSM.pseudos[state]
+	if oldOK != newOK || oldPseudo.kind != newPseudo.kind {
+		changes = append(changes, "pseudo")
+	}
+	if branchesLabel(oldPseudo.branches) != branchesLabel(newPseudo.branches) {
+		changes = append(changes, "branches")
+	}
+
+	if hookName(oldFSM.enterStates[state] != nil, oldFSM.enterNames[state]) !=
+		hookName(newFSM.enterStates[state] != nil, newFSM.enterNames[state]) {
+		changes = append(changes, "onenter")
+	}
+	if hookName(oldFSM.exitStates[state] != nil, oldFSM.exitNames[state]) !=
+		hookName(newFSM.exitStates[state] != nil, newFSM.exitNames[state]) {
+		changes = append(changes, "onexit")
+	}
+	if !equalMetadata(oldFSM.stateMetadata[state], newFSM.stateMetadata[state]) {
+		changes = append(changes, "metadata")
+	}
+	return
+}
+
+func diffTransition(from, to Transition) (changes []string) {
+	if from.Target != to.Target {
+		changes = append(changes, "target")
+	}
+	if from.Kind != to.Kind {
+		changes = append(changes, "kind")
+	}
+	if hookName(from.Guard != nil, from.GuardName) != hookName(to.Guard != nil, to.GuardName) {
+		changes = append(changes, "guard")
+	}
+	if hookName(from.Action != nil, from.ActionName) != hookName(to.Action != nil, to.ActionName) {
+		changes = append(changes, "action")
+	}
+	if !equalMetadata(from.Metadata, to.Metadata) {
+		changes = append(changes, "metadata")
+	}
+	return
+}
+
+func branchesLabel(branches []Branch) string {
+	var buf bytes.Buffer
+	for _, b := range branches {
+		fmt.Fprintf(&buf, "%s%s->%s;", b.Label(), hookName(b.Guard != nil, b.GuardName), b.Target)
+	}
+	return buf.String()
+}
+
+func equalMetadata(m1, m2 map[string]string) bool {
+	if len(m1) != len(m2) {
+		return false
+	}
+	for key, value := range m1 {
+		if v, ok := m2[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// events returns the sorted events of all the transitions.
+func (f *FSM) events() []Event {
+	events := make([]Event, 0, len(f.transitions))
+	for _, t := range f.transitions {
+		if !hasEvent(events, t.Event) {
+			events = append(events, t.Event)
+		}
+	}
+	sort.Sort(sortedEvents(events))
+	return events
+}
+
+// IsEmpty reports whether there is no difference.
+func (d Difference) IsEmpty() bool {
+	return len(d.AddedStates) == 0 && len(d.RemovedStates) == 0 &&
+		len(d.ChangedStates) == 0 && len(d.AddedEvents) == 0 &&
+		len(d.RemovedEvents) == 0 && len(d.AddedTransitions) == 0 &&
+		len(d.RemovedTransitions) == 0 && len(d.ChangedTransitions) == 0 &&
+		len(d.NewlyUnreachable) == 0
+}
+
+// String returns the text report of the difference, each line of which
+// starts with "+" for the added, "-" for the removed, "~" for the changed,
+// and "!" for the newly unreachable.
+func (d Difference) String() string {
+	var buf bytes.Buffer
+	for _, state := range d.AddedStates {
+		fmt.Fprintf(&buf, "+ state %s\n", state)
+	}
+	for _, state := range d.RemovedStates {
+		fmt.Fprintf(&buf, "- state %s\n", state)
+	}
+	for _, c := range d.ChangedStates {
+		fmt.Fprintf(&buf, "~ state %s: %s\n", c.State, strings.Join(c.Changes, ", "))
+	}
+	for _, event := range d.AddedEvents {
+		fmt.Fprintf(&buf, "+ event %s\n", event)
+	}
+	for _, event := range d.RemovedEvents {
+		fmt.Fprintf(&buf, "- event %s\n", event)
+	}
+	for _, t := range d.AddedTransitions {
+		fmt.Fprintf(&buf, "+ transition %s --%s--> %s\n", t.Source, t.Event, t.Target)
+	}
+	for _, t := range d.RemovedTransitions {
+		fmt.Fprintf(&buf, "- transition %s --%s--> %s\n", t.Source, t.Event, t.Target)
+	}
+	for _, c := range d.ChangedTransitions {
+		fmt.Fprintf(&buf, "~ transition %s --%s--> %s: %s\n", c.New.Source, c.New.Event,
+			c.New.Target, strings.Join(c.Changes, ", "))
+	}
+	for _, state := range d.NewlyUnreachable {
+		fmt.Fprintf(&buf, "! unreachable %s\n", state)
+	}
+	return buf.String()
+}
+
+type diffStatus uint8
+
+const (
+	diffUnchanged diffStatus = iota
+	diffAdded
+	diffRemoved
+	diffChanged
+)
+
+func (s diffStatus) color() string {
+	switch s {
+	case diffAdded:
+		return DiffAddedColor
+	case diffRemoved:
+		return DiffRemovedColor
+	case diffChanged:
+		return DiffChangedColor
+	default:
+		return ""
+	}
+}
+
+type diffEdge struct {
+	Source State
+	Target State
+	Label  string
+	Status diffStatus
+}
+
+type diffNode struct {
+	State  State
+	Pseudo bool
+	Status diffStatus
+}
+
+// machines returns the old and new state machines, which are the empty ones
+// if nil, such as the zero value of Difference.
+func (d Difference) machines() (oldFSM, newFSM *FSM) {
+	if oldFSM = d.old; oldFSM == nil {
+		oldFSM = New()
+	}
+	if newFSM = d.new; newFSM == nil {
+		newFSM = New()
+	}
+	return
+}
+
+// graph returns the union of the states and the edges of the state machines.
+func (d Difference) graph() (nodes []diffNode, edges []diffEdge) {
+	d.old, d.new = d.machines()
+	states := append(d.new.validateStates(), d.RemovedStates...)
+	sortStates(states)
+
+	for _, state := range states {
+		node := diffNode{State: state, Pseudo: d.new.IsPseudo(state)}
+		switch {
+		case hasState(d.AddedStates, state):
+			node.Status = diffAdded
+		case hasState(d.RemovedStates, state):
+			node.Status, node.Pseudo = diffRemoved, d.old.IsPseudo(state)
+		default:
+			for _, c := range d.ChangedStates {
+				if c.State == state {
+					node.Status = diffChanged
+					break
+				}
+			}
+		}
+		nodes = append(nodes, node)
+	}
+
+	for _, t := range cloneAndSortTransitions(d.new.transitions) {
+		edge := diffEdge{Source: t.Source, Target: t.Target, Label: string(t.Event)}
+		old, ok := d.old.GetTransition(t.Source, t.Event)
+		changes := diffTransition(old, t)
+		switch {
+		case !ok:
+			edge.Status = diffAdded
+
+		case old.Target != t.Target:
+			// Retargeted: draw the removed old edge and the added new edge.
+			edges = append(edges, diffEdge{Source: old.Source, Target: old.Target,
+				Label: string(old.Event), Status: diffRemoved})
+			edge.Status = diffAdded
+
+		case len(changes) > 0:
+			edge.Status = diffChanged
+			edge.Label = fmt.Sprintf("%s (%s)", t.Event, strings.Join(changes, ", "))
+		}
+		edges = append(edges, edge)
+	}
+	for _, t := range d.RemovedTransitions {
+		edges = append(edges, diffEdge{Source: t.Source, Target: t.Target,
+			Label: string(t.Event), Status: diffRemoved})
+	}
+
+	oldBranches, newBranches := d.old.branchEdges(), d.new.branchEdges()
+	for _, e := range newBranches {
+		if !hasDiffEdge(oldBranches, e) {
+			e.Status = diffAdded
+		}
+		edges = append(edges, e)
+	}
+	for _, e := range oldBranches {
+		if !hasDiffEdge(newBranches, e) {
+			e.Status = diffRemoved
+			edges = append(edges, e)
+		}
+	}
+
+	return
+}
+
+func (f *FSM) branchEdges() (edges []diffEdge) {
+	for _, state := range f.Pseudos() {
+		for _, b := range f.pseudos[state].branches {
+			edges = append(edges, diffEdge{Source: state, Target: b.Target, Label: b.Label()})
+		}
+	}
+	return
+}
+
+func hasDiffEdge(edges []diffEdge, edge diffEdge) bool {
+	for _, e := range edges {
+		if e.Source == edge.Source && e.Target == edge.Target && e.Label == edge.Label {
+			return true
+		}
+	}
+	return false
+}
+
+// VisualizeGraphviz outputs a visualization of the difference in Graphviz
+// format, which colors the added elements with DiffAddedColor, the removed
+// elements with DiffRemovedColor, and the changed ones with DiffChangedColor.
+func (d Difference) VisualizeGraphviz() string {
+	nodes, edges := d.graph()
+
+	var buf bytes.Buffer
+	buf.Grow(256)
+
+	writeHeaderLine(&buf, "")
+	for _, e := range edges {
+		fmt.Fprintf(&buf, `    "%s" -> "%s" [ label = "%s"`, escapeGraphviz(string(e.Source)),
+			escapeGraphviz(string(e.Target)), escapeGraphviz(e.Label))
+		if color := e.Status.color(); color != "" {
+			fmt.Fprintf(&buf, `, color = "%s", fontcolor = "%s"`, color, color)
+		}
+		if e.Status == diffRemoved {
+			buf.WriteString(`, style = "dashed"`)
+		}
+		buf.WriteString(" ];\n")
+	}
+
+	buf.WriteString("\n")
+	for _, n := range nodes {
+		var attrs []string
+		if n.Pseudo {
+			attrs = append(attrs, "shape = diamond")
+		}
+		if color := n.Status.color(); color != "" {
+			attrs = append(attrs, fmt.Sprintf(`color = "%s", fontcolor = "%s"`, color, color))
+		}
+		if n.Status == diffRemoved {
+			attrs = append(attrs, `style = "dashed"`)
+		}
+
+		if len(attrs) == 0 {
+			fmt.Fprintf(&buf, `    "%s";`+"\n", escapeGraphviz(string(n.State)))
+		} else {
+			fmt.Fprintf(&buf, `    "%s" [ %s ];`+"\n", escapeGraphviz(string(n.State)), strings.Join(attrs, ", "))
+		}
+	}
+	writeFooter(&buf)
+
+	return buf.String()
+}
+
+// VisualizeMermaidFlowChart outputs a visualization of the difference
+// in MermaidFlowChart format, which colors the added elements with
+// DiffAddedColor, the removed elements with DiffRemovedColor, and
+// the changed ones with DiffChangedColor.
+func (d Difference) VisualizeMermaidFlowChart() string {
+	nodes, edges := d.graph()
+
+	var buf bytes.Buffer
+	buf.Grow(256)
+
+	ids := make(map[State]string, len(nodes))
+	for i, n := range nodes {
+		ids[n.State] = fmt.Sprintf("id%d", i)
+	}
+
+	writeFlowChartGraphType(&buf, "")
+	for _, n := range nodes {
+		if n.Pseudo {
+			fmt.Fprintf(&buf, `    %s{%s}`+"\n", ids[n.State], mermaidNodeText(string(n.State)))
+		} else {
+			fmt.Fprintf(&buf, `    %s[%s]`+"\n", ids[n.State], mermaidNodeText(string(n.State)))
+		}
+	}
+	buf.WriteString("\n")
+
+	for _, e := range edges {
+		arrow := "-->"
+		if e.Status == diffRemoved {
+			arrow = "-.->"
+		}
+
+		if e.Label == "" {
+			fmt.Fprintf(&buf, `    %s %s %s`+"\n", ids[e.Source], arrow, ids[e.Target])
+		} else {
+			fmt.Fprintf(&buf, `    %s %s |%s| %s`+"\n", ids[e.Source], arrow, escapeMermaid(e.Label), ids[e.Target])
+		}
+	}
+	buf.WriteString("\n")
+
+	for _, n := range nodes {
+		if color := n.Status.color(); color != "" {
+			fmt.Fprintf(&buf, `    style %s stroke:%s,color:%s`+"\n", ids[n.State], color, color)
+		}
+	}
+	for i, e := range edges {
+		if color := e.Status.color(); color != "" {
+			fmt.Fprintf(&buf, `    linkStyle %d stroke:%s,color:%s`+"\n", i, color, color)
+		}
+	}
+
+	return buf.String()
+}
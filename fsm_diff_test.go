@@ -0,0 +1,51 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDifferenceZeroValue(t *testing.T) {
+	var d Difference
+	if !d.IsEmpty() {
+		t.Error("expect the empty difference")
+	}
+	if s := d.VisualizeGraphviz(); !strings.HasPrefix(s, "digraph") {
+		t.Errorf("unexpected Graphviz output: %s", s)
+	}
+	if s := d.VisualizeMermaidFlowChart(); s == "" {
+		t.Error("expect the Mermaid flowchart, but got nothing")
+	}
+	_ = d.String()
+}
+
+func TestDiffNil(t *testing.T) {
+	fsm := New()
+	fsm.SetInitial("A")
+	fsm.AddTransitions(Source("A").WithTarget("B").WithEvent("Next"))
+
+	d := Diff(nil, fsm)
+	if len(d.AddedStates) != 2 || len(d.AddedTransitions) != 1 {
+		t.Errorf("expect all states and transitions added, but got %+v", d)
+	}
+	_ = d.VisualizeGraphviz()
+
+	if d = Diff(fsm, nil); len(d.RemovedStates) != 2 || len(d.RemovedTransitions) != 1 {
+		t.Errorf("expect all states and transitions removed, but got %+v", d)
+	}
+	_ = d.VisualizeMermaidFlowChart()
+}
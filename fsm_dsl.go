@@ -0,0 +1,996 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FormatDSL is the compact textual definition format, for example,
+//
+//	# The comment line starts with "#" or "%%".
+//	machine order
+//	version 2
+//	initial Pending
+//	final Approved, Rejected
+//	meta owner = "product"
+//
+//	state Pending {
+//	    enter logState
+//	    exit logState
+//	    meta note = "waiting for the review"
+//	    on Remind[canRemind]/remind   # The internal transition
+//	    reenter Restart               # The reentrant transition
+//	}
+//
+//	choice Check {                    # Or, junction Check { ... }
+//	    [isPassed] --> Approved
+//	    else --> Rejected
+//	}
+//
+//	Pending --Review[canReview]/review--> Check { priority = "high" }
+//	Pending --Cancel--> Rejected
+//	Pending --Touch-->                # No target is the internal transition
+//
+// The name may be quoted as the Go string literal, such as "Foo Bar".
+//
+// It also accepts the Mermaid state diagram statements, such as the output
+// of VisualizeMermaidStateDiagram, but ignores the front matter, the direction
+// and the styles, such as the output of VisualizeMermaidStateDiagramWith.
+// The label "Event [guard] / action", output with the options ShowGuards
+// and ShowActions, is parsed as the event with the guard and the action:
+//
+//	stateDiagram-v2
+//	    state "In Review" as s0
+//	    state Check <<choice>>
+//	    [*] --> Pending
+//	    Pending --> Check: Review
+//	    Check --> Approved: [isPassed]
+//	    Check --> Rejected: [else]
+//	    Pending : Remind
+//	    Approved --> [*]
+const FormatDSL = "dsl"
+
+// SyntaxError is the error to parse the DSL, which has the position.
+type SyntaxError struct {
+	Line   int // Starting at 1
+	Column int // Starting at 1, which is counted by the character
+	Msg    string
+}
+
+func (e SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// ParseDSL parses the textual DSL into the definition.
+//
+// See FormatDSL.
+func ParseDSL(r io.Reader) (def Definition, err error) {
+	p := dslParser{def: &def}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		p.line++
+		if err = p.parseLine(scanner.Text()); err != nil {
+			return
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return
+	}
+
+	if p.block != "" {
+		const format = "the %s block '%s' at line %d is not closed"
+		return def, SyntaxError{Line: p.line, Column: p.endColumn(),
+			Msg: fmt.Sprintf(format, p.block, p.name, p.start)}
+	}
+
+	err = p.finish()
+	return
+}
+
+const (
+	tokenIdent = iota + 1
+	tokenString
+	tokenPunct
+)
+
+type dslToken struct {
+	kind   int
+	text   string // The unquoted text for tokenString.
+	offset int    // The byte offset in the line.
+	column int
+}
+
+var dslPuncts = []string{"-->", "--", "<<", ">>", "[", "]", "/", "{", "}", ",", "=", ":", "*"}
+
+func isDSLIdentRune(r rune) bool {
+	return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func tokenizeDSL(line string, lineno int) (tokens []dslToken, err error) {
+	for offset := 0; offset < len(line); {
+		r, size := utf8.DecodeRuneInString(line[offset:])
+		column := utf8.RuneCountInString(line[:offset]) + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			offset += size
+			continue
+
+		case r == '#' || strings.HasPrefix(line[offset:], "%%"):
+			return
+
+		case r == '"':
+			end := offset + 1
+			for ; end < len(line); end++ {
+				if line[end] == '\\' {
+					end++
+				} else if line[end] == '"' {
+					break
+				}
+			}
+			if end >= len(line) {
+				return nil, SyntaxError{Line: lineno, Column: column, Msg: "unterminated string"}
+			}
+
+			text, err := strconv.Unquote(line[offset : end+1])
+			if err != nil {
+				return nil, SyntaxError{Line: lineno, Column: column, Msg: "invalid string: " + err.Error()}
+			}
+
+			tokens = append(tokens, dslToken{kind: tokenString, text: text, offset: offset, column: column})
+			offset = end + 1
+			continue
+
+		case isDSLIdentRune(r):
+			end := offset
+			for end < len(line) {
+				r, size := utf8.DecodeRuneInString(line[end:])
+				if !isDSLIdentRune(r) {
+					break
+				}
+				end += size
+			}
+
+			tokens = append(tokens, dslToken{kind: tokenIdent, text: line[offset:end], offset: offset, column: column})
+			offset = end
+			continue
+		}
+
+		var punct string
+		for _, p := range dslPuncts {
+			if strings.HasPrefix(line[offset:], p) {
+				punct = p
+				break
+			}
+		}
+
+		if punct == "" {
+			return nil, SyntaxError{Line: lineno, Column: column, Msg: fmt.Sprintf("unexpected character %q", r)}
+		}
+
+		tokens = append(tokens, dslToken{kind: tokenPunct, text: punct, offset: offset, column: column})
+		if punct == ":" {
+			return // The rest is the raw label of the Mermaid edge.
+		}
+		offset += len(punct)
+	}
+
+	return
+}
+
+type dslEdge struct {
+	source, target State
+	label          string
+	line, column   int
+}
+
+type dslParser struct {
+	def    *Definition
+	text   string
+	line   int
+	tokens []dslToken
+	pos    int
+
+	block string // "state", "choice" or "junction"
+	name  State
+	start int // The line of the beginning of the block.
+
+	edges   []dslEdge       // The Mermaid edges with the label.
+	aliases map[State]State // The Mermaid state ids to the state names.
+	mermaid bool            // Whether it is the Mermaid state diagram.
+	front   bool            // Whether it is in the Mermaid front matter.
+}
+
+func (p *dslParser) errorf(column int, format string, args ...interface{}) error {
+	return SyntaxError{Line: p.line, Column: column, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *dslParser) peek() (t dslToken, ok bool) {
+	if p.pos < len(p.tokens) {
+		t, ok = p.tokens[p.pos], true
+	}
+	return
+}
+
+func (p *dslParser) next() (t dslToken, ok bool) {
+	if t, ok = p.peek(); ok {
+		p.pos++
+	}
+	return
+}
+
+func (p *dslParser) endColumn() int {
+	return utf8.RuneCountInString(p.text) + 1
+}
+
+func (p *dslParser) isPunct(text string) bool {
+	t, ok := p.peek()
+	return ok && t.kind == tokenPunct && t.text == text
+}
+
+func (p *dslParser) isIdent(text string) bool {
+	t, ok := p.peek()
+	return ok && t.kind == tokenIdent && t.text == text
+}
+
+func (p *dslParser) expectPunct(text string) error {
+	t, ok := p.next()
+	if !ok {
+		return p.errorf(p.endColumn(), "expect '%s', but got the end of line", text)
+	} else if t.kind != tokenPunct || t.text != text {
+		return p.errorf(t.column, "expect '%s', but got '%s'", text, t.text)
+	}
+	return nil
+}
+
+func (p *dslParser) expectName(what string) (string, error) {
+	t, ok := p.next()
+	if !ok {
+		return "", p.errorf(p.endColumn(), "expect the %s, but got the end of line", what)
+	} else if t.kind == tokenPunct {
+		return "", p.errorf(t.column, "expect the %s, but got '%s'", what, t.text)
+	}
+	return t.text, nil
+}
+
+func (p *dslParser) expectEnd() error {
+	if t, ok := p.peek(); ok {
+		return p.errorf(t.column, "unexpected '%s'", t.text)
+	}
+	return nil
+}
+
+func (p *dslParser) parseLine(line string) (err error) {
+	switch trimmed := strings.TrimSpace(line); {
+	case p.front:
+		p.front = trimmed != "---"
+		return // Ignore the front matter of the Mermaid state diagram.
+
+	case p.line == 1 && trimmed == "---":
+		p.front = true
+		return
+
+	case p.block == "" && (trimmed == "stateDiagram" || trimmed == "stateDiagram-v2"):
+		p.mermaid = true
+		return // Ignore the header of the Mermaid state diagram.
+
+	case p.mermaid && p.block == "":
+		if fields := strings.Fields(trimmed); len(fields) > 0 &&
+			hasString(mermaidStyleKeywords, fields[0]) {
+			return // Ignore the direction and the styles of the Mermaid state diagram.
+		}
+	}
+
+	p.text, p.pos = line, 0
+	if p.tokens, err = tokenizeDSL(line, p.line); err != nil || len(p.tokens) == 0 {
+		return
+	}
+
+	if p.isPunct("}") {
+		if p.block == "" {
+			return p.errorf(p.tokens[0].column, "unexpected '}'")
+		}
+		p.next()
+		p.block, p.name = "", ""
+		return p.expectEnd()
+	}
+
+	switch p.block {
+	case "state":
+		return p.parseStateStmt()
+	case "choice", "junction":
+		return p.parsePseudoStmt()
+	default:
+		return p.parseStmt()
+	}
+}
+
+func (p *dslParser) parseStmt() (err error) {
+	first := p.tokens[0]
+	if first.kind == tokenIdent && len(p.tokens) > 1 {
+		if second := p.tokens[1]; second.kind != tokenPunct ||
+			(second.text != "--" && second.text != "-->" && second.text != ":") {
+			switch first.text {
+			case "machine":
+				p.next()
+				p.def.Name, err = p.expectName("machine name")
+				if err == nil {
+					err = p.expectEnd()
+				}
+				return
+
+			case "version":
+				p.next()
+				t, _ := p.peek()
+				var version string
+				if version, err = p.expectName("version"); err == nil {
+					if p.def.Version, err = strconv.Atoi(version); err != nil {
+						return p.errorf(t.column, "invalid version '%s'", version)
+					}
+					err = p.expectEnd()
+				}
+				return
+
+			case "initial":
+				p.next()
+				var initial string
+				if initial, err = p.expectName("initial state"); err == nil {
+					p.def.Initial = State(initial)
+					err = p.expectEnd()
+				}
+				return
+
+			case "final":
+				p.next()
+				return p.parseFinals()
+
+			case "meta":
+				p.next()
+				return p.parseMeta(&p.def.Metadata)
+
+			case "state":
+				p.next()
+				return p.parseStateDecl()
+
+			case "choice", "junction":
+				p.next()
+				return p.parsePseudoDecl(first.text)
+			}
+		}
+	}
+
+	return p.parseEdge()
+}
+
+func (p *dslParser) parseFinals() error {
+	for {
+		final, err := p.expectName("final state")
+		if err != nil {
+			return err
+		}
+
+		if !hasState(p.def.Finals, State(final)) {
+			p.def.Finals = append(p.def.Finals, State(final))
+		}
+
+		if _, ok := p.peek(); !ok {
+			return nil
+		} else if err = p.expectPunct(","); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *dslParser) parseMeta(metadata *map[string]string) error {
+	key, err := p.expectName("metadata key")
+	if err != nil {
+		return err
+	} else if err = p.expectPunct("="); err != nil {
+		return err
+	}
+
+	value, err := p.expectName("metadata value")
+	if err != nil {
+		return err
+	}
+
+	if *metadata == nil {
+		*metadata = make(map[string]string, 4)
+	}
+	(*metadata)[key] = value
+	return p.expectEnd()
+}
+
+// parseMetaBlock parses the optional "{ key = value, ... }".
+func (p *dslParser) parseMetaBlock() (metadata map[string]string, err error) {
+	if !p.isPunct("{") {
+		return
+	}
+
+	p.next()
+	metadata = make(map[string]string, 4)
+	for !p.isPunct("}") {
+		var key, value string
+		if key, err = p.expectName("metadata key"); err != nil {
+			return
+		} else if err = p.expectPunct("="); err != nil {
+			return
+		} else if value, err = p.expectName("metadata value"); err != nil {
+			return
+		}
+
+		metadata[key] = value
+		if p.isPunct(",") {
+			p.next()
+		} else if !p.isPunct("}") {
+			err = p.expectPunct("}")
+			return
+		}
+	}
+	p.next()
+
+	return
+}
+
+func (p *dslParser) parseStateDecl() (err error) {
+	name, err := p.expectName("state name")
+	if err != nil {
+		return
+	}
+
+	switch {
+	case p.isPunct("{"):
+		p.next()
+		p.block, p.name, p.start = "state", State(name), p.line
+
+	case p.isIdent("as"): // Mermaid: state "Foo Bar" as s0
+		p.next()
+		var id string
+		if id, err = p.expectName("state id"); err != nil {
+			return
+		}
+
+		if p.aliases == nil {
+			p.aliases = make(map[State]State, 8)
+		}
+		p.aliases[State(id)] = State(unescapeMermaid(name))
+
+	case p.isPunct("<<"): // Mermaid: state Check <<choice>>
+		p.next()
+		var kind string
+		if kind, err = p.expectName("pseudo state kind"); err != nil {
+			return
+		} else if err = p.expectPunct(">>"); err != nil {
+			return
+		}
+
+		var pkind PseudoKind
+		if err = pkind.UnmarshalText([]byte(kind)); err != nil {
+			return p.errorf(p.tokens[p.pos-2].column, "%v", err)
+		}
+		p.def.Pseudos = append(p.def.Pseudos, PseudoDefinition{Name: State(name), Kind: pkind})
+	}
+
+	return p.expectEnd()
+}
+
+func (p *dslParser) parsePseudoDecl(kind string) (err error) {
+	name, err := p.expectName(kind + " name")
+	if err != nil {
+		return
+	} else if err = p.expectPunct("{"); err != nil {
+		return
+	}
+
+	pkind := Choice
+	if kind == "junction" {
+		pkind = Junction
+	}
+
+	p.block, p.name, p.start = kind, State(name), p.line
+	p.def.Pseudos = append(p.def.Pseudos, PseudoDefinition{Name: State(name), Kind: pkind})
+	return p.expectEnd()
+}
+
+func (p *dslParser) stateDefinition() *StateDefinition {
+	for i := range p.def.States {
+		if p.def.States[i].Name == p.name {
+			return &p.def.States[i]
+		}
+	}
+
+	p.def.States = append(p.def.States, StateDefinition{Name: p.name})
+	return &p.def.States[len(p.def.States)-1]
+}
+
+func (p *dslParser) parseStateStmt() (err error) {
+	keyword, _ := p.next()
+	if keyword.kind != tokenIdent {
+		return p.errorf(keyword.column, "unexpected '%s' in the state block", keyword.text)
+	}
+
+	switch keyword.text {
+	case "enter", "exit":
+		var name string
+		if name, err = p.expectName("hook name"); err != nil {
+			return
+		}
+
+		if s := p.stateDefinition(); keyword.text == "enter" {
+			s.OnEnter = name
+		} else {
+			s.OnExit = name
+		}
+		return p.expectEnd()
+
+	case "meta":
+		return p.parseMeta(&p.stateDefinition().Metadata)
+
+	case "on", "reenter":
+		t := TransitionDefinition{Source: p.name, Kind: Internal}
+		if keyword.text == "reenter" {
+			t.Kind = Reentrant
+		}
+
+		var event string
+		if event, err = p.expectName("event"); err != nil {
+			return
+		}
+
+		t.Event = Event(event)
+		if t.Guard, t.Action, err = p.parseGuardAction(); err != nil {
+			return
+		} else if t.Metadata, err = p.parseMetaBlock(); err != nil {
+			return
+		}
+
+		p.def.Transitions = append(p.def.Transitions, t)
+		return p.expectEnd()
+
+	default:
+		return p.errorf(keyword.column, "unknown statement '%s' in the state block", keyword.text)
+	}
+}
+
+func (p *dslParser) parsePseudoStmt() (err error) {
+	var guard string
+	if t, _ := p.peek(); t.kind == tokenIdent && t.text == "else" {
+		p.next()
+	} else if err = p.expectPunct("["); err != nil {
+		return
+	} else if guard, err = p.expectName("guard name"); err != nil {
+		return
+	} else if err = p.expectPunct("]"); err != nil {
+		return
+	}
+
+	if err = p.expectPunct("-->"); err != nil {
+		return
+	}
+
+	target, err := p.expectName("branch target")
+	if err != nil {
+		return
+	}
+
+	pseudo := &p.def.Pseudos[len(p.def.Pseudos)-1]
+	pseudo.Branches = append(pseudo.Branches, BranchDefinition{Target: State(target), Guard: guard})
+	return p.expectEnd()
+}
+
+// parseGuardAction parses the optional "[guard]/action".
+func (p *dslParser) parseGuardAction() (guard, action string, err error) {
+	if p.isPunct("[") {
+		p.next()
+		if guard, err = p.expectName("guard name"); err != nil {
+			return
+		} else if err = p.expectPunct("]"); err != nil {
+			return
+		}
+	}
+
+	if p.isPunct("/") {
+		p.next()
+		action, err = p.expectName("action name")
+	}
+
+	return
+}
+
+// parseStateRef parses the state name or the Mermaid "[*]".
+func (p *dslParser) parseStateRef(what string) (state State, star bool, err error) {
+	if p.isPunct("[") {
+		p.next()
+		if err = p.expectPunct("*"); err == nil {
+			err = p.expectPunct("]")
+		}
+		return "", true, err
+	}
+
+	name, err := p.expectName(what)
+	return State(name), false, err
+}
+
+func (p *dslParser) parseEdge() (err error) {
+	first, _ := p.peek()
+	source, sourceStar, err := p.parseStateRef("source state")
+	if err != nil {
+		return
+	}
+
+	if p.isPunct(":") { // Mermaid: "State : Event", that's, the internal transition.
+		if sourceStar {
+			return p.errorf(first.column, "unexpected '[*]'")
+		}
+
+		colon, _ := p.next()
+		label := unescapeMermaid(strings.TrimSpace(p.text[colon.offset+1:]))
+		event, guard, action := splitMermaidLabel(label)
+		if event == "" {
+			return p.errorf(p.endColumn(), "expect the event, but got the end of line")
+		}
+
+		p.def.Transitions = append(p.def.Transitions, TransitionDefinition{
+			Event: Event(event), Source: source, Kind: Internal, Guard: guard, Action: action})
+		return
+	}
+
+	if p.isPunct("-->") { // Mermaid: "Source --> Target: Event"
+		p.next()
+		target, targetStar, err := p.parseStateRef("target state")
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case sourceStar && targetStar:
+			return p.errorf(first.column, "unexpected '[*] --> [*]'")
+		case sourceStar:
+			p.def.Initial = target
+			return p.expectEnd()
+		case targetStar:
+			if !hasState(p.def.Finals, source) {
+				p.def.Finals = append(p.def.Finals, source)
+			}
+			return p.expectEnd()
+		}
+
+		var label string
+		if p.isPunct(":") {
+			colon, _ := p.next()
+			label = unescapeMermaid(strings.TrimSpace(p.text[colon.offset+1:]))
+		} else if err = p.expectEnd(); err != nil {
+			return err
+		}
+
+		p.edges = append(p.edges, dslEdge{source: source, target: target,
+			label: label, line: p.line, column: first.column})
+		return nil
+	}
+
+	if sourceStar {
+		return p.errorf(first.column, "unexpected '[*]'")
+	}
+
+	// Source --Event[guard]/action--> Target { key = value }
+	t := TransitionDefinition{Source: source}
+	if err = p.expectPunct("--"); err != nil {
+		return
+	}
+
+	event, err := p.expectName("event")
+	if err != nil {
+		return
+	}
+
+	t.Event = Event(event)
+	if t.Guard, t.Action, err = p.parseGuardAction(); err != nil {
+		return
+	} else if err = p.expectPunct("-->"); err != nil {
+		return
+	}
+
+	if next, ok := p.peek(); ok && next.kind != tokenPunct {
+		p.next()
+		t.Target = State(next.text)
+	} else {
+		t.Kind = Internal
+	}
+
+	if t.Metadata, err = p.parseMetaBlock(); err != nil {
+		return
+	}
+
+	p.def.Transitions = append(p.def.Transitions, t)
+	return p.expectEnd()
+}
+
+// mermaidStyleKeywords is the keywords of the Mermaid statements
+// which only change the layout or the styles of the diagram.
+var mermaidStyleKeywords = []string{"direction", "classDef", "class", "style"}
+
+// finish resolves the Mermaid edges, which are either the transitions,
+// or the branches of the pseudo states.
+func (p *dslParser) finish() error {
+	for _, e := range p.edges {
+		var pseudo *PseudoDefinition
+		for i := range p.def.Pseudos {
+			if p.def.Pseudos[i].Name == e.source {
+				pseudo = &p.def.Pseudos[i]
+				break
+			}
+		}
+
+		if pseudo != nil {
+			b := BranchDefinition{Target: e.target}
+			switch {
+			case e.label == "", e.label == "[else]":
+			case strings.HasPrefix(e.label, "[") && strings.HasSuffix(e.label, "]"):
+				b.Guard = strings.TrimSpace(e.label[1 : len(e.label)-1])
+			default:
+				return SyntaxError{Line: e.line, Column: e.column,
+					Msg: fmt.Sprintf("invalid branch label '%s' of the pseudo state '%s'", e.label, e.source)}
+			}
+
+			pseudo.Branches = append(pseudo.Branches, b)
+			continue
+		}
+
+		event, guard, action := splitMermaidLabel(e.label)
+		if event == "" {
+			return SyntaxError{Line: e.line, Column: e.column,
+				Msg: fmt.Sprintf("the transition from '%s' to '%s' has no event", e.source, e.target)}
+		}
+
+		p.def.Transitions = append(p.def.Transitions, TransitionDefinition{
+			Event: Event(event), Source: e.source, Target: e.target, Guard: guard, Action: action})
+	}
+
+	p.resolveAliases()
+	return nil
+}
+
+// splitMermaidLabel splits the Mermaid transition label, which may contain
+// the guard and the action, such as "Event [guard] / action" output with
+// VisualizeOptions.ShowGuards and ShowActions. The unnamed hook shown as "?"
+// is ignored.
+func splitMermaidLabel(label string) (event, guard, action string) {
+	if i := strings.LastIndex(label, " / "); i > -1 {
+		label, action = label[:i], strings.TrimSpace(label[i+3:])
+	}
+	if strings.HasSuffix(label, "]") {
+		if i := strings.LastIndex(label, " ["); i > -1 {
+			label, guard = label[:i], strings.TrimSpace(label[i+2:len(label)-1])
+		}
+	}
+
+	if guard == "?" {
+		guard = ""
+	}
+	if action == "?" {
+		action = ""
+	}
+	return strings.TrimSpace(label), guard, action
+}
+
+// resolveAliases replaces the Mermaid state ids with the state names.
+func (p *dslParser) resolveAliases() {
+	if len(p.aliases) == 0 {
+		return
+	}
+
+	resolve := func(state *State) {
+		if name, ok := p.aliases[*state]; ok {
+			*state = name
+		}
+	}
+
+	resolve(&p.def.Initial)
+	for i := range p.def.Finals {
+		resolve(&p.def.Finals[i])
+	}
+	for i := range p.def.States {
+		resolve(&p.def.States[i].Name)
+	}
+	for i := range p.def.Pseudos {
+		resolve(&p.def.Pseudos[i].Name)
+		for j := range p.def.Pseudos[i].Branches {
+			resolve(&p.def.Pseudos[i].Branches[j].Target)
+		}
+	}
+	for i := range p.def.Transitions {
+		resolve(&p.def.Transitions[i].Source)
+		resolve(&p.def.Transitions[i].Target)
+	}
+}
+
+// MarshalDSL marshals the definition to the textual DSL.
+//
+// See FormatDSL.
+func MarshalDSL(def Definition) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(1024)
+
+	if def.Name != "" {
+		fmt.Fprintf(&buf, "machine %s\n", quoteDSLName(def.Name))
+	}
+	if def.Version != 0 {
+		fmt.Fprintf(&buf, "version %d\n", def.Version)
+	}
+	if def.Initial != "" {
+		fmt.Fprintf(&buf, "initial %s\n", quoteDSLName(string(def.Initial)))
+	}
+	if len(def.Finals) > 0 {
+		finals := make([]string, len(def.Finals))
+		for i, state := range def.Finals {
+			finals[i] = quoteDSLName(string(state))
+		}
+		fmt.Fprintf(&buf, "final %s\n", strings.Join(finals, ", "))
+	}
+	writeDSLMetadata(&buf, "", def.Metadata)
+
+	var internals []TransitionDefinition
+	for _, t := range def.Transitions {
+		if t.Kind != External {
+			internals = append(internals, t)
+		}
+	}
+
+	states := make([]State, 0, len(def.States)+len(internals))
+	blocks := make(map[State]StateDefinition, len(def.States))
+	for _, s := range def.States {
+		states = append(states, s.Name)
+		blocks[s.Name] = s
+	}
+	for _, t := range internals {
+		if !hasState(states, t.Source) {
+			states = append(states, t.Source)
+		}
+	}
+
+	for _, state := range states {
+		s := blocks[state]
+		fmt.Fprintf(&buf, "\nstate %s {\n", quoteDSLName(string(state)))
+		if s.OnEnter != "" {
+			fmt.Fprintf(&buf, "    enter %s\n", quoteDSLName(s.OnEnter))
+		}
+		if s.OnExit != "" {
+			fmt.Fprintf(&buf, "    exit %s\n", quoteDSLName(s.OnExit))
+		}
+		writeDSLMetadata(&buf, "    ", s.Metadata)
+
+		for _, t := range internals {
+			if t.Source != state {
+				continue
+			}
+
+			keyword := "on"
+			if t.Kind == Reentrant {
+				keyword = "reenter"
+			}
+
+			fmt.Fprintf(&buf, "    %s %s%s", keyword, quoteDSLName(string(t.Event)),
+				formatDSLGuardAction(t.Guard, t.Action))
+			writeDSLMetadataBlock(&buf, t.Metadata)
+			buf.WriteByte('\n')
+		}
+		buf.WriteString("}\n")
+	}
+
+	for _, p := range def.Pseudos {
+		kind := Choice.String()
+		if p.Kind == Junction {
+			kind = Junction.String()
+		}
+
+		fmt.Fprintf(&buf, "\n%s %s {\n", kind, quoteDSLName(string(p.Name)))
+		for _, b := range p.Branches {
+			if b.Guard == "" {
+				fmt.Fprintf(&buf, "    else --> %s\n", quoteDSLName(string(b.Target)))
+			} else {
+				fmt.Fprintf(&buf, "    [%s] --> %s\n", quoteDSLName(b.Guard), quoteDSLName(string(b.Target)))
+			}
+		}
+		buf.WriteString("}\n")
+	}
+
+	var newline bool
+	for _, t := range def.Transitions {
+		if t.Kind != External {
+			continue
+		}
+
+		if !newline {
+			buf.WriteByte('\n')
+			newline = true
+		}
+
+		fmt.Fprintf(&buf, "%s --%s%s--> %s", quoteDSLName(string(t.Source)),
+			quoteDSLName(string(t.Event)), formatDSLGuardAction(t.Guard, t.Action),
+			quoteDSLName(string(t.Target)))
+		writeDSLMetadataBlock(&buf, t.Metadata)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
+func formatDSLGuardAction(guard, action string) (s string) {
+	if guard != "" {
+		s = "[" + quoteDSLName(guard) + "]"
+	}
+	if action != "" {
+		s += "/" + quoteDSLName(action)
+	}
+	return
+}
+
+func writeDSLMetadata(buf *bytes.Buffer, indent string, metadata map[string]string) {
+	for _, key := range sortedMetadataKeys(metadata) {
+		fmt.Fprintf(buf, "%smeta %s = %s\n", indent, quoteDSLName(key), strconv.Quote(metadata[key]))
+	}
+}
+
+func writeDSLMetadataBlock(buf *bytes.Buffer, metadata map[string]string) {
+	if len(metadata) == 0 {
+		return
+	}
+
+	buf.WriteString(" {")
+	for i, key := range sortedMetadataKeys(metadata) {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(buf, " %s = %s", quoteDSLName(key), strconv.Quote(metadata[key]))
+	}
+	buf.WriteString(" }")
+}
+
+var dslKeywords = []string{"machine", "version", "initial", "final", "meta", "state",
+	"choice", "junction", "enter", "exit", "on", "reenter", "else"}
+
+func quoteDSLName(name string) string {
+	// The name starting with "stateDiagram" is quoted to be distinguished
+	// from the header of the Mermaid state diagram.
+	if name == "" || hasString(dslKeywords, name) || strings.HasPrefix(name, "stateDiagram") {
+		return strconv.Quote(name)
+	}
+
+	for _, r := range name {
+		if !isDSLIdentRune(r) {
+			return strconv.Quote(name)
+		}
+	}
+	return name
+}
+
+func sortedMetadataKeys(metadata map[string]string) []string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
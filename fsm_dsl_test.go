@@ -0,0 +1,246 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDSL = `# The order workflow
+machine order
+version 2
+initial Pending
+final Approved, Rejected
+meta owner = "product"
+
+state Pending {
+    enter logState
+    meta note = "waiting for the review"
+    on Remind[canRemind]
+    reenter Restart
+}
+
+choice Check {
+    [isPassed] --> Approved
+    else --> Rejected
+}
+
+Pending --Review/review--> Check { priority = "high" }
+Pending --Cancel--> "Rejected"
+`
+
+func TestDSLRoundTrip(t *testing.T) {
+	def, err := LoadDefinition(strings.NewReader(testDSL), FormatDSL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := Definition{
+		Name:     "order",
+		Version:  2,
+		Initial:  "Pending",
+		Finals:   []State{"Approved", "Rejected"},
+		Metadata: map[string]string{"owner": "product"},
+		States: []StateDefinition{{
+			Name:     "Pending",
+			OnEnter:  "logState",
+			Metadata: map[string]string{"note": "waiting for the review"},
+		}},
+		Pseudos: []PseudoDefinition{{
+			Name: "Check",
+			Kind: Choice,
+			Branches: []BranchDefinition{
+				{Target: "Approved", Guard: "isPassed"},
+				{Target: "Rejected"},
+			},
+		}},
+		Transitions: []TransitionDefinition{
+			{Event: "Remind", Source: "Pending", Kind: Internal, Guard: "canRemind"},
+			{Event: "Restart", Source: "Pending", Kind: Reentrant},
+			{Event: "Review", Source: "Pending", Target: "Check", Action: "review",
+				Metadata: map[string]string{"priority": "high"}},
+			{Event: "Cancel", Source: "Pending", Target: "Rejected"},
+		},
+	}
+	if !reflect.DeepEqual(expect, def) {
+		t.Fatalf("expect the definition %+v, but got %+v", expect, def)
+	}
+
+	data, err := MarshalDSL(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newdef, err := ParseDSL(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(def, newdef) {
+		t.Errorf("expect the definition %+v, but got %+v", def, newdef)
+	}
+}
+
+func TestDSLQuotedNames(t *testing.T) {
+	def := Definition{
+		Initial: "Foo Bar",
+		Finals:  []State{"final"},
+		Transitions: []TransitionDefinition{
+			{Event: `say "hi"`, Source: "Foo Bar", Target: "final"},
+		},
+	}
+
+	data, err := MarshalDSL(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newdef, err := ParseDSL(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(def, newdef) {
+		t.Errorf("expect the definition %+v, but got %+v", def, newdef)
+	}
+}
+
+func TestDSLStateDiagramNames(t *testing.T) {
+	def := Definition{
+		Initial: "stateDiagram",
+		Transitions: []TransitionDefinition{
+			{Event: "e", Source: "stateDiagram", Target: "B"},
+			{Event: "f", Source: "stateDiagramX", Target: "B"},
+		},
+	}
+
+	data, err := MarshalDSL(def)
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(data), `"stateDiagram" --e--> B`) {
+		t.Errorf("expect the quoted state name, but got %s", data)
+	}
+
+	newdef, err := ParseDSL(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(def, newdef) {
+		t.Errorf("expect the definition %+v, but got %+v", def, newdef)
+	}
+
+	// Only the whole line is the header of the Mermaid state diagram.
+	newdef, err = ParseDSL(strings.NewReader("stateDiagramX --f--> B\n"))
+	if err != nil {
+		t.Fatal(err)
+	} else if expect := def.Transitions[1:]; !reflect.DeepEqual(expect, newdef.Transitions) {
+		t.Errorf("expect the transitions %+v, but got %+v", expect, newdef.Transitions)
+	}
+}
+
+func TestDSLMermaidStateDiagram(t *testing.T) {
+	fsm := New()
+	fsm.SetInitial("Pending")
+	fsm.AddFinals("Approved", "Rejected")
+	fsm.AddTransitions(
+		Source("Pending").WithTarget("Check").WithEvent("Review"),
+		Source("Pending").WithEvent("Remind").WithKind(Internal),
+	)
+	fsm.AddChoice("Check",
+		When("Approved", "isPassed", func(*FSM, interface{}) bool { return true }),
+		Else("Rejected"))
+
+	def, err := ParseDSL(strings.NewReader(fsm.VisualizeMermaidStateDiagram()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := Definition{
+		Initial: "Pending",
+		Finals:  []State{"Approved", "Rejected"},
+		Pseudos: []PseudoDefinition{{
+			Name: "Check",
+			Kind: Choice,
+			Branches: []BranchDefinition{
+				{Target: "Approved", Guard: "isPassed"},
+				{Target: "Rejected"},
+			},
+		}},
+		Transitions: []TransitionDefinition{
+			{Event: "Remind", Source: "Pending", Kind: Internal},
+			{Event: "Review", Source: "Pending", Target: "Check"},
+		},
+	}
+	if !reflect.DeepEqual(expect, def) {
+		t.Errorf("expect the definition %+v, but got %+v", expect, def)
+	}
+}
+
+func TestDSLMermaidGuardsActions(t *testing.T) {
+	yes := func(*FSM, interface{}) bool { return true }
+
+	fsm := New()
+	fsm.SetInitial("Pending")
+	fsm.AddTransitions(
+		Source("Pending").WithTarget("Approved").WithEvent("Review").
+			WithGuard("canReview", yes).WithNamedAction("review", yes),
+		Source("Pending").WithEvent("Remind").WithKind(Internal).WithGuard("canRemind", yes),
+		Source("Pending").WithTarget("Rejected").WithEvent("Cancel").WithAction(yes),
+	)
+
+	opts := VisualizeOptions{ShowGuards: true, ShowActions: true}
+	def, err := ParseDSL(strings.NewReader(fsm.VisualizeMermaidStateDiagramWith(opts)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expects := []TransitionDefinition{
+		{Event: "Remind", Source: "Pending", Kind: Internal, Guard: "canRemind"},
+		{Event: "Cancel", Source: "Pending", Target: "Rejected"}, // The unnamed action
+		{Event: "Review", Source: "Pending", Target: "Approved", Guard: "canReview", Action: "review"},
+	}
+	if !reflect.DeepEqual(expects, def.Transitions) {
+		t.Errorf("expect the transitions %+v, but got %+v", expects, def.Transitions)
+	}
+}
+
+func TestDSLSyntaxError(t *testing.T) {
+	tests := []struct {
+		dsl    string
+		line   int
+		column int
+	}{
+		{"initial", 1, 8},
+		{"A --E-> B", 1, 6},
+		{"machine m\n  A --E[g --> B", 2, 11},
+		{"state A {\n  enter\n}", 2, 8},
+		{"state A {\n  on E", 2, 7},
+		{"choice C {\n  [g] -> B\n}", 2, 7},
+		{"A --E--> B { k = }", 1, 18},
+		{`A --"E--> B`, 1, 5},
+		{"version v2", 1, 9},
+		{"}", 1, 1},
+		{"A --> B", 1, 1},
+		{"final A B", 1, 9},
+	}
+
+	for _, test := range tests {
+		_, err := ParseDSL(strings.NewReader(test.dsl))
+		if se, ok := err.(SyntaxError); !ok {
+			t.Errorf("%q: expect a SyntaxError, but got %v", test.dsl, err)
+		} else if se.Line != test.line || se.Column != test.column {
+			t.Errorf("%q: expect the position %d:%d, but got %d:%d (%s)",
+				test.dsl, test.line, test.column, se.Line, se.Column, se.Msg)
+		}
+	}
+}
@@ -14,7 +14,10 @@
 
 package fsm
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 func ExampleFSM_SetEvent() {
 	const (
@@ -64,7 +67,6 @@ func ExampleFSM() {
 	fsm.SetCurrent(StateFoo)
 
 	/// Add the state transitions.
-	var barCount int
 	Source(StateFoo).WithTarget(StateBar).WithEvent(EventBar).Add(fsm) // No Action
 	Target(StateFoo).WithSource(StateBar).WithEvent(EventFoo).
 		WithAction(func(fsm *FSM, data interface{}) (transition bool) { // Set Action
@@ -72,11 +74,13 @@ func ExampleFSM() {
 
 			// Here as the example, after trigger the event EventFoo two twice,
 			// transition the state to the target.
-			if barCount > 0 {
-				barCount = 0
+			//
+			// The counter is stored in the extended state of the state machine.
+			if barCount, _ := fsm.Var("barCount").(int); barCount > 0 {
+				fsm.DelVar("barCount")
 				transition = true
 			} else {
-				barCount++
+				fsm.SetVar("barCount", barCount+1)
 			}
 			return
 		}).
@@ -199,3 +203,594 @@ func ExampleFSM() {
 	//     StateFoo --> StateBar: EventBar
 	//
 }
+
+func ExampleTransitionKind() {
+	const (
+		StateFoo = State("StateFoo")
+		StateBar = State("StateBar")
+	)
+
+	const (
+		EventRetry   = Event("EventRetry")
+		EventRestart = Event("EventRestart")
+		EventBar     = Event("EventBar")
+	)
+
+	var retries int
+	fsm := New()
+	fsm.SetCurrent(StateFoo)
+	fsm.OnEnter(func(s State) { fmt.Printf("OnEnter: %s\n", s) })
+	fsm.OnExit(func(s State) { fmt.Printf("OnExit: %s\n", s) })
+
+	Source(StateFoo).WithEvent(EventRetry).WithKind(Internal).
+		WithAction(func(fsm *FSM, data interface{}) bool { retries++; return true }).
+		Add(fsm)
+	Source(StateFoo).WithEvent(EventRestart).WithKind(Reentrant).Add(fsm)
+	Source(StateFoo).WithTarget(StateBar).WithEvent(EventBar).Add(fsm)
+
+	fmt.Println("------ Internal ------")
+	fsm.SendEvent(EventRetry, nil)
+	fmt.Printf("State: %s, Retries: %d\n", fsm.Current(), retries)
+
+	fmt.Println("------ Reentrant ------")
+	fsm.SendEvent(EventRestart, nil)
+
+	fmt.Println("------ Mermaid StateDiagram ------")
+	fmt.Println(fsm.VisualizeMermaidStateDiagram())
+
+	// Output:
+	// ------ Internal ------
+	// State: StateFoo, Retries: 1
+	// ------ Reentrant ------
+	// OnExit: StateFoo
+	// OnEnter: StateFoo
+	// ------ Mermaid StateDiagram ------
+	// stateDiagram-v2
+	//     [*] --> StateFoo
+	//     StateFoo --> StateBar: EventBar
+	//     StateFoo --> StateFoo: EventRestart
+	//     StateFoo : EventRetry
+	//     StateBar --> [*]
+	//
+}
+
+func ExampleFSM_AddChoice() {
+	const (
+		StatePending  = State("Pending")
+		StateCheck    = State("Check")
+		StateApproved = State("Approved")
+		StateRejected = State("Rejected")
+	)
+
+	const EventReview = Event("Review")
+
+	fsm := New()
+	fsm.SetCurrent(StatePending)
+	fsm.OnTransition(func(last, current State) {
+		fmt.Printf("OnTransition: %s -> %s\n", last, current)
+	})
+
+	Source(StatePending).WithTarget(StateCheck).WithEvent(EventReview).Add(fsm)
+	fsm.AddChoice(StateCheck,
+		When(StateApproved, "isPassed", func(fsm *FSM, data interface{}) bool {
+			return data.(int) >= 60
+		}),
+		Else(StateRejected),
+	)
+
+	fmt.Println(fsm.SendEvent(EventReview, 80))
+	fmt.Printf("States: %v\n", fsm.States())
+
+	fmt.Println("------ Graphviz ------")
+	fmt.Println(fsm.VisualizeGraphviz())
+
+	fmt.Println("------ Mermaid StateDiagram ------")
+	fmt.Println(fsm.VisualizeMermaidStateDiagram())
+
+	// Output:
+	// OnTransition: Pending -> Approved
+	// <nil>
+	// States: [Pending Approved Rejected]
+	// ------ Graphviz ------
+	// digraph fsm {
+	//     "Pending" -> "Check" [ label = "Review" ];
+	//     "Check" -> "Approved" [ label = "[isPassed]" ];
+	//     "Check" -> "Rejected" [ label = "[else]" ];
+	//
+	//     "Approved";
+	//     "Check" [ shape = diamond ];
+	//     "Pending";
+	//     "Rejected";
+	// }
+	//
+	// ------ Mermaid StateDiagram ------
+	// stateDiagram-v2
+	//     state Check <<choice>>
+	//     [*] --> Approved
+	//     Pending --> Check: Review
+	//     Check --> Approved: [isPassed]
+	//     Check --> Rejected: [else]
+	//     Approved --> [*]
+	//     Rejected --> [*]
+	//
+}
+
+func ExampleFSM_Done() {
+	const (
+		StateDraft   = State("Draft")
+		StateSubmit  = State("Submitted")
+		StateShipped = State("Shipped")
+	)
+
+	const (
+		EventSubmit = Event("Submit")
+		EventShip   = Event("Ship")
+	)
+
+	fsm := New()
+	fsm.SetInitial(StateDraft)
+	fsm.AddFinals(StateShipped)
+	fsm.OnDone(func(s State) { fmt.Printf("OnDone: %s\n", s) })
+
+	Source(StateDraft).WithTarget(StateSubmit).WithEvent(EventSubmit).Add(fsm)
+	Source(StateSubmit).WithTarget(StateShipped).WithEvent(EventShip).Add(fsm)
+
+	done := fsm.Done()
+	fmt.Println(fsm.SendEvent(EventSubmit, nil))
+	fmt.Println(fsm.SendEvent(EventShip, nil))
+
+	<-done
+	fmt.Println(fsm.IsDone())
+	fmt.Println(fsm.SendEvent(EventShip, nil))
+
+	fmt.Println("------ Mermaid StateDiagram ------")
+	fmt.Println(fsm.VisualizeMermaidStateDiagram())
+
+	// Output:
+	// <nil>
+	// OnDone: Shipped
+	// <nil>
+	// true
+	// the state machine is done
+	// ------ Mermaid StateDiagram ------
+	// stateDiagram-v2
+	//     [*] --> Draft
+	//     Draft --> Submitted: Submit
+	//     Submitted --> Shipped: Ship
+	//     Shipped --> [*]
+	//
+}
+
+func ExampleFSM_SetTransactional() {
+	const (
+		StateFoo = State("StateFoo")
+		StateBar = State("StateBar")
+		StateZoo = State("StateZoo")
+	)
+
+	const (
+		EventBar = Event("EventBar")
+		EventZoo = Event("EventZoo")
+	)
+
+	fsm := New()
+	fsm.SetCurrent(StateFoo)
+	fsm.SetTransactional(true)
+	fsm.SetVar("count", 0)
+
+	Source(StateFoo).WithTarget(StateBar).WithEvent(EventBar).
+		WithAction(func(fsm *FSM, data interface{}) bool {
+			fsm.SetVar("count", fsm.Var("count").(int)+1)
+			fsm.Compensate(func() { fmt.Println("Compensate: EventBar") })
+			fsm.SetEvent(EventZoo, nil) // Continue to transition to StateZoo.
+			return true
+		}).
+		Add(fsm)
+
+	Source(StateBar).WithTarget(StateZoo).WithEvent(EventZoo).
+		WithAction(func(fsm *FSM, data interface{}) bool {
+			return false // Fail, so roll back all.
+		}).
+		Add(fsm)
+
+	err := fsm.SendEvent(EventBar, nil)
+	fmt.Println(err)
+	fmt.Printf("State: %s, Count: %v\n", fsm.Current(), fsm.Var("count"))
+
+	// Output:
+	// Compensate: EventBar
+	// source state 'StateBar' transition for the event 'EventZoo' is suspended
+	// State: StateFoo, Count: 0
+}
+
+func ExampleFSM_Validate() {
+	const (
+		StateDraft     = State("Draft")
+		StateReview    = State("Review")
+		StateCheck     = State("Check")
+		StateRetry     = State("Retry")
+		StatePublished = State("Published")
+		StateArchived  = State("Archived")
+		StateBroken    = State("Broken")
+	)
+
+	const (
+		EventSubmit   = Event("Submit")
+		EventArchive  = Event("Archive")
+		EventRepair   = Event("Repair")
+		EventAutosave = Event("Autosave")
+	)
+
+	isPassed := func(fsm *FSM, data interface{}) bool { return data.(bool) }
+
+	fsm := New()
+	fsm.SetInitial(StateDraft)
+	fsm.AddFinals(StatePublished)
+	fsm.AddChoice(StateCheck, When(StatePublished, "isPassed", isPassed), Else(StateRetry), Else(StateDraft))
+	fsm.AddJunction(StateRetry, When(StateCheck, "isPassed", isPassed), Else(StateReview))
+
+	Source(StateDraft).WithTarget(StatePublished).WithEvent(EventSubmit).Add(fsm)
+	Source(StateDraft).WithTarget(StateReview).WithEvent(EventSubmit).Add(fsm)
+	Source(StateReview).WithTarget(StateCheck).WithEvent(EventSubmit).Add(fsm)
+	Source(StatePublished).WithTarget(StateArchived).WithEvent(EventArchive).Add(fsm)
+	Source(StateBroken).WithTarget(StateDraft).WithEvent(EventRepair).Add(fsm)
+	Source(StateReview).WithEvent(EventAutosave).WithKind(Internal).WithChains(EventAutosave).Add(fsm)
+
+	for _, finding := range fsm.Validate() {
+		fmt.Println(finding)
+	}
+
+	// Output:
+	// unreachable-state: the state 'Archived' is unreachable from 'Draft'
+	// unreachable-state: the state 'Broken' is unreachable from 'Draft'
+	// dead-end-state: the non-final state 'Archived' has no transition leaving it
+	// unusable-event: the event 'Archive' can never trigger any transition
+	// unusable-event: the event 'Repair' can never trigger any transition
+	// shadowed-branch: the branch #2 to 'Draft' of the pseudo state 'Check' follows another else branch
+	// pseudo-loop: the pseudo states form a loop: Check -> Retry -> Check
+	// shadowed-transition: the transition 'Submit' from 'Draft' to 'Published' is shadowed by the later one to 'Review'
+	// chain-loop: the chained events form a loop: Review --Autosave--> Review
+}
+
+func ExampleFSM_PathTo() {
+	const (
+		StateDraft     = State("Draft")
+		StatePaid      = State("Paid")
+		StateCheck     = State("Check")
+		StatePacked    = State("Packed")
+		StateShipped   = State("Shipped")
+		StateCancelled = State("Cancelled")
+	)
+
+	const (
+		EventPay    = Event("Pay")
+		EventPack   = Event("Pack")
+		EventShip   = Event("Ship")
+		EventCancel = Event("Cancel")
+		EventRush   = Event("Rush")
+	)
+
+	fsm := New()
+	fsm.SetInitial(StateDraft)
+	fsm.AddFinals(StateShipped, StateCancelled)
+	fsm.AddChoice(StateCheck,
+		When(StateShipped, "isInStock", func(fsm *FSM, data interface{}) bool {
+			return data.(bool)
+		}),
+		Else(StateCancelled),
+	)
+
+	Source(StateDraft).WithTarget(StatePaid).WithEvent(EventPay).Add(fsm)
+	Source(StateDraft).WithTarget(StateCancelled).WithEvent(EventCancel).Add(fsm)
+	Source(StatePaid).WithTarget(StatePacked).WithEvent(EventPack).Add(fsm)
+	Source(StatePaid).WithTarget(StateCheck).WithEvent(EventRush).Add(fsm)
+	Source(StatePacked).WithTarget(StateShipped).WithEvent(EventShip).Add(fsm)
+
+	fmt.Println(fsm.PathTo(StateDraft, StateShipped))
+	fmt.Println(fsm.AllPaths(StateDraft, StateShipped, 0))
+	fmt.Println(fsm.AllPaths(StateDraft, StateShipped, 2))
+	fmt.Println(fsm.ReachableFrom(StatePaid))
+	fmt.Println(fsm.CanReach(StateShipped, StateDraft))
+
+	query := fsm.Query().WithGuards(false)
+	fmt.Println(query.PathTo(StateDraft, StateShipped))
+	fmt.Println(query.AllPaths(StateDraft, StateCancelled, 0))
+
+	// Output:
+	// [Pay Rush] true
+	// [[Pay Pack Ship] [Pay Rush]]
+	// [[Pay Rush]]
+	// [Cancelled Packed Paid Shipped]
+	// false
+	// [Pay Pack Ship] true
+	// [[Pay Rush] [Cancel]]
+}
+
+func ExampleFSM_Explain() {
+	const (
+		StatePacked    = State("Packed")
+		StateCheck     = State("Check")
+		StateShipped   = State("Shipped")
+		StateBackorder = State("Backorder")
+	)
+
+	const (
+		EventShip   = Event("Ship")
+		EventRefund = Event("Refund")
+	)
+
+	type Order struct {
+		Captured bool
+		InStock  bool
+	}
+
+	fsm := New()
+	fsm.SetInitial(StatePacked)
+	fsm.AddChoice(StateCheck,
+		When(StateShipped, "isInStock", func(fsm *FSM, data interface{}) bool {
+			return data.(Order).InStock
+		}),
+	)
+
+	Source(StatePacked).WithTarget(StateCheck).WithEvent(EventShip).
+		WithGuard("isPaymentCaptured", func(fsm *FSM, data interface{}) bool {
+			return data.(Order).Captured
+		}).Add(fsm)
+	Source(StateBackorder).WithTarget(StatePacked).WithEvent(EventRefund).Add(fsm)
+
+	fmt.Println(fsm.AvailableEvents())
+	fmt.Println(fsm.AvailableEventsFrom(StateBackorder))
+
+	fmt.Println(fsm.Explain(EventRefund, Order{}))
+
+	e := fsm.Explain(EventShip, Order{})
+	fmt.Println(e.Reason, e.Guard)
+	fmt.Println(e)
+
+	e = fsm.Explain(EventShip, Order{Captured: true})
+	fmt.Println(e.Reason, e.Pseudo, e.Branches)
+	fmt.Println(e)
+
+	e = fsm.Explain(EventShip, Order{Captured: true, InStock: true})
+	fmt.Println(e.Allowed(), e.Target)
+	fmt.Println(e)
+
+	// Output:
+	// [Ship]
+	// [Refund]
+	// no transition from the state 'Packed' for the event 'Refund'
+	// guard-rejected isPaymentCaptured
+	// the guard 'isPaymentCaptured' rejects the event 'Ship' in the state 'Packed'
+	// no-branch Check [{Check Shipped isInStock false false}]
+	// no branch of the pseudo state 'Check' matches for the event 'Ship'
+	// true Shipped
+	// the event 'Ship' transitions the state 'Packed' to 'Shipped'
+}
+
+func ExampleEquivalent() {
+	// The old machine has the duplicated states "Review1" and "Review2".
+	old := New()
+	old.SetInitial("Draft")
+	old.AddFinals("Published")
+	Source("Draft").WithTarget("Review1").WithEvent("Submit").Add(old)
+	Source("Review1").WithTarget("Review2").WithEvent("Revise").Add(old)
+	Source("Review1").WithTarget("Published").WithEvent("Approve").Add(old)
+	Source("Review2").WithTarget("Review1").WithEvent("Revise").Add(old)
+	Source("Review2").WithTarget("Published").WithEvent("Approve").Add(old)
+
+	fmt.Println(old.EquivalentStates(false))
+
+	min := old.Minimize(false)
+	for _, t := range min.Transitions() {
+		fmt.Printf("%s --%s--> %s\n", t.Source, t.Event, t.Target)
+	}
+
+	fmt.Println(Equivalent(old, min))
+
+	// The refactored machine forgets to allow to revise the review.
+	refactored := New()
+	refactored.SetInitial("Draft")
+	refactored.AddFinals("Published")
+	Source("Draft").WithTarget("Review").WithEvent("Submit").Add(refactored)
+	Source("Review").WithTarget("Published").WithEvent("Approve").Add(refactored)
+
+	fmt.Println(Equivalent(old, refactored))
+
+	// Output:
+	// [[Review1 Review2]]
+	// Draft --Submit--> Review1
+	// Review1 --Revise--> Review1
+	// Review1 --Approve--> Published
+	// [] true
+	// [Submit Revise] false
+}
+
+func ExampleDiff() {
+	isPaid := func(fsm *FSM, data interface{}) bool { return true }
+
+	old := New()
+	old.SetInitial("Draft")
+	Source("Draft").WithTarget("Paid").WithEvent("Pay").Add(old)
+	Source("Paid").WithTarget("Shipped").WithEvent("Ship").Add(old)
+	Source("Draft").WithTarget("Cancelled").WithEvent("Cancel").Add(old)
+
+	latest := New()
+	latest.SetInitial("Draft")
+	Source("Draft").WithTarget("Paid").WithEvent("Pay").WithGuard("isPaid", isPaid).Add(latest)
+	Source("Paid").WithTarget("Packed").WithEvent("Pack").Add(latest)
+	Source("Packed").WithTarget("Shipped").WithEvent("Ship").Add(latest)
+	Source("Paid").WithTarget("Packed").WithEvent("Ship").Add(latest)
+	Source("Cancelled").WithTarget("Draft").WithEvent("Reopen").Add(latest)
+
+	diff := Diff(old, latest)
+	fmt.Print(diff)
+
+	fmt.Println("------ Graphviz ------")
+	fmt.Println(diff.VisualizeGraphviz())
+
+	fmt.Println("------ Mermaid FlowChart ------")
+	fmt.Println(diff.VisualizeMermaidFlowChart())
+
+	// Output:
+	// + state Packed
+	// + event Pack
+	// + event Reopen
+	// - event Cancel
+	// + transition Cancelled --Reopen--> Draft
+	// + transition Packed --Ship--> Shipped
+	// + transition Paid --Pack--> Packed
+	// - transition Draft --Cancel--> Cancelled
+	// ~ transition Draft --Pay--> Paid: guard
+	// ~ transition Paid --Ship--> Packed: target
+	// ! unreachable Cancelled
+	// ------ Graphviz ------
+	// digraph fsm {
+	//     "Cancelled" -> "Draft" [ label = "Reopen", color = "green", fontcolor = "green" ];
+	//     "Draft" -> "Paid" [ label = "Pay (guard)", color = "orange", fontcolor = "orange" ];
+	//     "Packed" -> "Shipped" [ label = "Ship", color = "green", fontcolor = "green" ];
+	//     "Paid" -> "Packed" [ label = "Pack", color = "green", fontcolor = "green" ];
+	//     "Paid" -> "Shipped" [ label = "Ship", color = "red", fontcolor = "red", style = "dashed" ];
+	//     "Paid" -> "Packed" [ label = "Ship", color = "green", fontcolor = "green" ];
+	//     "Draft" -> "Cancelled" [ label = "Cancel", color = "red", fontcolor = "red", style = "dashed" ];
+	//
+	//     "Cancelled";
+	//     "Draft";
+	//     "Packed" [ color = "green", fontcolor = "green" ];
+	//     "Paid";
+	//     "Shipped";
+	// }
+	//
+	// ------ Mermaid FlowChart ------
+	// graph LR
+	//     id0[Cancelled]
+	//     id1[Draft]
+	//     id2[Packed]
+	//     id3[Paid]
+	//     id4[Shipped]
+	//
+	//     id0 --> |Reopen| id1
+	//     id1 --> |Pay (guard)| id3
+	//     id2 --> |Ship| id4
+	//     id3 --> |Pack| id2
+	//     id3 -.-> |Ship| id4
+	//     id3 --> |Ship| id2
+	//     id1 -.-> |Cancel| id0
+	//
+	//     style id2 stroke:green,color:green
+	//     linkStyle 0 stroke:green,color:green
+	//     linkStyle 1 stroke:orange,color:orange
+	//     linkStyle 2 stroke:green,color:green
+	//     linkStyle 3 stroke:green,color:green
+	//     linkStyle 4 stroke:red,color:red
+	//     linkStyle 5 stroke:green,color:green
+	//     linkStyle 6 stroke:red,color:red
+	//
+}
+
+func ExampleFSM_SetMigrations() {
+	// Version 1: Draft --Submit--> Review --Approve--> Published
+	// Version 2: the state "Review" is renamed to "InReview".
+	// Version 3: the state "InReview" is split into "LegalReview" and "TechReview".
+	fsm := New()
+	fsm.SetVersion(3)
+	fsm.SetInitial("Draft")
+	fsm.AddFinals("Published")
+	Source("Draft").WithTarget("LegalReview").WithEvent("Submit").Add(fsm)
+	Source("LegalReview").WithTarget("TechReview").WithEvent("Approve").Add(fsm)
+	Source("TechReview").WithTarget("Published").WithEvent("Approve").Add(fsm)
+
+	fsm.SetMigrations(NewMigrations().
+		Add(1, "Review", "InReview").
+		AddFunc(2, "InReview", func(state State, vars map[string]interface{}) State {
+			if vars["legal"] == true {
+				return "LegalReview"
+			}
+			return "TechReview"
+		}))
+
+	snapshots := []Snapshot{
+		{State: "Review", Version: 1, Vars: map[string]interface{}{"legal": true}},
+		{State: "Review", Version: 1, Vars: map[string]interface{}{"legal": true}},
+		{State: "Draft", Version: 1},
+		{State: "InReview", Version: 2},
+		{State: "Archived", Version: 2},
+		{State: "TechReview", Version: 4},
+	}
+
+	report := fsm.PlanMigration(snapshots)
+	fmt.Printf("Failed: %d/%d\n", report.Failed, len(snapshots))
+	fmt.Print(report)
+
+	fmt.Println(fsm.Restore(snapshots[0]))
+	fmt.Println(fsm.Current(), fsm.Snapshot().Version)
+	fmt.Println(fsm.Restore(snapshots[5]))
+
+	// Output:
+	// Failed: 2/6
+	// v1 Draft -> v3 Draft: 1
+	// v1 Review -> v3 LegalReview: 2
+	// v2 Archived -> v3 Archived: 1 (the state 'Archived' is unknown)
+	// v2 InReview -> v3 TechReview: 1
+	// v4 TechReview -> v3 TechReview: 1 (cannot migrate the state 'TechReview' from the newer version 4 to 3)
+	// <nil>
+	// LegalReview 3
+	// invalid snapshot: cannot migrate the state 'TechReview' from the newer version 4 to 3
+}
+
+func ExampleRecorder() {
+	isPassed := func(fsm *FSM, data interface{}) bool { return data == "pass" }
+
+	fsm := New()
+	fsm.SetInitial("Pending")
+	fsm.AddFinals("Approved")
+	Source("Pending").WithTarget("Check").WithEvent("Review").Add(fsm)
+	Source("Pending").WithEvent("Remind").WithKind(Internal).Add(fsm)
+	Source("Rejected").WithTarget("Pending").WithEvent("Appeal").Add(fsm)
+	fsm.AddChoice("Check", When("Approved", "isPassed", isPassed), Else("Rejected"))
+
+	recorder := NewRecorder(0)
+	fsm.OnTrace(recorder.Record)
+
+	_ = fsm.SendEvent("Remind", nil)
+	_ = fsm.SendEvent("Review", "fail")
+	_ = fsm.SendEvent("Appeal", nil)
+	_ = fsm.SendEvent("Review", "pass")
+
+	// Clear the time to make the output stable.
+	trace := recorder.Trace()
+	for i := range trace {
+		trace[i].Time = time.Time{}
+	}
+
+	fmt.Println("------ Mermaid SequenceDiagram ------")
+	fmt.Println(trace.VisualizeMermaidSequenceDiagram())
+
+	fmt.Println("------ Graphviz ------")
+	fmt.Println(fsm.VisualizeTraceGraphviz(trace, VisualizeOptions{}))
+
+	// Output:
+	// ------ Mermaid SequenceDiagram ------
+	// sequenceDiagram
+	//     autonumber
+	//     participant Pending
+	//     participant Rejected
+	//     participant Approved
+	//     Pending->>Pending: Remind
+	//     Pending->>Rejected: Review
+	//     Rejected->>Pending: Appeal
+	//     Pending->>Approved: Review
+	//
+	// ------ Graphviz ------
+	// digraph fsm {
+	//     "Pending" -> "Pending" [ label = "Remind (1)", color = "blue", fontcolor = "blue", penwidth = 2 ];
+	//     "Pending" -> "Check" [ label = "Review (2, 4)", color = "blue", fontcolor = "blue", penwidth = 2 ];
+	//     "Rejected" -> "Pending" [ label = "Appeal (3)", color = "blue", fontcolor = "blue", penwidth = 2 ];
+	//     "Check" -> "Approved" [ label = "[isPassed] (4)", color = "blue", fontcolor = "blue", penwidth = 2 ];
+	//     "Check" -> "Rejected" [ label = "[else] (2)", color = "blue", fontcolor = "blue", penwidth = 2 ];
+	//
+	//     "Approved" [ style = filled, fillcolor = "lightblue" ];
+	//     "Check" [ shape = diamond, style = filled, fillcolor = "lightblue" ];
+	//     "Pending" [ style = filled, fillcolor = "lightblue" ];
+	//     "Rejected" [ style = filled, fillcolor = "lightblue" ];
+	// }
+}
@@ -0,0 +1,220 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"fmt"
+	"sort"
+)
+
+// AvailableEvents returns the sorted events that the current state accepts.
+//
+// The guards are not evaluated, so use Explain to check an event with data.
+func (f *FSM) AvailableEvents() []Event { return f.AvailableEventsFrom(f.Current()) }
+
+// AvailableEventsFrom returns the sorted events that the given state accepts,
+// which is empty if the state is final.
+//
+// The guards are not evaluated, so use Explain to check an event with data.
+func (f *FSM) AvailableEventsFrom(state State) []Event {
+	if f.IsFinal(state) {
+		return nil
+	}
+
+	var events []Event
+	for _, t := range f.transitions {
+		if t.Source == state {
+			events = append(events, t.Event)
+		}
+	}
+	sort.Sort(sortedEvents(events))
+	return events
+}
+
+type sortedEvents []Event
+
+func (es sortedEvents) Len() int           { return len(es) }
+func (es sortedEvents) Swap(i, j int)      { es[i], es[j] = es[j], es[i] }
+func (es sortedEvents) Less(i, j int) bool { return es[i] < es[j] }
+
+// ExplainReason is the reason why an event is allowed or not.
+type ExplainReason uint8
+
+const (
+	// ExplainAllowed means that the event can trigger the transition.
+	ExplainAllowed ExplainReason = iota
+
+	// ExplainDone means that the state machine is done.
+	ExplainDone
+
+	// ExplainNoTransition means that the current state has no transition
+	// for the event.
+	ExplainNoTransition
+
+	// ExplainGuardRejected means that the guard of the transition rejects
+	// the event with the data.
+	ExplainGuardRejected
+
+	// ExplainNoBranch means that no branch of the pseudo state matches
+	// the data.
+	ExplainNoBranch
+)
+
+func (r ExplainReason) String() string {
+	switch r {
+	case ExplainAllowed:
+		return "allowed"
+	case ExplainDone:
+		return "done"
+	case ExplainNoTransition:
+		return "no-transition"
+	case ExplainGuardRejected:
+		return "guard-rejected"
+	case ExplainNoBranch:
+		return "no-branch"
+	default:
+		return fmt.Sprintf("ExplainReason(%d)", r)
+	}
+}
+
+// BranchResult is the result to evaluate a branch of the pseudo state.
+type BranchResult struct {
+	Pseudo  State
+	Target  State
+	Guard   string // The name of the guard, which is empty for the else branch.
+	Else    bool
+	Matched bool
+}
+
+// Explanation describes why an event is allowed or not in the current state.
+type Explanation struct {
+	Event   Event
+	State   State
+	Reason  ExplainReason
+	Message string
+
+	// Transition is the transition of the event from the current state,
+	// which is the ZERO value if the reason is ExplainNoTransition.
+	Transition Transition
+
+	// Guard is the name of the guard rejecting the event,
+	// which is only set if the reason is ExplainGuardRejected.
+	Guard string
+
+	// Pseudo is the pseudo state where no branch matches,
+	// which is only set if the reason is ExplainNoBranch.
+	Pseudo State
+
+	// Branches is the evaluated branches of the pseudo states in order.
+	Branches []BranchResult
+
+	// Target is the resolved target state if the event is allowed.
+	Target State
+}
+
+// Allowed reports whether the event is allowed.
+func (e Explanation) Allowed() bool { return e.Reason == ExplainAllowed }
+
+func (e Explanation) String() string { return e.Message }
+
+// Explain explains whether the event with the data can trigger the transition
+// from the current state, and which guard or pseudo state rejects it if not.
+//
+// It evaluates the guards of the transition and the branches, but does not
+// call the action or change the state. So the branches of the choice pseudo
+// states, which depend on the changes made by the action, may be different
+// from the ones taken by SendEvent.
+//
+// Notice: there is neither the deferred event nor the wildcard transition,
+// so only the transition from the current state for the event is explained.
+func (f *FSM) Explain(event Event, data interface{}) (e Explanation) {
+	e.Event, e.State = event, f.Current()
+	if f.IsDone() {
+		e.Reason = ExplainDone
+		e.Message = fmt.Sprintf("the state machine is done in the final state '%s'", e.State)
+		return
+	}
+
+	index := f.indexTransition(e.State, event)
+	if index < 0 {
+		e.Reason = ExplainNoTransition
+		e.Message = fmt.Sprintf("no transition from the state '%s' for the event '%s'", e.State, event)
+		return
+	}
+
+	e.Transition = f.transitions[index]
+	if g := e.Transition.Guard; g != nil && !g(f, data) {
+		e.Reason = ExplainGuardRejected
+		e.Guard = e.Transition.GuardName
+		if e.Guard == "" {
+			e.Message = fmt.Sprintf("the guard rejects the event '%s' in the state '%s'", event, e.State)
+		} else {
+			e.Message = fmt.Sprintf("the guard '%s' rejects the event '%s' in the state '%s'",
+				e.Guard, event, e.State)
+		}
+		return
+	}
+
+	target := e.Transition.Target
+	for i := 0; f.IsPseudo(target); i++ {
+		if i > len(f.pseudos) {
+			e.Reason, e.Pseudo = ExplainNoBranch, target
+			e.Message = fmt.Sprintf("the pseudo states form a loop from '%s' for the event '%s'",
+				e.Transition.Target, event)
+			return
+		}
+
+		next, ok := f.explainPseudo(&e, target, data)
+		if !ok {
+			e.Reason, e.Pseudo = ExplainNoBranch, target
+			e.Message = fmt.Sprintf("no branch of the pseudo state '%s' matches for the event '%s'",
+				target, event)
+			return
+		}
+		target = next
+	}
+
+	e.Target = target
+	e.Reason = ExplainAllowed
+	e.Message = fmt.Sprintf("the event '%s' transitions the state '%s' to '%s'", event, e.State, target)
+	return
+}
+
+func (f *FSM) explainPseudo(e *Explanation, state State, data interface{}) (target State, ok bool) {
+	var elseIndex = -1
+	for _, b := range f.pseudos[state].branches {
+		r := BranchResult{Pseudo: state, Target: b.Target, Guard: b.GuardName, Else: b.IsElse()}
+		if b.IsElse() {
+			if elseIndex < 0 {
+				elseIndex = len(e.Branches)
+			}
+			e.Branches = append(e.Branches, r)
+			continue
+		}
+
+		r.Matched = b.Guard(f, data)
+		e.Branches = append(e.Branches, r)
+		if r.Matched {
+			return b.Target, true
+		}
+	}
+
+	if elseIndex < 0 {
+		return "", false
+	}
+
+	e.Branches[elseIndex].Matched = true
+	return e.Branches[elseIndex].Target, true
+}
@@ -0,0 +1,111 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDone is returned by SendEvent when the state machine has entered
+// a final state and does not accept any event any more.
+var ErrDone = errors.New("the state machine is done")
+
+// SetInitial sets the initial state of the state machine.
+//
+// If the current state has not been set, it is also set to initial.
+func (f *FSM) SetInitial(initial State) {
+	if initial == "" {
+		panic("the initial state must not be empty")
+	}
+	if f.IsPseudo(initial) {
+		panic(fmt.Sprintf("the initial state '%s' must not be a pseudo state", initial))
+	}
+
+	f.initial = initial
+	if f.current == "" {
+		f.SetCurrent(initial)
+	}
+}
+
+// Initial returns the initial state, which may be empty if not set.
+func (f *FSM) Initial() State { return f.initial }
+
+// AddFinals declares the final states of the state machine.
+//
+// When entering any final state, the state machine is done and does not
+// accept any event any more.
+func (f *FSM) AddFinals(finals ...State) {
+	for _, state := range finals {
+		if state == "" {
+			panic("the final state must not be empty")
+		}
+		if f.IsPseudo(state) {
+			panic(fmt.Sprintf("the final state '%s' must not be a pseudo state", state))
+		}
+	}
+
+	for _, state := range finals {
+		if !hasState(f.finals, state) {
+			f.finals = append(f.finals, state)
+		}
+	}
+	f.updateDone()
+}
+
+// Finals returns all the declared final states.
+func (f *FSM) Finals() []State {
+	finals := make([]State, len(f.finals))
+	copy(finals, f.finals)
+	return finals
+}
+
+// IsFinal reports whether the state is a declared final state.
+func (f *FSM) IsFinal(state State) bool { return hasState(f.finals, state) }
+
+// IsDone reports whether the current state is a declared final state.
+func (f *FSM) IsDone() bool { return f.current != "" && f.IsFinal(f.current) }
+
+// OnDone sets a function that will be called when entering a final state
+// by the transition.
+func (f *FSM) OnDone(fn func(final State)) { f.ondone = fn }
+
+// Done returns a channel that is closed when the state machine is done.
+func (f *FSM) Done() <-chan struct{} {
+	if f.done == nil {
+		f.done = make(chan struct{})
+		f.closed = false
+		f.updateDone()
+	}
+	return f.done
+}
+
+func (f *FSM) updateDone() {
+	if f.done == nil || f.intx {
+		return
+	}
+
+	switch done := f.IsDone(); {
+	case done && !f.closed:
+		close(f.done)
+		f.closed = true
+
+	case !done && f.closed:
+		// The state machine is reset to a non-final state,
+		// so the closed channel is replaced lazily.
+		f.done = nil
+		f.closed = false
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"io"
+)
+
+type htmlBranch struct {
+	Target State  `json:"target"`
+	Guard  string `json:"guard,omitempty"`
+	Else   bool   `json:"else,omitempty"`
+}
+
+type htmlState struct {
+	Name     State             `json:"name"`
+	Kind     string            `json:"kind,omitempty"` // "choice" or "junction" for the pseudo state
+	Final    bool              `json:"final,omitempty"`
+	OnEnter  string            `json:"onEnter,omitempty"`
+	OnExit   string            `json:"onExit,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Branches []htmlBranch      `json:"branches,omitempty"`
+}
+
+type htmlTransition struct {
+	Event    Event             `json:"event"`
+	Source   State             `json:"source"`
+	Target   State             `json:"target"`
+	Kind     string            `json:"kind"`
+	Guard    string            `json:"guard,omitempty"`
+	Action   string            `json:"action,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// htmlModel is the state machine exported into the HTML explorer.
+type htmlModel struct {
+	Name        string            `json:"name"`
+	Initial     State             `json:"initial"`
+	Current     State             `json:"current"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	States      []htmlState       `json:"states"`
+	Transitions []htmlTransition  `json:"transitions"`
+}
+
+func (f *FSM) htmlModel(name string) htmlModel {
+	m := htmlModel{Name: name, Initial: f.Initial(), Current: f.Current(), Metadata: f.Metadata()}
+	for _, state := range f.validateStates() {
+		s := htmlState{
+			Name:     state,
+			Final:    f.IsFinal(state),
+			OnEnter:  hookName(f.enterStates[state] != nil, f.enterNames[state]),
+			OnExit:   hookName(f.exitStates[state] != nil, f.exitNames[state]),
+			Metadata: f.StateMetadata(state),
+		}
+
+		if kind, branches := f.Pseudo(state); kind > 0 {
+			s.Kind = kind.String()
+			for _, b := range branches {
+				s.Branches = append(s.Branches, htmlBranch{Target: b.Target,
+					Guard: hookName(b.Guard != nil, b.GuardName), Else: b.IsElse()})
+			}
+		}
+		m.States = append(m.States, s)
+	}
+
+	for _, t := range cloneAndSortTransitions(f.Transitions()) {
+		m.Transitions = append(m.Transitions, htmlTransition{
+			Event:    t.Event,
+			Source:   t.Source,
+			Target:   t.Target,
+			Kind:     t.Kind.String(),
+			Guard:    hookName(t.Guard != nil, t.GuardName),
+			Action:   hookName(t.Action != nil, t.ActionName),
+			Metadata: cloneMetadata(t.Metadata),
+		})
+	}
+
+	return m
+}
+
+// ExportHTML writes a self-contained HTML file to explore the state machine,
+// which works offline without any external resource.
+//
+// The page contains the diagram rendered by RenderSVG with the options,
+// and a side panel, which lists the states, the events, the guards and
+// the metadata, supports searching them, and simulates SendEvent over
+// the exported transitions by clicking the events. Since the guards cannot
+// be evaluated in the browser, they are toggled manually in the panel.
+//
+// The title is the name of the options, or the name of the state machine.
+func (f *FSM) ExportHTML(w io.Writer, opts VisualizeOptions) error {
+	name := opts.Name
+	if name == "" {
+		name = f.Name()
+	}
+	if name == "" {
+		name = "fsm"
+	}
+
+	data, err := json.Marshal(f.htmlModel(name))
+	if err != nil {
+		return err
+	}
+
+	var svg bytes.Buffer
+	if err = f.RenderSVG(&svg, opts); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(svg.Len() + len(data) + len(htmlHead) + len(htmlScript) + 1024)
+	buf.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	buf.WriteString("<title>" + html.EscapeString(name) + "</title>\n")
+	buf.WriteString(htmlHead)
+	buf.WriteString("</head>\n<body>\n<main id=\"fsm-diagram\">\n")
+	buf.Write(svg.Bytes())
+	buf.WriteString("</main>\n")
+	buf.WriteString(htmlPanel)
+
+	// json.Marshal escapes "<", ">" and "&", so it is safe in the script.
+	buf.WriteString("<script type=\"application/json\" id=\"fsm-data\">")
+	buf.Write(data)
+	buf.WriteString("</script>\n<script>\n")
+	buf.WriteString(htmlScript)
+	buf.WriteString("</script>\n</body>\n</html>\n")
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+const htmlHead = `<style>
+body { margin: 0; display: flex; height: 100vh; font-family: sans-serif; font-size: 14px; color: #333333; }
+main { flex: 1; overflow: auto; padding: 16px; }
+aside { width: 360px; overflow: auto; padding: 16px; border-left: 1px solid #dddddd; background: #fafafa; }
+h1 { font-size: 18px; margin: 0 0 12px; }
+h2 { font-size: 15px; margin: 16px 0 6px; }
+ul { list-style: none; margin: 0; padding: 0; }
+li { padding: 4px 0; border-bottom: 1px solid #eeeeee; }
+input[type=search] { width: 100%; box-sizing: border-box; padding: 6px; }
+button { margin: 2px 4px 2px 0; cursor: pointer; }
+.meta { color: #777777; font-size: 12px; }
+.hidden { display: none; }
+.error { color: #d62728; }
+.state.sim-current > rect, .state.sim-current > polygon { fill: #ffe08a !important; stroke-width: 3; }
+.state.match > rect, .state.match > polygon { stroke: #1f77b4; stroke-width: 3; }
+</style>
+`
+
+const htmlPanel = `<aside>
+<h1 id="fsm-name"></h1>
+<input type="search" id="fsm-search" placeholder="Search the states, events, guards and metadata">
+<h2>Simulation</h2>
+<div>Current: <strong id="fsm-current"></strong></div>
+<div id="fsm-events"></div>
+<div id="fsm-message" class="meta"></div>
+<button id="fsm-reset">Reset</button>
+<ol id="fsm-history" class="meta"></ol>
+<h2>Guards</h2>
+<ul id="fsm-guards"></ul>
+<h2>States</h2>
+<ul id="fsm-states"></ul>
+<h2>Events</h2>
+<ul id="fsm-transitions"></ul>
+</aside>
+`
+
+const htmlScript = `(function () {
+  "use strict";
+
+  var model = JSON.parse(document.getElementById("fsm-data").textContent);
+  var guards = {}; // The name of the guard to whether it passes.
+  var current, history;
+
+  function $(id) { return document.getElementById(id); }
+
+  function element(tag, text, className) {
+    var e = document.createElement(tag);
+    if (text) { e.textContent = text; }
+    if (className) { e.className = className; }
+    return e;
+  }
+
+  function findState(name) {
+    for (var i = 0; i < model.states.length; i++) {
+      if (model.states[i].name === name) { return model.states[i]; }
+    }
+    return null;
+  }
+
+  function metadataText(metadata) {
+    var keys = Object.keys(metadata || {}).sort();
+    return keys.map(function (k) { return k + " = " + metadata[k]; }).join(", ");
+  }
+
+  function passes(guard) { return !guard || guards[guard] !== false; }
+
+  // resolve resolves the pseudo states by the branches in turn,
+  // and returns null if no branch passes. Like SendEvent, the first else
+  // branch is taken only if no guarded branch passes.
+  function resolve(target) {
+    for (var state = findState(target), n = 0; state && state.kind; state = findState(target)) {
+      if (++n > model.states.length) { return null; }
+
+      var next = null, fallback = null;
+      for (var i = 0; i < state.branches.length; i++) {
+        var b = state.branches[i];
+        if (!b.else) {
+          if (passes(b.guard)) { next = b.target; break; }
+        } else if (fallback === null) {
+          fallback = b.target;
+        }
+      }
+      if (next === null) { next = fallback; }
+      if (next === null) { return null; }
+      target = next;
+    }
+    return target;
+  }
+
+  function send(t) {
+    var message;
+    if (!passes(t.guard)) {
+      message = "The transition is suspended by the guard '" + t.guard + "'.";
+    } else {
+      var target = t.kind === "internal" ? current : resolve(t.target);
+      if (target === null) {
+        message = "No branch of the pseudo state '" + t.target + "' passes.";
+      } else {
+        history.push(current + " --" + t.event + "--> " + target);
+        current = target;
+      }
+    }
+
+    render();
+    $("fsm-message").textContent = message || "";
+    $("fsm-message").className = message ? "error" : "meta";
+  }
+
+  function eachNode(fn) {
+    var nodes = document.querySelectorAll("#fsm-diagram g.state");
+    for (var i = 0; i < nodes.length; i++) { fn(nodes[i], nodes[i].getAttribute("data-state")); }
+  }
+
+  function render() {
+    $("fsm-current").textContent = current;
+    eachNode(function (node, state) { node.classList.toggle("sim-current", state === current); });
+
+    var events = $("fsm-events");
+    events.textContent = "";
+    var state = findState(current);
+    if (state && state.final) {
+      events.appendChild(element("span", "The state machine is done.", "meta"));
+    } else {
+      model.transitions.forEach(function (t) {
+        if (t.source !== current) { return; }
+        var button = element("button", t.event);
+        button.title = t.guard ? "guard: " + t.guard : "";
+        button.onclick = function () { send(t); };
+        events.appendChild(button);
+      });
+      if (!events.firstChild) { events.appendChild(element("span", "No events.", "meta")); }
+    }
+
+    var list = $("fsm-history");
+    list.textContent = "";
+    history.forEach(function (h) { list.appendChild(element("li", h)); });
+  }
+
+  function reset() {
+    current = model.current || model.initial;
+    history = [];
+    render();
+    $("fsm-message").textContent = "";
+  }
+
+  function item(list, title, details, search) {
+    var li = element("li");
+    li.appendChild(element("strong", title));
+    details.forEach(function (d) { if (d) { li.appendChild(element("div", d, "meta")); } });
+    li.setAttribute("data-search", (search || []).concat([title], details).join(" ").toLowerCase());
+    list.appendChild(li);
+  }
+
+  function build() {
+    $("fsm-name").textContent = model.name;
+    if (model.metadata) { $("fsm-name").title = metadataText(model.metadata); }
+
+    model.states.forEach(function (s) {
+      var kind = s.kind || (s.name === model.initial ? "initial" : s.final ? "final" : "");
+      var branches = (s.branches || []).map(function (b) {
+        return "[" + (b.else ? "else" : b.guard) + "] --> " + b.target;
+      });
+      item($("fsm-states"), s.name, [kind, s.onEnter && "enter: " + s.onEnter,
+        s.onExit && "exit: " + s.onExit, metadataText(s.metadata)].concat(branches));
+    });
+
+    var names = {};
+    model.transitions.forEach(function (t) {
+      if (t.guard) { names[t.guard] = true; }
+      var arrow = t.kind === "internal" ? "(internal)" : "--> " + t.target;
+      item($("fsm-transitions"), t.event, [t.source + " " + arrow,
+        t.guard && "guard: " + t.guard, t.action && "action: " + t.action,
+        metadataText(t.metadata)]);
+    });
+    model.states.forEach(function (s) {
+      (s.branches || []).forEach(function (b) { if (b.guard) { names[b.guard] = true; } });
+    });
+
+    Object.keys(names).sort().forEach(function (name) {
+      var li = element("li"), label = element("label"), input = element("input");
+      input.type = "checkbox";
+      input.checked = true;
+      input.onchange = function () { guards[name] = input.checked; };
+      label.appendChild(input);
+      label.appendChild(document.createTextNode(" " + name + " passes"));
+      li.appendChild(label);
+      li.setAttribute("data-search", name.toLowerCase());
+      $("fsm-guards").appendChild(li);
+    });
+
+    $("fsm-search").oninput = function () {
+      var query = this.value.trim().toLowerCase();
+      var items = document.querySelectorAll("aside li[data-search]");
+      for (var i = 0; i < items.length; i++) {
+        var match = !query || items[i].getAttribute("data-search").indexOf(query) >= 0;
+        items[i].classList.toggle("hidden", !match);
+      }
+      eachNode(function (node, state) {
+        node.classList.toggle("match", query !== "" && state.toLowerCase().indexOf(query) >= 0);
+      });
+    };
+    $("fsm-reset").onclick = reset;
+  }
+
+  build();
+  reset();
+})();
+`
@@ -0,0 +1,172 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestExportHTML(t *testing.T) {
+	var buf bytes.Buffer
+	fsm := newTrickyFSM()
+	if err := fsm.ExportHTML(&buf, VisualizeOptions{Name: "<tricky>"}); err != nil {
+		t.Fatal(err)
+	}
+
+	output := buf.String()
+	if !strings.HasPrefix(output, "<!DOCTYPE html>") {
+		t.Errorf("expect the HTML document, but got '%s'", output[:32])
+	}
+	if !strings.Contains(output, "<title>&lt;tricky&gt;</title>") {
+		t.Error("missing the escaped title")
+	}
+	if !strings.Contains(output, "<svg") {
+		t.Error("missing the SVG diagram")
+	}
+
+	// The page must work offline.
+	for _, s := range []string{"<script src", "<link", "https://", "@import"} {
+		if strings.Contains(output, s) {
+			t.Errorf("unexpected the external resource '%s'", s)
+		}
+	}
+	if strings.Count(output, "http://") != strings.Count(output, "http://www.w3.org/") {
+		t.Error("unexpected the external resource 'http://'")
+	}
+
+	data := htmlData(t, output)
+
+	var model htmlModel
+	if err := json.Unmarshal([]byte(data), &model); err != nil {
+		t.Fatalf("invalid data: %v", err)
+	}
+
+	if model.Name != "<tricky>" || model.Initial != `Say "Hi"` || model.Current != `Say "Hi"` {
+		t.Errorf("unexpected the model: %s, %s, %s", model.Name, model.Initial, model.Current)
+	}
+	if len(model.States) != len(fsm.validateStates()) {
+		t.Errorf("expect %d states, but got %d", len(fsm.validateStates()), len(model.States))
+	}
+	if len(model.Transitions) != len(fsm.Transitions()) {
+		t.Errorf("expect %d transitions, but got %d", len(fsm.Transitions()), len(model.Transitions))
+	}
+
+	for _, s := range model.States {
+		switch s.Name {
+		case "is ok?":
+			if s.Kind != "choice" || len(s.Branches) != 2 || s.Branches[0].Guard != `has "x"` || !s.Branches[1].Else {
+				t.Errorf("unexpected the choice: %+v", s)
+			}
+		case "end", "状态":
+			if !s.Final {
+				t.Errorf("expect the final state '%s'", s.Name)
+			}
+		}
+	}
+}
+
+// htmlData returns the JSON data of the state machine in the exported HTML.
+func htmlData(t *testing.T, output string) string {
+	const start = `<script type="application/json" id="fsm-data">`
+	index := strings.Index(output, start)
+	if index < 0 {
+		t.Fatal("missing the data of the state machine")
+	}
+	data := output[index+len(start):]
+	return data[:strings.Index(data, "</script>")]
+}
+
+// htmlDOM is the minimal DOM to run the script of the exported HTML in Node.js.
+const htmlDOM = `
+function Element() { this.children = []; this.text = ""; this.attrs = {}; }
+Object.defineProperty(Element.prototype, "textContent", {
+  get: function () { return this.text; },
+  set: function (text) { this.text = text; this.children = []; }
+});
+Object.defineProperty(Element.prototype, "firstChild", {
+  get: function () { return this.children[0] || null; }
+});
+Element.prototype.classList = { toggle: function () {} };
+Element.prototype.appendChild = function (e) { this.children.push(e); return e; };
+Element.prototype.setAttribute = function (k, v) { this.attrs[k] = v; };
+Element.prototype.getAttribute = function (k) { return this.attrs[k]; };
+
+var elements = {};
+var document = {
+  getElementById: function (id) {
+    if (id === "fsm-data") { return { textContent: DATA }; }
+    return elements[id] || (elements[id] = new Element());
+  },
+  createElement: function () { return new Element(); },
+  createTextNode: function () { return new Element(); },
+  querySelectorAll: function () { return []; }
+};
+`
+
+// runHTMLExplorer sends the events by clicking the buttons of the explorer
+// in the exported HTML, and returns the current state in the explorer.
+func runHTMLExplorer(t *testing.T, fsm *FSM, events ...Event) string {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("the explorer test requires Node.js")
+	}
+
+	var buf bytes.Buffer
+	if err := fsm.ExportHTML(&buf, VisualizeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := json.Marshal(htmlData(t, buf.String()))
+	sends, _ := json.Marshal(events)
+	program := "var DATA = " + string(data) + ";\n" + htmlDOM + htmlScript + `
+` + string(sends) + `.forEach(function (event) {
+  elements["fsm-events"].children.filter(function (b) {
+    return b.textContent === event;
+  })[0].onclick();
+});
+console.log(elements["fsm-current"].textContent);
+`
+
+	cmd := exec.Command(node)
+	cmd.Stdin = strings.NewReader(program)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("fail to run the script: %v\n%s", err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func TestExportHTMLElseFirst(t *testing.T) {
+	isOK := func(*FSM, interface{}) bool { return true }
+
+	fsm := New()
+	fsm.SetInitial("A")
+	fsm.AddChoice("C", Else("X"), When("Y", "isOK", isOK))
+	fsm.AddTransitions(Source("A").WithTarget("C").WithEvent("Go"))
+
+	if current := runHTMLExplorer(t, fsm, "Go"); current != "Y" {
+		t.Errorf("expect the explorer to go to 'Y', but got '%s'", current)
+	}
+
+	if err := fsm.SendEvent("Go", nil); err != nil {
+		t.Fatal(err)
+	} else if current := fsm.Current(); current != "Y" {
+		t.Errorf("expect SendEvent to go to 'Y', but got '%s'", current)
+	}
+}
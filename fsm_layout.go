@@ -0,0 +1,470 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "sort"
+
+// layoutPoint is a point of the layout.
+type layoutPoint struct{ X, Y float64 }
+
+// layoutNode is a node of the layered layout, which is either a state,
+// or a dummy node to route the edge across the layers.
+type layoutNode struct {
+	State  State
+	Dummy  bool
+	Width  float64 // The reserved width.
+	Height float64 // The reserved height.
+	X, Y   float64 // The center.
+
+	layer int
+	order int
+	up    []int // The neighbors in the previous layer.
+	down  []int // The neighbors in the next layer.
+}
+
+// layoutEdge is the edge routed through the layout, whose points are
+// from the center of the source to the center of the target.
+type layoutEdge struct {
+	visualEdge
+	Points []layoutPoint
+}
+
+// layoutConfig is the configuration of the layered layout.
+type layoutConfig struct {
+	Root       State   // The state to break the cycles firstly, such as the initial state.
+	Horizontal bool    // Lay out the layers from left to right instead of top to bottom.
+	Reverse    bool    // Lay out the layers from bottom to top, or right to left.
+	LayerGap   float64 // The gap between the layers.
+	NodeGap    float64 // The gap between the nodes in a layer.
+
+	// Size returns the size reserved for the state.
+	Size func(State) (width, height float64)
+}
+
+// graphLayout is the layered layout of the graph.
+type graphLayout struct {
+	Nodes  []*layoutNode // The states in turn, then the dummy nodes.
+	Edges  []layoutEdge  // Not including the self-loops.
+	Loops  []visualEdge  // The self-loops.
+	Width  float64
+	Height float64
+
+	index  map[State]int
+	layers [][]int
+}
+
+// Node returns the node of the state.
+func (l *graphLayout) Node(state State) *layoutNode { return l.Nodes[l.index[state]] }
+
+const layoutDummySize = 8
+
+// layoutGraph computes the layered layout (Sugiyama-style) of the states
+// and the edges between them by the steps:
+//
+//  1. Break the cycles by reversing the back edges found by DFS.
+//  2. Assign the layers by the longest path.
+//  3. Split the edges across the layers by the dummy nodes.
+//  4. Reduce the crossings by the barycenter heuristic.
+//  5. Assign the coordinates by the barycenters of the neighbors.
+//
+// The edges whose source or target is not in states are ignored.
+func layoutGraph(states []State, edges []visualEdge, c layoutConfig) *graphLayout {
+	l := &graphLayout{index: make(map[State]int, len(states))}
+	for i, state := range states {
+		width, height := c.Size(state)
+		l.Nodes = append(l.Nodes, &layoutNode{State: state, Width: width, Height: height})
+		l.index[state] = i
+	}
+
+	// 1. Break the cycles.
+	var flat []visualEdge
+	out := make([][]int, len(states))
+	for _, e := range edges {
+		u, ok1 := l.index[e.Source]
+		_, ok2 := l.index[e.Target]
+		switch {
+		case !ok1 || !ok2:
+		case e.Source == e.Target:
+			l.Loops = append(l.Loops, e)
+		default:
+			out[u] = append(out[u], len(flat))
+			flat = append(flat, e)
+		}
+	}
+
+	reversed := make([]bool, len(flat))
+	visited := make([]int, len(states)) // 0: unvisited, 1: visiting, 2: visited
+	var dfs func(int)
+	dfs = func(u int) {
+		visited[u] = 1
+		for _, i := range out[u] {
+			switch v := l.index[flat[i].Target]; visited[v] {
+			case 0:
+				dfs(v)
+			case 1:
+				reversed[i] = true
+			}
+		}
+		visited[u] = 2
+	}
+	if root, ok := l.index[c.Root]; ok {
+		dfs(root)
+	}
+	for u := range states {
+		if visited[u] == 0 {
+			dfs(u)
+		}
+	}
+
+	direct := func(i int) (u, v int) {
+		u, v = l.index[flat[i].Source], l.index[flat[i].Target]
+		if reversed[i] {
+			u, v = v, u
+		}
+		return
+	}
+
+	// 2. Assign the layers.
+	indegrees := make([]int, len(states))
+	successors := make([][]int, len(states))
+	for i := range flat {
+		u, v := direct(i)
+		successors[u] = append(successors[u], v)
+		indegrees[v]++
+	}
+
+	var queue []int
+	for u, indegree := range indegrees {
+		if indegree == 0 {
+			queue = append(queue, u)
+		}
+	}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		for _, v := range successors[u] {
+			if layer := l.Nodes[u].layer + 1; layer > l.Nodes[v].layer {
+				l.Nodes[v].layer = layer
+			}
+			if indegrees[v]--; indegrees[v] == 0 {
+				queue = append(queue, v)
+			}
+		}
+	}
+
+	// 3. Split the edges across the layers.
+	chains := make([][]int, len(flat))
+	for i := range flat {
+		u, v := direct(i)
+		chain := []int{u}
+		for layer := l.Nodes[u].layer + 1; layer < l.Nodes[v].layer; layer++ {
+			l.Nodes = append(l.Nodes, &layoutNode{Dummy: true, layer: layer,
+				Width: layoutDummySize, Height: layoutDummySize})
+			chain = append(chain, len(l.Nodes)-1)
+		}
+		chain = append(chain, v)
+
+		for j := 1; j < len(chain); j++ {
+			l.Nodes[chain[j-1]].down = append(l.Nodes[chain[j-1]].down, chain[j])
+			l.Nodes[chain[j]].up = append(l.Nodes[chain[j]].up, chain[j-1])
+		}
+		chains[i] = chain
+	}
+
+	for i, node := range l.Nodes {
+		for len(l.layers) <= node.layer {
+			l.layers = append(l.layers, nil)
+		}
+		node.order = len(l.layers[node.layer])
+		l.layers[node.layer] = append(l.layers[node.layer], i)
+	}
+
+	// 4. Reduce the crossings.
+	best, crossings := l.cloneLayers(), l.crossings()
+	for i := 0; i < 16 && crossings > 0; i++ {
+		if i%2 == 0 {
+			for layer := 1; layer < len(l.layers); layer++ {
+				l.sortLayer(layer, true)
+			}
+		} else {
+			for layer := len(l.layers) - 2; layer >= 0; layer-- {
+				l.sortLayer(layer, false)
+			}
+		}
+
+		if n := l.crossings(); n < crossings {
+			best, crossings = l.cloneLayers(), n
+		}
+	}
+	l.layers = best
+	for _, layer := range l.layers {
+		for order, i := range layer {
+			l.Nodes[i].order = order
+		}
+	}
+
+	// 5. Assign the coordinates.
+	l.assignCoordinates(c)
+	for i, e := range flat {
+		points := make([]layoutPoint, len(chains[i]))
+		for j, n := range chains[i] {
+			points[j] = layoutPoint{X: l.Nodes[n].X, Y: l.Nodes[n].Y}
+		}
+		if reversed[i] {
+			for j, k := 0, len(points)-1; j < k; j, k = j+1, k-1 {
+				points[j], points[k] = points[k], points[j]
+			}
+		}
+		l.Edges = append(l.Edges, layoutEdge{visualEdge: e, Points: points})
+	}
+	l.separateParallelEdges(c.Horizontal)
+
+	return l
+}
+
+func (l *graphLayout) cloneLayers() [][]int {
+	layers := make([][]int, len(l.layers))
+	for i, layer := range l.layers {
+		layers[i] = append([]int(nil), layer...)
+	}
+	return layers
+}
+
+// crossings returns the number of the crossings of the edge segments
+// between the adjacent layers.
+func (l *graphLayout) crossings() (count int) {
+	type segment struct{ from, to int }
+	for _, layer := range l.layers {
+		var segments []segment
+		for _, i := range layer {
+			for _, j := range l.Nodes[i].down {
+				segments = append(segments, segment{from: l.Nodes[i].order, to: l.Nodes[j].order})
+			}
+		}
+
+		for i := range segments {
+			for j := i + 1; j < len(segments); j++ {
+				if (segments[i].from-segments[j].from)*(segments[i].to-segments[j].to) < 0 {
+					count++
+				}
+			}
+		}
+	}
+	return
+}
+
+// nodesByKey sorts the indexes of the nodes by their keys.
+type nodesByKey struct {
+	nodes []int
+	keys  map[int]float64
+}
+
+func (s nodesByKey) Len() int           { return len(s.nodes) }
+func (s nodesByKey) Swap(i, j int)      { s.nodes[i], s.nodes[j] = s.nodes[j], s.nodes[i] }
+func (s nodesByKey) Less(i, j int) bool { return s.keys[s.nodes[i]] < s.keys[s.nodes[j]] }
+
+// sortLayer sorts the nodes in the layer by the barycenters of the orders
+// of their neighbors in the previous layer if byUp, or the next layer.
+func (l *graphLayout) sortLayer(layer int, byUp bool) {
+	nodes := l.layers[layer]
+	barycenters := make(map[int]float64, len(nodes))
+	for _, i := range nodes {
+		neighbors := l.Nodes[i].down
+		if byUp {
+			neighbors = l.Nodes[i].up
+		}
+
+		barycenters[i] = float64(l.Nodes[i].order)
+		if len(neighbors) > 0 {
+			var sum float64
+			for _, j := range neighbors {
+				sum += float64(l.Nodes[j].order)
+			}
+			barycenters[i] = sum / float64(len(neighbors))
+		}
+	}
+
+	sort.Stable(nodesByKey{nodes: nodes, keys: barycenters})
+	for order, i := range nodes {
+		l.Nodes[i].order = order
+	}
+}
+
+// assignCoordinates assigns the coordinates of the centers of the nodes,
+// which is along the main axis by the layers, and along the cross axis
+// by the orders in the layers.
+func (l *graphLayout) assignCoordinates(c layoutConfig) {
+	mainSize := func(n *layoutNode) float64 {
+		if c.Horizontal {
+			return n.Width
+		}
+		return n.Height
+	}
+	crossSize := func(n *layoutNode) float64 {
+		if c.Horizontal {
+			return n.Height
+		}
+		return n.Width
+	}
+
+	var mainEnd float64
+	mains := make([]float64, len(l.layers))
+	for k, layer := range l.layers {
+		var thickness float64
+		for _, i := range layer {
+			if size := mainSize(l.Nodes[i]); size > thickness {
+				thickness = size
+			}
+		}
+		if k > 0 {
+			mainEnd += c.LayerGap
+		}
+		mains[k] = mainEnd + thickness/2
+		mainEnd += thickness
+	}
+
+	crosses := make([]float64, len(l.Nodes))
+	for _, layer := range l.layers {
+		var end float64
+		for _, i := range layer {
+			size := crossSize(l.Nodes[i])
+			crosses[i] = end + size/2
+			end += size + c.NodeGap
+		}
+	}
+
+	// Move the nodes towards the barycenters of their neighbors,
+	// and keep the orders and the gaps.
+	place := func(layer []int, byUp bool) {
+		desired := make([]float64, len(layer))
+		for j, i := range layer {
+			neighbors := l.Nodes[i].down
+			if byUp {
+				neighbors = l.Nodes[i].up
+			}
+
+			desired[j] = crosses[i]
+			if len(neighbors) > 0 {
+				var sum float64
+				for _, n := range neighbors {
+					sum += crosses[n]
+				}
+				desired[j] = sum / float64(len(neighbors))
+			}
+		}
+
+		var shift float64
+		for j, i := range layer {
+			crosses[i] = desired[j]
+			if j > 0 {
+				prev := layer[j-1]
+				least := crosses[prev] + (crossSize(l.Nodes[prev])+crossSize(l.Nodes[i]))/2 + c.NodeGap
+				if crosses[i] < least {
+					crosses[i] = least
+				}
+			}
+			shift += desired[j] - crosses[i]
+		}
+
+		shift /= float64(len(layer))
+		for _, i := range layer {
+			crosses[i] += shift
+		}
+	}
+
+	for round := 0; round < 8; round++ {
+		if round%2 == 0 {
+			for k := 1; k < len(l.layers); k++ {
+				place(l.layers[k], true)
+			}
+		} else {
+			for k := len(l.layers) - 2; k >= 0; k-- {
+				place(l.layers[k], false)
+			}
+		}
+	}
+
+	crossStart, crossEnd := 0.0, 0.0
+	for i, n := range l.Nodes {
+		start, end := crosses[i]-crossSize(n)/2, crosses[i]+crossSize(n)/2
+		if i == 0 || start < crossStart {
+			crossStart = start
+		}
+		if i == 0 || end > crossEnd {
+			crossEnd = end
+		}
+	}
+
+	for i, n := range l.Nodes {
+		main, cross := mains[n.layer], crosses[i]-crossStart
+		if c.Reverse {
+			main = mainEnd - main
+		}
+
+		if c.Horizontal {
+			n.X, n.Y = main, cross
+		} else {
+			n.X, n.Y = cross, main
+		}
+	}
+
+	if c.Horizontal {
+		l.Width, l.Height = mainEnd, crossEnd-crossStart
+	} else {
+		l.Width, l.Height = crossEnd-crossStart, mainEnd
+	}
+}
+
+// separateParallelEdges bends the edges between the same adjacent nodes
+// apart, so that they do not overlap.
+func (l *graphLayout) separateParallelEdges(horizontal bool) {
+	type pair struct{ a, b State }
+	groups := make(map[pair][]int, len(l.Edges))
+	var keys []pair
+	for i, e := range l.Edges {
+		if len(e.Points) != 2 {
+			continue
+		}
+
+		key := pair{a: e.Source, b: e.Target}
+		if key.b < key.a {
+			key.a, key.b = key.b, key.a
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	const gap = 24
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+
+		for k, i := range group {
+			offset := (float64(k) - float64(len(group)-1)/2) * gap
+			e := &l.Edges[i]
+			mid := layoutPoint{X: (e.Points[0].X + e.Points[1].X) / 2, Y: (e.Points[0].Y + e.Points[1].Y) / 2}
+			if horizontal {
+				mid.Y += offset
+			} else {
+				mid.X += offset
+			}
+			e.Points = []layoutPoint{e.Points[0], mid, e.Points[1]}
+		}
+	}
+}
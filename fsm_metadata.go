@@ -0,0 +1,63 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// Name returns the name of the state machine.
+func (f *FSM) Name() string { return f.name }
+
+// SetName sets the name of the state machine.
+func (f *FSM) SetName(name string) { f.name = name }
+
+// Metadata returns a copy of the metadata of the state machine.
+func (f *FSM) Metadata() map[string]string { return cloneMetadata(f.metadata) }
+
+// SetMetadata sets the metadata key and value of the state machine.
+func (f *FSM) SetMetadata(key, value string) {
+	if f.metadata == nil {
+		f.metadata = make(map[string]string, 4)
+	}
+	f.metadata[key] = value
+}
+
+// StateMetadata returns a copy of the metadata of the state.
+func (f *FSM) StateMetadata(state State) map[string]string {
+	return cloneMetadata(f.stateMetadata[state])
+}
+
+// SetStateMetadata sets the metadata key and value of the state.
+func (f *FSM) SetStateMetadata(state State, key, value string) {
+	if f.stateMetadata == nil {
+		f.stateMetadata = make(map[State]map[string]string, 8)
+	}
+
+	metadata, ok := f.stateMetadata[state]
+	if !ok {
+		metadata = make(map[string]string, 4)
+		f.stateMetadata[state] = metadata
+	}
+	metadata[key] = value
+}
+
+func cloneMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	_metadata := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		_metadata[key] = value
+	}
+	return _metadata
+}
@@ -0,0 +1,164 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The colors of the heatmap of the transitions, whose colors are interpolated
+// from HeatColdColor to HeatHotColor by the traffic, and HeatUnusedColor
+// is the color of the transitions that are never used.
+const (
+	HeatColdColor   = "#4575b4"
+	HeatHotColor    = "#d73027"
+	HeatUnusedColor = "#bbbbbb"
+)
+
+// TransitionKey identifies the applied transition, whose Target is
+// the resolved state if the target of the transition is a pseudo state.
+type TransitionKey struct {
+	Source State
+	Event  Event
+	Target State
+}
+
+// Metrics counts the transitions applied by the state machines,
+// which is safe for the concurrent use.
+type Metrics struct {
+	lock   sync.Mutex
+	counts map[TransitionKey]uint64
+}
+
+// NewMetrics returns a new metrics of the transitions.
+func NewMetrics() *Metrics {
+	return &Metrics{counts: make(map[TransitionKey]uint64, 16)}
+}
+
+// Record counts the transition of the trace entry, which may be used
+// as the hook of OnTrace, such as
+//
+//	fsm.OnTrace(metrics.Record)
+//
+// or together with a Recorder by MultiTracer.
+func (m *Metrics) Record(e TraceEntry) {
+	m.lock.Lock()
+	m.counts[TransitionKey{Source: e.Source, Event: e.Event, Target: e.Target}]++
+	m.lock.Unlock()
+}
+
+// Count returns the number of the transition from the source state
+// by the event to any target.
+func (m *Metrics) Count(source State, event Event) (count uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for key, n := range m.counts {
+		if key.Source == source && key.Event == event {
+			count += n
+		}
+	}
+	return
+}
+
+// Counts returns the copy of the counters of the transitions,
+// which may be used as VisualizeOptions.Counts.
+func (m *Metrics) Counts() map[TransitionKey]uint64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	counts := make(map[TransitionKey]uint64, len(m.counts))
+	for key, count := range m.counts {
+		counts[key] = count
+	}
+	return counts
+}
+
+// Reset clears all the counters.
+func (m *Metrics) Reset() {
+	m.lock.Lock()
+	m.counts = make(map[TransitionKey]uint64, 16)
+	m.lock.Unlock()
+}
+
+// heatColor interpolates the color from HeatColdColor to HeatHotColor.
+func heatColor(ratio float64) string {
+	parse := func(color string) (rgb [3]float64) {
+		for i := range rgb {
+			v, _ := strconv.ParseUint(color[1+2*i:3+2*i], 16, 8)
+			rgb[i] = float64(v)
+		}
+		return
+	}
+
+	cold, hot := parse(HeatColdColor), parse(HeatHotColor)
+	var rgb [3]int
+	for i := range rgb {
+		rgb[i] = int(cold[i] + (hot[i]-cold[i])*ratio + 0.5)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2])
+}
+
+// edgeHeat is the style of the edge in the heatmap.
+type edgeHeat struct {
+	Color  string
+	Width  float64 // From 1 to 5.
+	Unused bool
+}
+
+// heat returns the style of the edge by its count relative to the maximum,
+// and false if the counts are not set.
+func (g visualGraph) heat(e visualEdge) (h edgeHeat, ok bool) {
+	switch {
+	case g.opts.Counts == nil:
+		return
+	case e.Count == 0:
+		return edgeHeat{Color: HeatUnusedColor, Width: 1, Unused: true}, true
+	default:
+		ratio := float64(e.Count) / float64(g.maxCount)
+		return edgeHeat{Color: heatColor(ratio), Width: 1 + 4*ratio}, true
+	}
+}
+
+// countEdges sets the counts of the edges, including the branches
+// passed through by the transitions to the pseudo states.
+func (g *visualGraph) countEdges() {
+	transitions := make(map[TransitionKey]uint64, len(g.opts.Counts))
+	branches := make(map[pseudoEdge]uint64, 4)
+	for key, count := range g.opts.Counts {
+		transitions[TransitionKey{Source: key.Source, Event: key.Event}] += count
+		if index := g.fsm.indexTransition(key.Source, key.Event); index > -1 {
+			for _, b := range g.fsm.pseudoPath(g.fsm.transitions[index].Target, key.Target) {
+				branches[b] += count
+			}
+		}
+	}
+
+	for i, e := range g.edges {
+		if e.Branch {
+			e.Count = branches[pseudoEdge{source: e.Source, target: e.Target}]
+		} else {
+			e.Count = transitions[TransitionKey{Source: e.Source, Event: e.Event}]
+		}
+		if e.Count > g.maxCount {
+			g.maxCount = e.Count
+		}
+
+		e.Label = strings.TrimSpace(fmt.Sprintf("%s (%d)", e.Label, e.Count))
+		g.edges[i] = e
+	}
+}
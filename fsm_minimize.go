@@ -0,0 +1,359 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// stateBehavior is the local behavior of a state, which consists of
+// the label of the state and its successors in order.
+type stateBehavior struct {
+	label      string
+	events     []Event // The sorted events, which is nil for the pseudo state.
+	successors []State
+}
+
+type stateClasses [][]State
+
+func (cs stateClasses) Len() int           { return len(cs) }
+func (cs stateClasses) Swap(i, j int)      { cs[i], cs[j] = cs[j], cs[i] }
+func (cs stateClasses) Less(i, j int) bool { return cs[i][0] < cs[j][0] }
+
+// behavior returns the local behavior of the state.
+//
+// The guards, the actions and the hooks are compared by their names.
+// If withActions is false, the actions and the hooks are ignored.
+func (f *FSM) behavior(state State, withActions bool) (b stateBehavior) {
+	var label bytes.Buffer
+	if f.IsFinal(state) {
+		label.WriteString("final;")
+	}
+
+	if p, ok := f.pseudos[state]; ok {
+		fmt.Fprintf(&label, "%s;", p.kind)
+		for _, branch := range p.branches {
+			fmt.Fprintf(&label, "%s;", branch.Label())
+			b.successors = append(b.successors, branch.Target)
+		}
+		b.label = label.String()
+		return
+	}
+
+	if withActions {
+		fmt.Fprintf(&label, "enter=%s;exit=%s;",
+			hookName(f.enterStates[state] != nil, f.enterNames[state]),
+			hookName(f.exitStates[state] != nil, f.exitNames[state]))
+	}
+
+	var transitions []Transition
+	for _, t := range f.transitions {
+		if t.Source == state {
+			transitions = append(transitions, t)
+		}
+	}
+	sort.Sort(sortedTransitions(transitions))
+
+	b.events = make([]Event, len(transitions))
+	for i, t := range transitions {
+		b.events[i] = t.Event
+		b.successors = append(b.successors, t.Target)
+		fmt.Fprintf(&label, "%s", transitionLabel(t, withActions))
+	}
+
+	b.label = label.String()
+	return
+}
+
+func transitionLabel(t Transition, withActions bool) string {
+	label := fmt.Sprintf("%s[%s]%s", t.Event, hookName(t.Guard != nil, t.GuardName), t.Kind)
+	if withActions {
+		label += "/" + hookName(t.Action != nil, t.ActionName)
+	}
+	return label + ";"
+}
+
+// hookName returns the name of the guard, action or hook, which is "?"
+// if it is set but has no name.
+func hookName(set bool, name string) string {
+	if set && name == "" {
+		return "?"
+	}
+	return name
+}
+
+// equivalenceClasses partitions the states, including the pseudo states,
+// into the classes of the equivalent states, and returns the representative
+// of the class of each state.
+//
+// The representative is the initial state, the current state, or the least
+// state in the class in turn.
+func (f *FSM) equivalenceClasses(withActions bool) map[State]State {
+	states := f.validateStates()
+	if f.current != "" && !hasState(states, f.current) {
+		states = append(states, f.current)
+		sortStates(states)
+	}
+
+	behaviors := make(map[State]stateBehavior, len(states))
+	for _, state := range states {
+		behaviors[state] = f.behavior(state, withActions)
+	}
+
+	// Refine the partition by the successors until it is stable.
+	classes := make(map[State]int, len(states))
+	count := partitionStates(states, classes, func(s State) string { return behaviors[s].label })
+	for {
+		last := classes
+		classes = make(map[State]int, len(states))
+		n := partitionStates(states, classes, func(s State) string {
+			key := fmt.Sprint(last[s])
+			for _, succ := range behaviors[s].successors {
+				key += fmt.Sprintf(",%d", last[succ])
+			}
+			return key
+		})
+
+		if n == count {
+			break
+		}
+		count = n
+	}
+
+	firsts := make(map[int]State, count)
+	for _, state := range states { // The states have been sorted.
+		if _, ok := firsts[classes[state]]; !ok {
+			firsts[classes[state]] = state
+		}
+	}
+	if f.current != "" {
+		firsts[classes[f.current]] = f.current
+	}
+	if f.initial != "" {
+		firsts[classes[f.initial]] = f.initial
+	}
+
+	reps := make(map[State]State, len(states))
+	for _, state := range states {
+		reps[state] = firsts[classes[state]]
+	}
+
+	return reps
+}
+
+func partitionStates(states []State, classes map[State]int, key func(State) string) int {
+	ids := make(map[string]int, len(states))
+	for _, state := range states {
+		k := key(state)
+		id, ok := ids[k]
+		if !ok {
+			id = len(ids)
+			ids[k] = id
+		}
+		classes[state] = id
+	}
+	return len(ids)
+}
+
+// EquivalentStates returns the classes of the equivalent states, each of which
+// has two states at least. Two states are equivalent if they have the same
+// transitions, that's, the same events, guards and kinds, to the equivalent
+// states, and the same finality. If withActions is true, the actions and
+// the hooks of the states are also compared as the labels.
+//
+// The guards, the actions and the hooks are compared by their names.
+func (f *FSM) EquivalentStates(withActions bool) (classes [][]State) {
+	reps := f.equivalenceClasses(withActions)
+	members := make(map[State][]State, len(reps))
+	for _, state := range f.validateStates() {
+		rep := reps[state]
+		members[rep] = append(members[rep], state)
+	}
+
+	for _, states := range members {
+		if len(states) > 1 {
+			classes = append(classes, states)
+		}
+	}
+
+	sort.Sort(stateClasses(classes))
+	return
+}
+
+// Minimize returns a new state machine by merging the equivalent states
+// into one, whose name is the initial state, the current state, or the least
+// state in the class in turn. See EquivalentStates.
+//
+// The unreachable states are not removed, and the state machine is not changed.
+func (f *FSM) Minimize(withActions bool) *FSM {
+	reps := f.equivalenceClasses(withActions)
+	rep := func(state State) State {
+		if r, ok := reps[state]; ok {
+			return r
+		}
+		return state
+	}
+
+	m := New()
+	m.exit, m.enter = f.exit, f.enter
+	m.transition, m.ondone = f.transition, f.ondone
+	m.transactional = f.transactional
+	m.name, m.metadata = f.name, cloneMetadata(f.metadata)
+	m.version, m.migrations = f.version, f.migrations
+	m.vars = cloneVars(f.vars)
+
+	for state, p := range f.pseudos {
+		if rep(state) != state {
+			continue
+		}
+
+		branches := make([]Branch, len(p.branches))
+		for i, b := range p.branches {
+			b.Target = rep(b.Target)
+			branches[i] = b
+		}
+		m.pseudos[state] = pseudoState{kind: p.kind, branches: branches}
+	}
+
+	for _, t := range f.transitions {
+		if rep(t.Source) == t.Source {
+			t.Target = rep(t.Target)
+			m.transitions = append(m.transitions, t)
+		}
+	}
+
+	for state, fn := range f.enterStates {
+		if rep(state) == state {
+			m.enterStates[state] = fn
+			if name := f.enterNames[state]; name != "" {
+				setStateName(&m.enterNames, state, name)
+			}
+		}
+	}
+	for state, fn := range f.exitStates {
+		if rep(state) == state {
+			m.exitStates[state] = fn
+			if name := f.exitNames[state]; name != "" {
+				setStateName(&m.exitNames, state, name)
+			}
+		}
+	}
+	for state, metadata := range f.stateMetadata {
+		if rep(state) == state {
+			for key, value := range metadata {
+				m.SetStateMetadata(state, key, value)
+			}
+		}
+	}
+
+	for _, state := range f.finals {
+		if state = rep(state); !hasState(m.finals, state) {
+			m.finals = append(m.finals, state)
+		}
+	}
+	if f.initial != "" {
+		m.initial = rep(f.initial)
+	}
+	if f.current != "" {
+		m.SetCurrent(rep(f.current))
+	}
+
+	return m
+}
+
+// Equivalent reports whether the state machines a and b have the same
+// behavior from their initial states, or the current states if no initial
+// states, ignoring the names of the states and the actions.
+//
+// If not, it returns the shortest sequence of the events that distinguishes
+// them, the last event of which is accepted differently by them, or which
+// leads to the states that differ in the finality or the branches.
+func Equivalent(a, b *FSM) ([]Event, bool) {
+	type pair struct{ a, b State }
+	type node struct {
+		pair
+		prev  int
+		event Event // Empty for the branch.
+	}
+
+	path := func(nodes []node, i int, last ...Event) (events []Event) {
+		for ; nodes[i].prev >= 0; i = nodes[i].prev {
+			if nodes[i].event != "" {
+				events = append(events, nodes[i].event)
+			}
+		}
+		for l, r := 0, len(events)-1; l < r; l, r = l+1, r-1 {
+			events[l], events[r] = events[r], events[l]
+		}
+		events = append(events, last...)
+		if events == nil {
+			events = []Event{}
+		}
+		return
+	}
+
+	start := func(f *FSM) State {
+		if f.initial != "" {
+			return f.initial
+		}
+		return f.current
+	}
+
+	first := pair{start(a), start(b)}
+	nodes := []node{{pair: first, prev: -1}}
+	visited := map[pair]struct{}{first: {}}
+	for i := 0; i < len(nodes); i++ {
+		ba := a.behavior(nodes[i].a, false)
+		bb := b.behavior(nodes[i].b, false)
+		if ba.label != bb.label {
+			// Find the first event that is accepted differently.
+			for j := 0; j < len(ba.events) || j < len(bb.events); j++ {
+				switch {
+				case j >= len(ba.events):
+					return path(nodes, i, bb.events[j]), false
+				case j >= len(bb.events), ba.events[j] < bb.events[j]:
+					return path(nodes, i, ba.events[j]), false
+				case ba.events[j] > bb.events[j]:
+					return path(nodes, i, bb.events[j]), false
+				}
+
+				ta, _ := a.GetTransition(nodes[i].a, ba.events[j])
+				tb, _ := b.GetTransition(nodes[i].b, bb.events[j])
+				if transitionLabel(ta, false) != transitionLabel(tb, false) {
+					return path(nodes, i, ba.events[j]), false
+				}
+			}
+			return path(nodes, i), false
+		}
+
+		for j := range ba.successors {
+			next := pair{ba.successors[j], bb.successors[j]}
+			if _, ok := visited[next]; ok {
+				continue
+			}
+
+			visited[next] = struct{}{}
+			n := node{pair: next, prev: i}
+			if ba.events != nil {
+				n.event = ba.events[j]
+			}
+			nodes = append(nodes, n)
+		}
+	}
+
+	return nil, true
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMinimizeRepresentative(t *testing.T) {
+	newFSM := func(initial State) *FSM {
+		fsm := New()
+		if initial != "" {
+			fsm.SetInitial(initial)
+		}
+		fsm.SetCurrent("B")
+		fsm.AddFinals("Z")
+		fsm.AddTransitions(
+			Source("A").WithTarget("Z").WithEvent("Go"),
+			Source("B").WithTarget("Z").WithEvent("Go"),
+			Source("C").WithTarget("Z").WithEvent("Go"),
+			Source("D").WithTarget("A").WithEvent("Back"),
+		)
+		return fsm
+	}
+
+	fsm := newFSM("C")
+
+	expect := [][]State{{"A", "B", "C"}}
+	if classes := fsm.EquivalentStates(false); !reflect.DeepEqual(classes, expect) {
+		t.Errorf("expect the classes %v, but got %v", expect, classes)
+	}
+
+	// The initial state takes precedence over the current state.
+	min := fsm.Minimize(false)
+	if initial, current := min.Initial(), min.Current(); initial != "C" || current != "C" {
+		t.Errorf("expect the initial and current state 'C', but got '%s' and '%s'", initial, current)
+	}
+
+	expects := []Transition{
+		{Source: "C", Target: "Z", Event: "Go"},
+		{Source: "D", Target: "C", Event: "Back"},
+	}
+	if transitions := min.Transitions(); !reflect.DeepEqual(transitions, expects) {
+		t.Errorf("expect the transitions %+v, but got %+v", expects, transitions)
+	}
+	if _, ok := Equivalent(fsm, min); !ok {
+		t.Errorf("expect the minimized state machine to be equivalent")
+	}
+
+	// The original state machine is not changed.
+	if n := len(fsm.Transitions()); n != 4 {
+		t.Errorf("expect 4 transitions, but got %d", n)
+	}
+
+	// The current state is the representative without the initial state.
+	if current := newFSM("").Minimize(false).Current(); current != "B" {
+		t.Errorf("expect the current state 'B', but got '%s'", current)
+	}
+}
+
+func TestMinimizeWithActions(t *testing.T) {
+	pay := func(*FSM, interface{}) bool { return true }
+
+	fsm := New()
+	fsm.SetInitial("Start")
+	fsm.AddFinals("Z")
+	fsm.OnEnterState("D", func(State) {})
+	fsm.AddTransitions(
+		Source("Start").WithTarget("A").WithEvent("ToA"),
+		Source("Start").WithTarget("C").WithEvent("ToC"),
+		Source("A").WithTarget("Z").WithEvent("Go").WithNamedAction("payByCard", pay),
+		Source("B").WithTarget("Z").WithEvent("Go").WithNamedAction("payByCash", pay),
+		Source("C").WithTarget("Z").WithEvent("Go"),
+		Source("D").WithTarget("Z").WithEvent("Go"),
+	)
+
+	expect := [][]State{{"A", "B", "C", "D"}}
+	if classes := fsm.EquivalentStates(false); !reflect.DeepEqual(classes, expect) {
+		t.Errorf("expect the classes %v, but got %v", expect, classes)
+	}
+
+	if classes := fsm.EquivalentStates(true); len(classes) != 0 {
+		t.Errorf("expect no classes with the actions, but got %v", classes)
+	}
+	if n := len(fsm.Minimize(true).Transitions()); n != 6 {
+		t.Errorf("expect 6 transitions with the actions, but got %d", n)
+	}
+}
+
+func TestEquivalentDifferences(t *testing.T) {
+	isPaid := func(*FSM, interface{}) bool { return true }
+
+	newFSM := func(final bool, guard string) *FSM {
+		fsm := New()
+		fsm.SetInitial("Draft")
+		if final {
+			fsm.AddFinals("Done")
+		}
+		fsm.AddChoice("Check", When("Done", guard, isPaid), Else("Draft"))
+		fsm.AddTransitions(Source("Draft").WithTarget("Check").WithEvent("Pay"))
+		return fsm
+	}
+
+	// Only the names of the states are different.
+	renamed := New()
+	renamed.SetInitial("New")
+	renamed.AddFinals("Closed")
+	renamed.AddChoice("Decide", When("Closed", "isPaid", isPaid), Else("New"))
+	renamed.AddTransitions(Source("New").WithTarget("Decide").WithEvent("Pay"))
+	if events, ok := Equivalent(newFSM(true, "isPaid"), renamed); !ok || events != nil {
+		t.Errorf("expect equivalent, but got %v", events)
+	}
+
+	cases := map[string]*FSM{
+		"finality": newFSM(false, "isPaid"),
+		"branches": newFSM(true, "isFree"),
+	}
+	for name, fsm := range cases {
+		events, ok := Equivalent(newFSM(true, "isPaid"), fsm)
+		if ok || !reflect.DeepEqual(events, []Event{"Pay"}) {
+			t.Errorf("%s: expect the distinguishing events [Pay], but got %v, %v", name, events, ok)
+		}
+	}
+
+	// The guards of the transitions are different.
+	a, b := New(), New()
+	a.SetInitial("Draft")
+	b.SetInitial("Draft")
+	a.AddTransitions(Source("Draft").WithTarget("Paid").WithEvent("Pay").WithGuard("isPaid", isPaid))
+	b.AddTransitions(Source("Draft").WithTarget("Paid").WithEvent("Pay"))
+	if events, ok := Equivalent(a, b); ok || !reflect.DeepEqual(events, []Event{"Pay"}) {
+		t.Errorf("expect the distinguishing events [Pay], but got %v, %v", events, ok)
+	}
+}
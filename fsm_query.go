@@ -0,0 +1,228 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// Query is used to query the paths among the states of the state machine.
+//
+// The branches of the pseudo states are traversed implicitly, so the paths
+// only consist of the events, and they never pass through a final state,
+// because the state machine does not accept any event after entering it.
+type Query struct {
+	fsm    *FSM
+	guards bool
+	data   interface{}
+}
+
+// Query returns a new query of the state machine, which ignores the guards
+// and regards all the transitions and branches as takable.
+func (f *FSM) Query() Query { return Query{fsm: f} }
+
+// WithGuards returns a new query which evaluates the guards of the transitions
+// and the branches with the data, and only takes the matched ones.
+//
+// Notice: the guards are called with the state machine as it is, so they
+// should only depend on the data.
+func (q Query) WithGuards(data interface{}) Query {
+	q.guards, q.data = true, data
+	return q
+}
+
+type queryStep struct {
+	Event  Event
+	Target State
+}
+
+// steps returns the events that the state can accept and the non-pseudo
+// states that they lead to.
+func (q Query) steps(state State) (steps []queryStep) {
+	if q.fsm.IsFinal(state) {
+		return nil
+	}
+
+	for _, t := range q.fsm.transitions {
+		if t.Source != state {
+			continue
+		}
+		if q.guards && t.Guard != nil && !t.Guard(q.fsm, q.data) {
+			continue
+		}
+
+		for _, target := range q.targets(t.Target) {
+			step := queryStep{Event: t.Event, Target: target}
+			if !hasQueryStep(steps, step) {
+				steps = append(steps, step)
+			}
+		}
+	}
+	return
+}
+
+// targets resolves the target to the non-pseudo states.
+func (q Query) targets(target State) []State {
+	if !q.fsm.IsPseudo(target) {
+		return []State{target}
+	}
+
+	if q.guards {
+		if target, ok := q.fsm.resolvePseudo(target, q.data, false); ok {
+			return []State{target}
+		}
+		return nil
+	}
+
+	var targets []State
+	visited := make(map[State]struct{}, len(q.fsm.pseudos))
+	var resolve func(State)
+	resolve = func(state State) {
+		if !q.fsm.IsPseudo(state) {
+			if !hasState(targets, state) {
+				targets = append(targets, state)
+			}
+			return
+		}
+
+		if _, ok := visited[state]; ok {
+			return
+		}
+		visited[state] = struct{}{}
+		for _, b := range q.fsm.pseudos[state].branches {
+			resolve(b.Target)
+		}
+	}
+	resolve(target)
+	return targets
+}
+
+func hasQueryStep(steps []queryStep, step queryStep) bool {
+	for _, s := range steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// PathTo returns the shortest sequence of the events from the state from
+// to the state to. If from is equal to to, return an empty path and true.
+//
+// Return false if there is no path between them.
+func (q Query) PathTo(from, to State) (events []Event, ok bool) {
+	type node struct {
+		state State
+		prev  int
+		event Event
+	}
+
+	nodes := []node{{state: from, prev: -1}}
+	visited := map[State]struct{}{from: {}}
+	for i := 0; i < len(nodes); i++ {
+		if nodes[i].state == to {
+			for j := i; nodes[j].prev >= 0; j = nodes[j].prev {
+				events = append(events, nodes[j].event)
+			}
+			for l, r := 0, len(events)-1; l < r; l, r = l+1, r-1 {
+				events[l], events[r] = events[r], events[l]
+			}
+			if events == nil {
+				events = []Event{}
+			}
+			return events, true
+		}
+
+		for _, step := range q.steps(nodes[i].state) {
+			if _, ok := visited[step.Target]; !ok {
+				visited[step.Target] = struct{}{}
+				nodes = append(nodes, node{state: step.Target, prev: i, event: step.Event})
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// AllPaths returns all the sequences of the events from the state from
+// to the state to, which do not visit any state twice and have at most
+// maxDepth events. If maxDepth is not positive, there is no limit.
+func (q Query) AllPaths(from, to State, maxDepth int) (paths [][]Event) {
+	if from == to {
+		return [][]Event{{}}
+	}
+
+	var events []Event
+	visited := map[State]struct{}{from: {}}
+
+	var walk func(State)
+	walk = func(state State) {
+		if maxDepth > 0 && len(events) >= maxDepth {
+			return
+		}
+
+		for _, step := range q.steps(state) {
+			if _, ok := visited[step.Target]; ok {
+				continue
+			}
+
+			events = append(events, step.Event)
+			if step.Target == to {
+				path := make([]Event, len(events))
+				copy(path, events)
+				paths = append(paths, path)
+			} else {
+				visited[step.Target] = struct{}{}
+				walk(step.Target)
+				delete(visited, step.Target)
+			}
+			events = events[:len(events)-1]
+		}
+	}
+
+	walk(from)
+	return
+}
+
+// ReachableFrom returns the sorted non-pseudo states which can be reached
+// from the given state by zero or more events, including the state itself.
+func (q Query) ReachableFrom(state State) []State {
+	states := []State{state}
+	for i := 0; i < len(states); i++ {
+		for _, step := range q.steps(states[i]) {
+			if !hasState(states, step.Target) {
+				states = append(states, step.Target)
+			}
+		}
+	}
+	sortStates(states)
+	return states
+}
+
+// CanReach reports whether the state to can be reached from the state from.
+func (q Query) CanReach(from, to State) bool {
+	_, ok := q.PathTo(from, to)
+	return ok
+}
+
+// PathTo is equal to f.Query().PathTo(from, to).
+func (f *FSM) PathTo(from, to State) ([]Event, bool) { return f.Query().PathTo(from, to) }
+
+// AllPaths is equal to f.Query().AllPaths(from, to, maxDepth).
+func (f *FSM) AllPaths(from, to State, maxDepth int) [][]Event {
+	return f.Query().AllPaths(from, to, maxDepth)
+}
+
+// ReachableFrom is equal to f.Query().ReachableFrom(state).
+func (f *FSM) ReachableFrom(state State) []State { return f.Query().ReachableFrom(state) }
+
+// CanReach is equal to f.Query().CanReach(from, to).
+func (f *FSM) CanReach(from, to State) bool { return f.Query().CanReach(from, to) }
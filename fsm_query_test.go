@@ -0,0 +1,120 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newQueryFSM() *FSM {
+	isRich := func(_ *FSM, data interface{}) bool { return data == "rich" }
+	isVIP := func(_ *FSM, data interface{}) bool { return data == "vip" }
+
+	fsm := New()
+	fsm.SetInitial("Draft")
+	fsm.AddFinals("Shipped")
+	fsm.AddChoice("Check", When("Paid", "isRich", isRich), Else("Failed"))
+	fsm.AddTransitions(
+		Source("Draft").WithTarget("Check").WithEvent("Pay"),
+		Source("Draft").WithTarget("Paid").WithEvent("Skip").WithGuard("isVIP", isVIP),
+		Source("Failed").WithTarget("Draft").WithEvent("Retry"),
+		Source("Paid").WithTarget("Shipped").WithEvent("Ship"),
+		Source("Shipped").WithTarget("Draft").WithEvent("Return"),
+	)
+	return fsm
+}
+
+func TestQuerySameState(t *testing.T) {
+	fsm := newQueryFSM()
+	if events, ok := fsm.PathTo("Draft", "Draft"); !ok || events == nil || len(events) != 0 {
+		t.Errorf("expect an empty path, but got %v, %v", events, ok)
+	}
+	if paths := fsm.AllPaths("Draft", "Draft", 0); !reflect.DeepEqual(paths, [][]Event{{}}) {
+		t.Errorf("expect one empty path, but got %v", paths)
+	}
+}
+
+func TestQueryPseudoStates(t *testing.T) {
+	fsm := newQueryFSM()
+	if events, ok := fsm.PathTo("Draft", "Failed"); !ok || !reflect.DeepEqual(events, []Event{"Pay"}) {
+		t.Errorf("expect the path [Pay], but got %v, %v", events, ok)
+	}
+	if events, ok := fsm.PathTo("Failed", "Shipped"); !ok || !reflect.DeepEqual(events, []Event{"Retry", "Pay", "Ship"}) {
+		t.Errorf("expect the path [Retry Pay Ship], but got %v, %v", events, ok)
+	}
+
+	// The pseudo state is passed through, but never reached.
+	if fsm.CanReach("Draft", "Check") {
+		t.Errorf("expect the pseudo state to be unreachable")
+	}
+	expect := []State{"Draft", "Failed", "Paid", "Shipped"}
+	if states := fsm.ReachableFrom("Draft"); !reflect.DeepEqual(states, expect) {
+		t.Errorf("expect the states %v, but got %v", expect, states)
+	}
+
+	// No event is accepted after entering the final state.
+	if fsm.CanReach("Shipped", "Draft") {
+		t.Errorf("expect no path from the final state")
+	}
+}
+
+func TestQueryAllPathsMaxDepth(t *testing.T) {
+	fsm := newQueryFSM()
+
+	expect := [][]Event{{"Pay", "Ship"}, {"Skip", "Ship"}}
+	if paths := fsm.AllPaths("Draft", "Shipped", 0); !reflect.DeepEqual(paths, expect) {
+		t.Errorf("expect the paths %v, but got %v", expect, paths)
+	}
+	if paths := fsm.AllPaths("Draft", "Shipped", 2); !reflect.DeepEqual(paths, expect) {
+		t.Errorf("expect the paths %v, but got %v", expect, paths)
+	}
+	if paths := fsm.AllPaths("Draft", "Shipped", 1); len(paths) != 0 {
+		t.Errorf("expect no paths within 1 event, but got %v", paths)
+	}
+
+	expect = [][]Event{{"Retry", "Pay", "Ship"}, {"Retry", "Skip", "Ship"}}
+	if paths := fsm.AllPaths("Failed", "Shipped", 3); !reflect.DeepEqual(paths, expect) {
+		t.Errorf("expect the paths %v, but got %v", expect, paths)
+	}
+	if paths := fsm.AllPaths("Failed", "Shipped", 2); len(paths) != 0 {
+		t.Errorf("expect no paths within 2 events, but got %v", paths)
+	}
+}
+
+func TestQueryWithGuards(t *testing.T) {
+	fsm := newQueryFSM()
+
+	rich := fsm.Query().WithGuards("rich")
+	if paths := rich.AllPaths("Draft", "Shipped", 0); !reflect.DeepEqual(paths, [][]Event{{"Pay", "Ship"}}) {
+		t.Errorf("expect the paths [[Pay Ship]], but got %v", paths)
+	}
+	if rich.CanReach("Draft", "Failed") {
+		t.Errorf("expect the else branch not to be taken")
+	}
+
+	vip := fsm.Query().WithGuards("vip")
+	if paths := vip.AllPaths("Draft", "Shipped", 0); !reflect.DeepEqual(paths, [][]Event{{"Skip", "Ship"}}) {
+		t.Errorf("expect the paths [[Skip Ship]], but got %v", paths)
+	}
+	if events, ok := vip.PathTo("Draft", "Failed"); !ok || !reflect.DeepEqual(events, []Event{"Pay"}) {
+		t.Errorf("expect the path [Pay], but got %v, %v", events, ok)
+	}
+
+	// The query without the guards is unchanged.
+	if paths := fsm.Query().AllPaths("Draft", "Shipped", 0); len(paths) != 2 {
+		t.Errorf("expect 2 paths, but got %v", paths)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// This file is the shared rendering layer of the visualizers, which assigns
+// the safe identifiers to the states and escapes the labels per format,
+// so that the display names are kept separately from the identifiers.
+
+// escapeGraphviz escapes s to be used in a double-quoted Graphviz string.
+func escapeGraphviz(s string) string {
+	if !strings.ContainsAny(s, "\\\"\r\n") {
+		return s
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(s) + 8)
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// mermaidEntities is the characters escaped as the Mermaid entity codes,
+// which break the Mermaid syntax in the labels.
+var mermaidEntities = map[rune]string{
+	'#':  "#35;",
+	'\\': "#92;",
+	'"':  "#quot;",
+	';':  "#59;",
+	'|':  "#124;",
+	'<':  "#lt;",
+	'>':  "#gt;",
+	'\n': "#10;",
+}
+
+// escapeMermaid escapes s to be used as the Mermaid label or the quoted text.
+func escapeMermaid(s string) string {
+	if !strings.ContainsAny(s, "#\\\";|<>\r\n") {
+		return s
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(s) + 16)
+	for _, r := range s {
+		if entity, ok := mermaidEntities[r]; ok {
+			b.WriteString(entity)
+		} else if r != '\r' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// unescapeMermaid is the reverse of escapeMermaid, which also decodes
+// the numeric entity codes, such as "#35;".
+func unescapeMermaid(s string) string {
+	if !strings.Contains(s, "#") {
+		return s
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(s))
+	for {
+		start := strings.IndexByte(s, '#')
+		if start < 0 {
+			break
+		}
+
+		end := strings.IndexByte(s[start:], ';')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		b.WriteString(s[:start])
+		switch code := s[start+1 : end]; code {
+		case "quot":
+			b.WriteByte('"')
+		case "lt":
+			b.WriteByte('<')
+		case "gt":
+			b.WriteByte('>')
+		case "amp":
+			b.WriteByte('&')
+		default:
+			if n, err := strconv.ParseUint(code, 10, 32); err == nil {
+				b.WriteRune(rune(n))
+			} else {
+				b.WriteString(s[start : end+1])
+			}
+		}
+		s = s[end+1:]
+	}
+
+	b.WriteString(s)
+	return b.String()
+}
+
+// mermaidKeywords is the words which cannot be used as the Mermaid identifiers.
+var mermaidKeywords = []string{"as", "class", "classdef", "click", "direction",
+	"end", "flowchart", "graph", "linkstyle", "note", "state", "style", "subgraph"}
+
+// isMermaidID reports whether the name can be used as the Mermaid identifier.
+func isMermaidID(name string) bool { return isSafeID(name, mermaidKeywords) }
+
+// isSafeID reports whether the name is an ASCII identifier and not one of
+// the lower-case keywords, case-insensitively.
+func isSafeID(name string, keywords []string) bool {
+	if name == "" || hasString(keywords, strings.ToLower(name)) {
+		return false
+	}
+
+	for i, r := range name {
+		switch {
+		case r == '_', 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z':
+		case '0' <= r && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// mermaidIDs assigns the Mermaid identifiers to the states, which are
+// the state names if they are valid, or "s0", "s1", ... instead.
+func mermaidIDs(states []State) map[State]string {
+	return assignIDs(states, isMermaidID)
+}
+
+// assignIDs assigns the identifiers to the states, which are the state names
+// if valid reports true, or "s0", "s1", ... instead.
+func assignIDs(states []State, valid func(string) bool) map[State]string {
+	ids := make(map[State]string, len(states))
+	used := make(map[string]struct{}, len(states))
+	for _, state := range states {
+		if valid(string(state)) {
+			ids[state] = string(state)
+			used[string(state)] = struct{}{}
+		}
+	}
+
+	var index int
+	for _, state := range states {
+		if _, ok := ids[state]; ok {
+			continue
+		}
+
+		for {
+			id := fmt.Sprintf("s%d", index)
+			index++
+			if _, ok := used[id]; !ok {
+				ids[state], used[id] = id, struct{}{}
+				break
+			}
+		}
+	}
+
+	return ids
+}
+
+// mermaidNodeText returns the text of the Mermaid flowchart node, which is
+// quoted if it contains any special character.
+func mermaidNodeText(name string) string {
+	if name != "" && name == strings.TrimSpace(name) &&
+		!strings.ContainsAny(name, "[](){}<>\"|#;&") {
+		return name
+	}
+	return `"` + escapeMermaid(name) + `"`
+}
+
+// appendStates appends the states which are not in ss.
+func appendStates(ss []State, states ...State) []State {
+	for _, state := range states {
+		if state != "" && !hasState(ss, state) {
+			ss = append(ss, state)
+		}
+	}
+	return ss
+}
+
+// isWideRune reports whether the rune is displayed in double width,
+// such as the CJK characters.
+func isWideRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hangul, unicode.Hiragana, unicode.Katakana) ||
+		(r >= 0xFF00 && r <= 0xFF60) || (r >= 0xFFE0 && r <= 0xFFE6)
+}
+
+// displayWidth returns the width of s displayed in the terminal.
+func displayWidth(s string) (width int) {
+	for _, r := range s {
+		if isWideRune(r) {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return
+}
@@ -0,0 +1,435 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// FormatSCXML is the W3C SCXML definition format.
+//
+// See https://www.w3.org/TR/scxml/
+const FormatSCXML = "scxml"
+
+const (
+	scxmlNamespace = "http://www.w3.org/2005/07/scxml"
+
+	// SCXMLExtNamespace is the namespace of the extension attributes of SCXML,
+	// which are used to reference the actions and hooks by the name, such as
+	// "fsm:action" of <transition>, "fsm:onenter" and "fsm:onexit" of <state>,
+	// and "fsm:version" of <scxml> for the version of the definition.
+	SCXMLExtNamespace = "https://github.com/xgfone/go-fsm"
+)
+
+type scxmlAny struct {
+	XMLName xml.Name
+}
+
+type scxmlDocument struct {
+	XMLName xml.Name `xml:"scxml"`
+	Name    string   `xml:"name,attr"`
+	Initial string   `xml:"initial,attr"`
+	Version string   `xml:"https://github.com/xgfone/go-fsm version,attr"`
+
+	Initials    []scxmlInitial `xml:"initial"`
+	States      []scxmlState   `xml:"state"`
+	Finals      []scxmlState   `xml:"final"`
+	Unsupported []scxmlAny     `xml:",any"`
+}
+
+type scxmlInitial struct {
+	Transitions []scxmlTransition `xml:"transition"`
+	Unsupported []scxmlAny        `xml:",any"`
+}
+
+type scxmlState struct {
+	XMLName xml.Name
+	ID      string `xml:"id,attr"`
+	Initial string `xml:"initial,attr"`
+	Kind    string `xml:"https://github.com/xgfone/go-fsm kind,attr"`
+	OnEnter string `xml:"https://github.com/xgfone/go-fsm onenter,attr"`
+	OnExit  string `xml:"https://github.com/xgfone/go-fsm onexit,attr"`
+
+	Transitions []scxmlTransition `xml:"transition"`
+	Unsupported []scxmlAny        `xml:",any"`
+}
+
+type scxmlTransition struct {
+	Event  string `xml:"event,attr"`
+	Cond   string `xml:"cond,attr"`
+	Target string `xml:"target,attr"`
+	Type   string `xml:"type,attr"`
+	Action string `xml:"https://github.com/xgfone/go-fsm action,attr"`
+	Kind   string `xml:"https://github.com/xgfone/go-fsm kind,attr"`
+
+	Unsupported []scxmlAny `xml:",any"`
+}
+
+// ParseSCXML parses the W3C SCXML document into the definition.
+//
+// It only supports the flat state machine, that's, the <state>, <final>
+// and <initial> children of <scxml>, and the <transition> children of <state>.
+// The initial state is the "initial" attribute of <scxml>, or the target of
+// the only <transition> of <initial>, or the first <state> by default.
+//
+// The "cond" attribute of <transition> is the name of the guard, and the
+// transition whose "type" is "internal" is the Internal transition, which
+// has no target or targets its source state. And the extension
+// attributes in the namespace SCXMLExtNamespace reference the action and
+// hooks by the name. A <state> that only has the eventless transitions
+// is parsed as the choice pseudo state, or the junction pseudo state
+// if its attribute "fsm:kind" is "junction".
+//
+// Any other construct, such as the nested states, <parallel>, <history>,
+// <datamodel>, or the executable content, returns an error.
+func ParseSCXML(r io.Reader) (def Definition, err error) {
+	var doc scxmlDocument
+	if err = xml.NewDecoder(r).Decode(&doc); err != nil {
+		return def, fmt.Errorf("scxml: %v", err)
+	}
+
+	if doc.XMLName.Space != "" && doc.XMLName.Space != scxmlNamespace {
+		return def, fmt.Errorf("scxml: unknown namespace '%s'", doc.XMLName.Space)
+	}
+	if len(doc.Unsupported) > 0 {
+		return def, fmt.Errorf("scxml: unsupported element <%s> in <scxml>",
+			doc.Unsupported[0].XMLName.Local)
+	}
+
+	def.Name = doc.Name
+	def.Initial = State(doc.Initial)
+	if doc.Version != "" {
+		if def.Version, err = strconv.Atoi(doc.Version); err != nil {
+			return def, fmt.Errorf("scxml: invalid version '%s'", doc.Version)
+		}
+	}
+	if len(doc.Initials) > 0 {
+		if def.Initial, err = doc.parseInitial(); err != nil {
+			return
+		}
+	}
+	if strings.Contains(string(def.Initial), " ") {
+		return def, fmt.Errorf("scxml: unsupported multiple initial states '%s'", def.Initial)
+	} else if def.Initial == "" && len(doc.States) > 0 {
+		def.Initial = State(doc.States[0].ID)
+	}
+
+	for _, s := range doc.Finals {
+		if err = s.checkFinal(); err != nil {
+			return
+		}
+		def.Finals = append(def.Finals, State(s.ID))
+		s.addHooks(&def)
+	}
+
+	for _, s := range doc.States {
+		if err = s.parse(&def); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (d scxmlDocument) parseInitial() (initial State, err error) {
+	switch {
+	case len(d.Initials) > 1:
+		return "", fmt.Errorf("scxml: unsupported multiple <initial> in <scxml>")
+	case d.Initial != "":
+		return "", fmt.Errorf("scxml: both the attribute 'initial' and <initial> are set in <scxml>")
+	}
+
+	i := d.Initials[0]
+	if len(i.Unsupported) > 0 {
+		return "", fmt.Errorf("scxml: unsupported element <%s> in <initial>", i.Unsupported[0].XMLName.Local)
+	} else if len(i.Transitions) != 1 {
+		return "", fmt.Errorf("scxml: <initial> must have only one <transition>")
+	}
+
+	t := i.Transitions[0]
+	switch {
+	case len(t.Unsupported) > 0:
+		return "", fmt.Errorf("scxml: unsupported element <%s> in the transition of <initial>",
+			t.Unsupported[0].XMLName.Local)
+	case t.Event != "" || t.Cond != "" || t.Action != "":
+		return "", fmt.Errorf("scxml: unsupported event, cond or action of the transition of <initial>")
+	case t.Target == "":
+		return "", fmt.Errorf("scxml: the transition of <initial> has no target")
+	}
+	return State(t.Target), nil
+}
+
+func (s scxmlState) checkFinal() error {
+	if s.ID == "" {
+		return fmt.Errorf("scxml: the id of <final> is empty")
+	}
+	if len(s.Unsupported) > 0 {
+		return fmt.Errorf("scxml: unsupported element <%s> in the final state '%s'",
+			s.Unsupported[0].XMLName.Local, s.ID)
+	}
+	if len(s.Transitions) > 0 {
+		return fmt.Errorf("scxml: the final state '%s' has the transitions", s.ID)
+	}
+	return nil
+}
+
+func (s scxmlState) parse(def *Definition) (err error) {
+	if s.ID == "" {
+		return fmt.Errorf("scxml: the id of <state> is empty")
+	}
+	if len(s.Unsupported) > 0 {
+		return fmt.Errorf("scxml: unsupported element <%s> in the state '%s'",
+			s.Unsupported[0].XMLName.Local, s.ID)
+	}
+	if s.Initial != "" {
+		return fmt.Errorf("scxml: unsupported compound state '%s'", s.ID)
+	}
+
+	var eventless int
+	for _, t := range s.Transitions {
+		if len(t.Unsupported) > 0 {
+			return fmt.Errorf("scxml: unsupported element <%s> in the transition of the state '%s'",
+				t.Unsupported[0].XMLName.Local, s.ID)
+		}
+		if strings.Contains(t.Target, " ") {
+			return fmt.Errorf("scxml: unsupported multiple targets '%s' in the state '%s'", t.Target, s.ID)
+		}
+		if t.Event == "" {
+			eventless++
+		}
+	}
+
+	switch {
+	case eventless == 0:
+	case eventless < len(s.Transitions):
+		return fmt.Errorf("scxml: unsupported state '%s' mixing the eventless transitions", s.ID)
+	default:
+		return s.parsePseudo(def)
+	}
+
+	if s.Kind != "" {
+		return fmt.Errorf("scxml: unexpected kind '%s' of the state '%s'", s.Kind, s.ID)
+	}
+
+	s.addHooks(def)
+	for _, t := range s.Transitions {
+		var kind TransitionKind
+		if err = kind.UnmarshalText([]byte(t.Kind)); err != nil {
+			return fmt.Errorf("scxml: %v in the state '%s'", err, s.ID)
+		}
+
+		target := State(t.Target)
+		switch t.Type {
+		case "", "external":
+		case "internal":
+			if target != "" && target != State(s.ID) {
+				return fmt.Errorf("scxml: unsupported internal transition from the state '%s' to another state '%s'",
+					s.ID, target)
+			} else if kind == Reentrant {
+				return fmt.Errorf("scxml: the internal transition of the state '%s' is reentrant", s.ID)
+			}
+			kind, target = Internal, ""
+		default:
+			return fmt.Errorf("scxml: unknown transition type '%s' in the state '%s'", t.Type, s.ID)
+		}
+
+		switch {
+		case target == "":
+			kind = Internal
+		case kind == Internal:
+			return fmt.Errorf("scxml: the internal transition of the state '%s' has the target", s.ID)
+		case kind == Reentrant:
+			if target != State(s.ID) {
+				return fmt.Errorf("scxml: the reentrant transition of the state '%s' has another target", s.ID)
+			}
+			target = ""
+		}
+
+		for _, event := range strings.Fields(t.Event) {
+			if !isSCXMLEvent(event) {
+				return fmt.Errorf("scxml: unsupported event descriptor '%s' in the state '%s'", event, s.ID)
+			}
+
+			def.Transitions = append(def.Transitions, TransitionDefinition{
+				Event:  Event(event),
+				Source: State(s.ID),
+				Target: target,
+				Kind:   kind,
+				Guard:  t.Cond,
+				Action: t.Action,
+			})
+		}
+	}
+
+	return
+}
+
+func (s scxmlState) addHooks(def *Definition) {
+	if s.OnEnter != "" || s.OnExit != "" {
+		def.States = append(def.States, StateDefinition{
+			Name:    State(s.ID),
+			OnEnter: s.OnEnter,
+			OnExit:  s.OnExit,
+		})
+	}
+}
+
+func (s scxmlState) parsePseudo(def *Definition) (err error) {
+	if s.OnEnter != "" || s.OnExit != "" {
+		return fmt.Errorf("scxml: unsupported hooks of the pseudo state '%s'", s.ID)
+	}
+
+	p := PseudoDefinition{Name: State(s.ID), Kind: Choice}
+	if s.Kind != "" {
+		if err = p.Kind.UnmarshalText([]byte(s.Kind)); err != nil {
+			return fmt.Errorf("scxml: %v in the state '%s'", err, s.ID)
+		}
+	}
+
+	p.Branches = make([]BranchDefinition, len(s.Transitions))
+	for i, t := range s.Transitions {
+		if t.Target == "" {
+			return fmt.Errorf("scxml: the eventless transition of the state '%s' has no target", s.ID)
+		}
+		if t.Action != "" {
+			return fmt.Errorf("scxml: unsupported action of the eventless transition in the state '%s'", s.ID)
+		}
+		if t.Type != "" && t.Type != "external" {
+			return fmt.Errorf("scxml: unsupported type '%s' of the eventless transition in the state '%s'",
+				t.Type, s.ID)
+		}
+		p.Branches[i] = BranchDefinition{Target: State(t.Target), Guard: t.Cond}
+	}
+
+	def.Pseudos = append(def.Pseudos, p)
+	return
+}
+
+// isSCXMLEvent reports whether the event can be used as the event descriptor
+// of the SCXML transition, which has no spaces and no wildcards.
+func isSCXMLEvent(event string) bool {
+	return event != "" && !strings.ContainsAny(event, "*") &&
+		!strings.HasSuffix(event, ".") && strings.IndexFunc(event, unicode.IsSpace) < 0
+}
+
+// MarshalSCXML marshals the definition to the W3C SCXML document.
+//
+// The pseudo states are marshaled as the states only with the eventless
+// transitions, and the metadata is ignored since SCXML does not support it.
+// It returns an error if an event is not a valid SCXML event descriptor,
+// such as containing the spaces or the wildcard "*".
+func MarshalSCXML(def Definition) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(1024)
+
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<scxml xmlns="` + scxmlNamespace + `" xmlns:fsm="` +
+		SCXMLExtNamespace + `" version="1.0"`)
+	writeXMLAttr(&buf, "name", def.Name)
+	if def.Version != 0 {
+		writeXMLAttr(&buf, "fsm:version", strconv.Itoa(def.Version))
+	}
+	writeXMLAttr(&buf, "initial", string(def.Initial))
+	buf.WriteString(">\n")
+
+	transitions := make(map[State][]TransitionDefinition, len(def.Transitions))
+	for _, t := range def.Transitions {
+		transitions[t.Source] = append(transitions[t.Source], t)
+	}
+
+	hooks := make(map[State]StateDefinition, len(def.States))
+	for _, s := range def.States {
+		hooks[s.Name] = s
+	}
+
+	for _, state := range getDefinitionStates(def) {
+		if hasState(def.Finals, state) {
+			if len(transitions[state]) > 0 {
+				return nil, fmt.Errorf("scxml: the final state '%s' has the transitions", state)
+			}
+
+			buf.WriteString(`  <final`)
+			writeXMLAttr(&buf, "id", string(state))
+			writeXMLAttr(&buf, "fsm:onenter", hooks[state].OnEnter)
+			writeXMLAttr(&buf, "fsm:onexit", hooks[state].OnExit)
+			buf.WriteString("/>\n")
+			continue
+		}
+
+		buf.WriteString(`  <state`)
+		writeXMLAttr(&buf, "id", string(state))
+		writeXMLAttr(&buf, "fsm:onenter", hooks[state].OnEnter)
+		writeXMLAttr(&buf, "fsm:onexit", hooks[state].OnExit)
+		if len(transitions[state]) == 0 {
+			buf.WriteString("/>\n")
+			continue
+		}
+
+		buf.WriteString(">\n")
+		for _, t := range transitions[state] {
+			if !isSCXMLEvent(string(t.Event)) {
+				return nil, fmt.Errorf("scxml: invalid event descriptor '%s' of the state '%s'", t.Event, state)
+			}
+
+			buf.WriteString(`    <transition`)
+			writeXMLAttr(&buf, "event", string(t.Event))
+			writeXMLAttr(&buf, "cond", t.Guard)
+			switch t.Kind {
+			case Internal:
+			case Reentrant:
+				writeXMLAttr(&buf, "target", string(t.Source))
+				writeXMLAttr(&buf, "fsm:kind", t.Kind.String())
+			default:
+				writeXMLAttr(&buf, "target", string(t.Target))
+			}
+			writeXMLAttr(&buf, "fsm:action", t.Action)
+			buf.WriteString("/>\n")
+		}
+		buf.WriteString("  </state>\n")
+	}
+
+	for _, p := range def.Pseudos {
+		buf.WriteString(`  <state`)
+		writeXMLAttr(&buf, "id", string(p.Name))
+		if p.Kind == Junction {
+			writeXMLAttr(&buf, "fsm:kind", p.Kind.String())
+		}
+		buf.WriteString(">\n")
+		for _, b := range p.Branches {
+			buf.WriteString(`    <transition`)
+			writeXMLAttr(&buf, "cond", b.Guard)
+			writeXMLAttr(&buf, "target", string(b.Target))
+			buf.WriteString("/>\n")
+		}
+		buf.WriteString("  </state>\n")
+	}
+
+	buf.WriteString("</scxml>\n")
+	return buf.Bytes(), nil
+}
+
+func writeXMLAttr(buf *bytes.Buffer, name, value string) {
+	if value != "" {
+		buf.WriteString(" " + name + `="`)
+		xml.EscapeText(buf, []byte(value))
+		buf.WriteString(`"`)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSCXML = `<?xml version="1.0" encoding="UTF-8"?>
+<scxml xmlns="http://www.w3.org/2005/07/scxml" xmlns:fsm="https://github.com/xgfone/go-fsm" version="1.0" name="order" fsm:version="2" initial="Pending">
+  <state id="Pending" fsm:onenter="logState">
+    <transition event="Review" target="Check" fsm:action="review"/>
+    <transition event="Remind" cond="canRemind"/>
+  </state>
+  <final id="Approved"/>
+  <final id="Rejected"/>
+  <state id="Check">
+    <transition cond="isPassed" target="Approved"/>
+    <transition target="Rejected"/>
+  </state>
+</scxml>
+`
+
+func TestSCXMLRoundTrip(t *testing.T) {
+	def, err := LoadDefinition(strings.NewReader(testSCXML), FormatSCXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsm, err := def.Build(testRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fsm.SendEvent("Review", 50); err != nil {
+		t.Fatal(err)
+	} else if current := fsm.Current(); current != "Rejected" {
+		t.Errorf("expect the state '%s', but got '%s'", "Rejected", current)
+	}
+
+	data, err := MarshalSCXML(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newdef, err := ParseSCXML(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(def, newdef) {
+		t.Errorf("expect the definition %+v, but got %+v", def, newdef)
+	}
+}
+
+func TestSCXMLMarshalEvent(t *testing.T) {
+	for _, event := range []Event{"pay", "order.paid", "pay_2"} {
+		def := Definition{Initial: "A", Transitions: []TransitionDefinition{
+			{Event: event, Source: "A", Target: "B"},
+		}}
+
+		data, err := MarshalSCXML(def)
+		if err != nil {
+			t.Errorf("%s: %v", event, err)
+			continue
+		}
+
+		newdef, err := ParseSCXML(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: %v", event, err)
+		} else if !reflect.DeepEqual(def.Transitions, newdef.Transitions) {
+			t.Errorf("%s: expect the transitions %+v, but got %+v", event, def.Transitions, newdef.Transitions)
+		}
+	}
+
+	for _, event := range []Event{"pay now", "[*]", "*", "order.", " pay", "pay\t", ""} {
+		def := Definition{Initial: "A", Transitions: []TransitionDefinition{
+			{Event: event, Source: "A", Target: "B"},
+		}}
+		if _, err := MarshalSCXML(def); err == nil {
+			t.Errorf("%q: expect an error, but got nil", event)
+		}
+	}
+}
+
+func TestSCXMLInitialAndType(t *testing.T) {
+	const doc = `<scxml xmlns="http://www.w3.org/2005/07/scxml">
+  <initial><transition target="B"/></initial>
+  <state id="A"><transition event="next" target="B"/></state>
+  <state id="B">
+    <transition event="stay" type="internal"/>
+    <transition event="self" type="internal" target="B"/>
+    <transition event="back" type="external" target="A"/>
+  </state>
+</scxml>`
+
+	def, err := ParseSCXML(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if def.Initial != "B" {
+		t.Errorf("expect the initial state '%s', but got '%s'", "B", def.Initial)
+	}
+
+	expects := []TransitionDefinition{
+		{Event: "next", Source: "A", Target: "B"},
+		{Event: "stay", Source: "B", Kind: Internal},
+		{Event: "self", Source: "B", Kind: Internal},
+		{Event: "back", Source: "B", Target: "A"},
+	}
+	if !reflect.DeepEqual(def.Transitions, expects) {
+		t.Errorf("expect the transitions %+v, but got %+v", expects, def.Transitions)
+	}
+}
+
+func TestSCXMLInvalid(t *testing.T) {
+	docs := map[string]string{
+		"internal":      `<scxml><state id="a"><transition event="e" type="internal" target="b"/></state></scxml>`,
+		"type":          `<scxml><state id="a"><transition event="e" type="other" target="b"/></state></scxml>`,
+		"initials":      `<scxml><initial><transition target="a"/></initial><initial><transition target="a"/></initial></scxml>`,
+		"initial-attr":  `<scxml initial="a"><initial><transition target="a"/></initial></scxml>`,
+		"initial-event": `<scxml><initial><transition event="e" target="a"/></initial></scxml>`,
+		"initial-empty": `<scxml><initial/></scxml>`,
+	}
+
+	for name, doc := range docs {
+		if _, err := ParseSCXML(strings.NewReader(doc)); err == nil {
+			t.Errorf("%s: expect an error, but got nil", name)
+		}
+	}
+}
+
+func TestSCXMLUnsupported(t *testing.T) {
+	docs := map[string]string{
+		"parallel":  `<scxml><parallel id="p"/></scxml>`,
+		"datamodel": `<scxml><datamodel/><state id="a"/></scxml>`,
+		"nested":    `<scxml><state id="a"><state id="b"/></state></scxml>`,
+		"onentry":   `<scxml><state id="a"><onentry/></state></scxml>`,
+		"content":   `<scxml><state id="a"><transition event="e" target="b"><log/></transition></state></scxml>`,
+		"targets":   `<scxml><state id="a"><transition event="e" target="b c"/></state></scxml>`,
+		"wildcard":  `<scxml><state id="a"><transition event="*" target="b"/></state></scxml>`,
+	}
+
+	for name, doc := range docs {
+		if _, err := ParseSCXML(strings.NewReader(doc)); err == nil {
+			t.Errorf("%s: expect an error, but got nil", name)
+		} else if !strings.Contains(err.Error(), "unsupported") {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// checkRestoreState returns an error if the state cannot be restored,
+// which is known if it is in states or states is empty.
+func (f *FSM) checkRestoreState(state State, states []State) error {
+	switch {
+	case state == "":
+		return errors.New("the state is empty")
+	case f.IsPseudo(state):
+		return fmt.Errorf("the state '%s' is a pseudo state", state)
+	case len(states) > 0 && !hasState(states, state):
+		return fmt.Errorf("the state '%s' is unknown", state)
+	default:
+		return nil
+	}
+}
+
+// Snapshot is the runtime snapshot of the state machine instance,
+// which may be persisted and restored later.
+type Snapshot struct {
+	State   State                  `json:"state"`
+	Vars    map[string]interface{} `json:"vars,omitempty"`
+	Version int                    `json:"version,omitempty"`
+}
+
+// Snapshot returns the snapshot of the current state and the extended state.
+//
+// Notice: the variables are copied shallowly.
+func (f *FSM) Snapshot() Snapshot {
+	return Snapshot{State: f.current, Vars: cloneVars(f.vars), Version: f.version}
+}
+
+// Restore restores the current state and the extended state from the snapshot
+// without calling any hook.
+//
+// If the version of the snapshot is older than the state machine, the state
+// is migrated by the migrations first. See SetMigrations.
+//
+// The snapshot is rejected if it is migrated to the empty state, a pseudo
+// state, or a state unknown to the state machine, the same as PlanMigration.
+func (f *FSM) Restore(s Snapshot) (err error) {
+	if s, err = f.Migrate(s); err == nil {
+		err = f.checkRestoreState(s.State, f.validateStates())
+	}
+	if err != nil {
+		return fmt.Errorf("invalid snapshot: %v", err)
+	}
+
+	f.SetCurrent(s.State)
+	f.SetVars(s.Vars)
+	return nil
+}
@@ -0,0 +1,424 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	svgMargin    = 20
+	svgFontSize  = 14
+	svgLabelSize = 12
+	svgLoopSize  = 24
+	svgLineSpace = 16
+)
+
+// svgStyle is the default styles of the SVG image.
+const svgStyle = `.state > rect, .state > polygon { fill: #ffffff; stroke: #333333; stroke-width: 1.5; }
+.state > text, .title { fill: #333333; }
+.edge > path { fill: none; stroke: #666666; stroke-width: 1.2; }
+.edge > text { fill: #333333; font-size: 12px; paint-order: stroke; stroke: #ffffff; stroke-width: 3px; }
+.start { fill: #333333; }
+`
+
+// svgNum formats the coordinate with at most one decimal.
+func svgNum(v float64) string {
+	// Round half away from zero like math.Round, which requires Go 1.10.
+	if v *= 10; v < 0 {
+		v = -math.Floor(-v + 0.5)
+	} else {
+		v = math.Floor(v + 0.5)
+	}
+	return strconv.FormatFloat(v/10, 'f', -1, 64)
+}
+
+// svgTextWidth estimates the width of the text in the sans-serif font.
+func svgTextWidth(s string, size float64) (width float64) {
+	for _, r := range s {
+		if isWideRune(r) {
+			width += size
+		} else {
+			width += size * 0.6
+		}
+	}
+	return
+}
+
+// svgShape returns the size of the shape of the state,
+// which is a diamond for the pseudo state, or a rounded rectangle.
+func svgShape(f *FSM, state State) (width, height float64, diamond bool) {
+	if f.IsPseudo(state) {
+		return svgTextWidth(string(state), svgFontSize) + 56, 48, true
+	}
+
+	width = svgTextWidth(string(state), svgFontSize) + 28
+	if width < 72 {
+		width = 72
+	}
+	return width, 36, false
+}
+
+// svgClip returns the point on the border of the shape centered at p
+// along the line from p to q.
+func svgClip(p, q layoutPoint, width, height float64, diamond bool) layoutPoint {
+	dx, dy := q.X-p.X, q.Y-p.Y
+	if dx == 0 && dy == 0 {
+		return p
+	}
+
+	var t float64
+	switch {
+	case diamond:
+		t = 1 / (math.Abs(dx)/(width/2) + math.Abs(dy)/(height/2))
+	case dx == 0:
+		t = height / 2 / math.Abs(dy)
+	case dy == 0:
+		t = width / 2 / math.Abs(dx)
+	default:
+		t = math.Min(width/2/math.Abs(dx), height/2/math.Abs(dy))
+	}
+
+	if t > 1 {
+		t = 1
+	}
+	return layoutPoint{X: p.X + t*dx, Y: p.Y + t*dy}
+}
+
+// svgBox is the bounding box of the elements of the SVG image.
+type svgBox struct {
+	set                    bool
+	minX, minY, maxX, maxY float64
+}
+
+func (b *svgBox) add(x1, y1, x2, y2 float64) {
+	if !b.set {
+		b.set, b.minX, b.minY, b.maxX, b.maxY = true, x1, y1, x2, y2
+		return
+	}
+	b.minX, b.minY = math.Min(b.minX, x1), math.Min(b.minY, y1)
+	b.maxX, b.maxY = math.Max(b.maxX, x2), math.Max(b.maxY, y2)
+}
+
+// addText adds the text centered at (x, y), or starting from x if start.
+func (b *svgBox) addText(text string, x, y, size float64, start bool) {
+	width := svgTextWidth(text, size)
+	if !start {
+		x -= width / 2
+	}
+	b.add(x, y-size/2, x+width, y+size/2)
+}
+
+// svgLoopReserve returns the space reserved beside the state for the self-loops.
+func svgLoopReserve(loops []visualEdge, horizontal bool) float64 {
+	reserve := (svgLoopSize+10*float64(len(loops)-1))*0.75 + 6
+	if horizontal {
+		return reserve + float64(len(loops))*svgLineSpace
+	}
+
+	var width float64
+	for _, e := range loops {
+		width = math.Max(width, svgTextWidth(e.Label, svgLabelSize))
+	}
+	return reserve + width
+}
+
+// RenderSVG renders the FSM as the SVG image with the options,
+// which is laid out by the built-in layered layout without the dependency
+// on Graphviz or Mermaid.
+//
+// The nodes of the states have the CSS classes, such as "state", "initial",
+// "final", "current", "choice" and the classes of StateClasses, whose styles
+// are ClassStyles. The state name is in the "data-state" attribute.
+func (f *FSM) RenderSVG(w io.Writer, opts VisualizeOptions) error {
+	g := f.visualGraph(opts)
+	initial := f.Initial()
+	if initial == "" {
+		initial = f.Current()
+	}
+	if !opts.visible(initial) {
+		initial = ""
+	}
+
+	states := appendStates(append([]State(nil), g.states...), g.terminations()...)
+	states = appendStates(states, initial)
+	sortStates(states)
+
+	horizontal := opts.Direction == "LR" || opts.Direction == "RL"
+	loops := make(map[State][]visualEdge, 4)
+	layerGap := 64.0
+	for _, e := range g.edges {
+		if e.Source == e.Target {
+			loops[e.Source] = append(loops[e.Source], e)
+		} else if horizontal {
+			layerGap = math.Max(layerGap, svgTextWidth(e.Label, svgLabelSize)+32)
+		}
+	}
+
+	l := layoutGraph(states, g.edges, layoutConfig{
+		Root:       initial,
+		Horizontal: horizontal,
+		Reverse:    opts.Direction == "RL" || opts.Direction == "BT",
+		LayerGap:   layerGap,
+		NodeGap:    32,
+		Size: func(state State) (width, height float64) {
+			width, height, _ = svgShape(f, state)
+			if ls := loops[state]; len(ls) > 0 {
+				if reserve := svgLoopReserve(ls, horizontal); horizontal {
+					height += 2 * reserve
+				} else {
+					width += 2 * reserve
+				}
+			}
+			return
+		},
+	})
+
+	var box svgBox
+	var body bytes.Buffer
+	box.add(0, 0, l.Width, l.Height)
+	writeSVGEdges(&body, &box, g, l)
+	for _, state := range states {
+		writeSVGLoops(&body, &box, g, l.Node(state), loops[state], horizontal)
+	}
+	if initial != "" {
+		sign := -1.0
+		if opts.Direction == "RL" || opts.Direction == "BT" {
+			sign = 1
+		}
+		writeSVGStart(&body, &box, f, l.Node(initial), horizontal, sign)
+	}
+	for _, state := range states {
+		writeSVGState(&body, g, l.Node(state))
+	}
+
+	if opts.Name != "" {
+		box.add(box.minX, box.minY-32, box.maxX, box.maxY)
+	}
+
+	dx, dy := svgMargin-box.minX, svgMargin-box.minY
+	width, height := box.maxX-box.minX+2*svgMargin, box.maxY-box.minY+2*svgMargin
+
+	var buf bytes.Buffer
+	buf.Grow(body.Len() + 1024)
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s" font-family="sans-serif" font-size="%d">`+"\n",
+		svgNum(width), svgNum(height), svgNum(width), svgNum(height), svgFontSize)
+	if opts.Name != "" {
+		fmt.Fprintf(&buf, "<title>%s</title>\n", html.EscapeString(opts.Name))
+	}
+	buf.WriteString("<style>\n")
+	buf.WriteString(svgStyle)
+	writeSVGClassStyles(&buf, opts.ClassStyles)
+	buf.WriteString("</style>\n")
+	buf.WriteString(`<defs><marker id="fsm-arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto"><path d="M 0 0 L 10 5 L 0 10 z" fill="#666666"/></marker></defs>` + "\n")
+	fmt.Fprintf(&buf, `<g transform="translate(%s,%s)">`+"\n", svgNum(dx), svgNum(dy))
+	if opts.Name != "" {
+		fmt.Fprintf(&buf, `<text class="title" x="%s" y="%s" text-anchor="middle" font-size="18">%s</text>`+"\n",
+			svgNum((box.minX+box.maxX)/2), svgNum(box.minY+18), html.EscapeString(opts.Name))
+	}
+	buf.Write(body.Bytes())
+	buf.WriteString("</g>\n</svg>\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeSVGClassStyles(buf *bytes.Buffer, styles map[string]string) {
+	classes := make([]string, 0, len(styles))
+	for class := range styles {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	for _, class := range classes {
+		style := strings.Replace(styles[class], ",", "; ", -1)
+		fmt.Fprintf(buf, ".%s > rect, .%s > polygon { %s; }\n", class, class, style)
+	}
+}
+
+// svgHeatStyle returns the style attribute of the edge in the heatmap.
+func svgHeatStyle(g visualGraph, e visualEdge) string {
+	h, ok := g.heat(e)
+	if !ok {
+		return ""
+	}
+
+	style := fmt.Sprintf(` style="stroke: %s; stroke-width: %s`, h.Color, svgNum(h.Width))
+	if h.Unused {
+		style += "; stroke-dasharray: 4 3"
+	}
+	return style + `"`
+}
+
+func writeSVGPath(buf *bytes.Buffer, points []layoutPoint, style string) {
+	buf.WriteString(`<path d="M`)
+	for i, p := range points {
+		if i > 0 {
+			buf.WriteString(" L")
+		}
+		fmt.Fprintf(buf, " %s %s", svgNum(p.X), svgNum(p.Y))
+	}
+	buf.WriteString(`"` + style + ` marker-end="url(#fsm-arrow)"/>`)
+}
+
+func writeSVGText(buf *bytes.Buffer, x, y float64, anchor, text string) {
+	fmt.Fprintf(buf, `<text x="%s" y="%s" text-anchor="%s" dominant-baseline="central">%s</text>`,
+		svgNum(x), svgNum(y), anchor, html.EscapeString(text))
+}
+
+func writeSVGEdges(buf *bytes.Buffer, box *svgBox, g visualGraph, l *graphLayout) {
+	f := g.fsm
+	for _, e := range l.Edges {
+		points := append([]layoutPoint(nil), e.Points...)
+		last := len(points) - 1
+
+		width, height, diamond := svgShape(f, e.Source)
+		points[0] = svgClip(e.Points[0], e.Points[1], width, height, diamond)
+		width, height, diamond = svgShape(f, e.Target)
+		points[last] = svgClip(e.Points[last], e.Points[last-1], width, height, diamond)
+
+		buf.WriteString(`<g class="edge">`)
+		writeSVGPath(buf, points, svgHeatStyle(g, e.visualEdge))
+		if e.Label != "" {
+			mid := points[len(points)/2]
+			if len(points)%2 == 0 {
+				prev := points[len(points)/2-1]
+				mid = layoutPoint{X: (prev.X + mid.X) / 2, Y: (prev.Y + mid.Y) / 2}
+			}
+			writeSVGText(buf, mid.X, mid.Y, "middle", e.Label)
+			box.addText(e.Label, mid.X, mid.Y, svgLabelSize, false)
+		}
+		buf.WriteString("</g>\n")
+	}
+}
+
+// writeSVGLoops writes the self-loops on the right of the state,
+// or below the state if horizontal.
+func writeSVGLoops(buf *bytes.Buffer, box *svgBox, g visualGraph, n *layoutNode,
+	loops []visualEdge, horizontal bool) {
+	if len(loops) == 0 {
+		return
+	}
+
+	width, height, _ := svgShape(g.fsm, n.State)
+	anchor := layoutPoint{X: n.X + width/2, Y: n.Y}         // The point on the border.
+	normal, tangent := layoutPoint{X: 1}, layoutPoint{Y: 1} // The directions.
+	if horizontal {
+		anchor = layoutPoint{X: n.X, Y: n.Y + height/2}
+		normal, tangent = tangent, normal
+	}
+
+	at := func(along, across float64) layoutPoint {
+		return layoutPoint{X: anchor.X + normal.X*along + tangent.X*across,
+			Y: anchor.Y + normal.Y*along + tangent.Y*across}
+	}
+
+	extent := (svgLoopSize+10*float64(len(loops)-1))*0.75 + 6
+	for k, e := range loops {
+		size := svgLoopSize + 10*float64(k)
+		p0, p3 := at(0, -6), at(0, 6)
+		p1, p2 := at(size, -6-size/2), at(size, 6+size/2)
+		fmt.Fprintf(buf, `<g class="edge"><path d="M %s %s C %s %s, %s %s, %s %s"%s marker-end="url(#fsm-arrow)"/>`,
+			svgNum(p0.X), svgNum(p0.Y), svgNum(p1.X), svgNum(p1.Y),
+			svgNum(p2.X), svgNum(p2.Y), svgNum(p3.X), svgNum(p3.Y), svgHeatStyle(g, e))
+		box.add(math.Min(p0.X, p1.X), math.Min(p1.Y, p2.Y), math.Max(p1.X, p2.X), math.Max(p1.Y, p2.Y))
+
+		if e.Label != "" {
+			offset := (float64(k) - float64(len(loops)-1)/2) * svgLineSpace
+			if horizontal {
+				p := layoutPoint{X: anchor.X, Y: anchor.Y + extent + svgLineSpace*(float64(k)+0.5)}
+				writeSVGText(buf, p.X, p.Y, "middle", e.Label)
+				box.addText(e.Label, p.X, p.Y, svgLabelSize, false)
+			} else {
+				p := layoutPoint{X: anchor.X + extent, Y: anchor.Y + offset}
+				writeSVGText(buf, p.X, p.Y, "start", e.Label)
+				box.addText(e.Label, p.X, p.Y, svgLabelSize, true)
+			}
+		}
+		buf.WriteString("</g>\n")
+	}
+}
+
+// writeSVGStart writes the start point which points to the initial state,
+// which is before the initial state if sign is -1, or after if 1.
+func writeSVGStart(buf *bytes.Buffer, box *svgBox, f *FSM, n *layoutNode,
+	horizontal bool, sign float64) {
+	width, height, diamond := svgShape(f, n.State)
+	center := layoutPoint{X: n.X, Y: n.Y}
+	start := layoutPoint{X: n.X, Y: n.Y + sign*(height/2+28)}
+	if horizontal {
+		start = layoutPoint{X: n.X + sign*(width/2+28), Y: n.Y}
+	}
+
+	end := svgClip(center, start, width, height, diamond)
+	from := svgClip(start, center, 12, 12, false)
+	fmt.Fprintf(buf, `<g class="edge"><circle class="start" cx="%s" cy="%s" r="6"/>`, svgNum(start.X), svgNum(start.Y))
+	writeSVGPath(buf, []layoutPoint{from, end}, "")
+	buf.WriteString("</g>\n")
+	box.add(start.X-6, start.Y-6, start.X+6, start.Y+6)
+}
+
+func writeSVGState(buf *bytes.Buffer, g visualGraph, n *layoutNode) {
+	f := g.fsm
+	classes := []string{"state"}
+	if f.IsPseudo(n.State) {
+		classes = append(classes, "choice")
+	}
+	if n.State == f.Initial() {
+		classes = append(classes, "initial")
+	}
+	if f.IsFinal(n.State) {
+		classes = append(classes, "final")
+	}
+	if n.State == f.Current() {
+		classes = append(classes, "current")
+	}
+	if class := g.opts.StateClasses[n.State]; class != "" {
+		classes = append(classes, class)
+	}
+
+	var style string
+	if _, color := g.highlight(n.State); color != "" {
+		style = fmt.Sprintf(` style="fill: %s"`, html.EscapeString(color))
+	}
+
+	fmt.Fprintf(buf, `<g class="%s" data-state="%s">`, html.EscapeString(strings.Join(classes, " ")),
+		html.EscapeString(string(n.State)))
+
+	width, height, diamond := svgShape(f, n.State)
+	x, y := n.X-width/2, n.Y-height/2
+	if diamond {
+		fmt.Fprintf(buf, `<polygon points="%s,%s %s,%s %s,%s %s,%s"%s/>`,
+			svgNum(n.X), svgNum(y), svgNum(x+width), svgNum(n.Y),
+			svgNum(n.X), svgNum(y+height), svgNum(x), svgNum(n.Y), style)
+	} else {
+		fmt.Fprintf(buf, `<rect x="%s" y="%s" width="%s" height="%s" rx="8"%s/>`,
+			svgNum(x), svgNum(y), svgNum(width), svgNum(height), style)
+		if f.IsFinal(n.State) {
+			fmt.Fprintf(buf, `<rect x="%s" y="%s" width="%s" height="%s" rx="5"%s/>`,
+				svgNum(x+4), svgNum(y+4), svgNum(width-8), svgNum(height-8), style)
+		}
+	}
+
+	writeSVGText(buf, n.X, n.Y, "middle", string(n.State))
+	buf.WriteString("</g>\n")
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+)
+
+func TestRenderSVG(t *testing.T) {
+	fsm := newTrickyFSM()
+	for _, direction := range []string{"", "LR", "RL", "BT"} {
+		var buf bytes.Buffer
+		opts := VisualizeOptions{Name: "tricky", Direction: direction, CurrentColor: "#aaaaaa"}
+		if err := fsm.RenderSVG(&buf, opts); err != nil {
+			t.Fatal(err)
+		}
+
+		states := make(map[string]bool)
+		decoder := xml.NewDecoder(&buf)
+		for {
+			token, err := decoder.Token()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: invalid SVG: %v", direction, err)
+			}
+
+			if start, ok := token.(xml.StartElement); ok && start.Name.Local == "g" {
+				for _, attr := range start.Attr {
+					if attr.Name.Local == "data-state" {
+						states[attr.Value] = true
+					}
+				}
+			}
+		}
+
+		for _, state := range fsm.validateStates() {
+			if !states[string(state)] {
+				t.Errorf("%s: missing the state '%s'", direction, state)
+			}
+		}
+	}
+}
+
+func TestLayoutGraph(t *testing.T) {
+	fsm := newTrickyFSM()
+	g := fsm.visualGraph(VisualizeOptions{})
+	for _, horizontal := range []bool{false, true} {
+		l := layoutGraph(g.states, g.edges, layoutConfig{
+			Root:       fsm.Initial(),
+			Horizontal: horizontal,
+			LayerGap:   64,
+			NodeGap:    32,
+			Size:       func(State) (float64, float64) { return 80, 40 },
+		})
+
+		// The states must not overlap.
+		for i, a := range l.Nodes {
+			for _, b := range l.Nodes[i+1:] {
+				if !a.Dummy && !b.Dummy && a.X-b.X < 80 && b.X-a.X < 80 && a.Y-b.Y < 40 && b.Y-a.Y < 40 {
+					t.Errorf("horizontal=%v: the states '%s' and '%s' overlap", horizontal, a.State, b.State)
+				}
+			}
+		}
+
+		// The edges of the chain from the initial state go forward.
+		source, target := l.Node(`Say "Hi"`), l.Node("Foo Bar")
+		if horizontal && source.X >= target.X || !horizontal && source.Y >= target.Y {
+			t.Errorf("horizontal=%v: expect the initial state before its target", horizontal)
+		}
+	}
+}
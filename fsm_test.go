@@ -0,0 +1,124 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransitionError(t *testing.T) {
+	fsm := New()
+	fsm.SetCurrent("A")
+	fsm.AddChoice("C", When("B", "never", func(*FSM, interface{}) bool { return false }))
+	fsm.AddTransitions(
+		Source("A").WithTarget("B").WithEvent("Suspend").
+			WithAction(func(*FSM, interface{}) bool { return false }),
+		Source("A").WithTarget("C").WithEvent("Branch"),
+	)
+
+	err := fsm.SendEvent("Missing", nil)
+	if !IsNoTransition(err) || IsSuspended(err) || IsNoBranch(err) {
+		t.Errorf("expect no transition, but got '%v'", err)
+	}
+
+	err = fsm.SendEvent("Suspend", nil)
+	if IsNoTransition(err) || !IsSuspended(err) || IsNoBranch(err) {
+		t.Errorf("expect the suspended transition, but got '%v'", err)
+	}
+
+	err = fsm.SendEvent("Branch", nil)
+	if IsNoTransition(err) || IsSuspended(err) || !IsNoBranch(err) {
+		t.Errorf("expect no branch, but got '%v'", err)
+	}
+}
+
+func TestResetReleasesDone(t *testing.T) {
+	fsm := New()
+	fsm.SetInitial("A")
+	fsm.AddFinals("B")
+
+	released := make(chan struct{})
+	done := fsm.Done()
+	go func() {
+		<-done
+		close(released)
+	}()
+
+	fsm.Reset()
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("the waiter of Done is not released by Reset")
+	}
+
+	if fsm.Done() == done {
+		t.Error("expect a new Done channel after Reset")
+	}
+}
+
+func TestTestEventDone(t *testing.T) {
+	fsm := New()
+	fsm.SetInitial("A")
+	fsm.AddFinals("B")
+	fsm.AddTransitions(
+		Source("A").WithTarget("B").WithEvent("Finish"),
+		Source("B").WithTarget("A").WithEvent("Restart"),
+	)
+
+	if !fsm.TestEvent("Finish") {
+		t.Error("expect the event 'Finish' to be allowed")
+	}
+
+	if err := fsm.SendEvent("Finish", nil); err != nil {
+		t.Fatal(err)
+	}
+	if fsm.TestEvent("Restart") {
+		t.Error("expect no event to be allowed after the machine is done")
+	}
+	if err := fsm.SendEvent("Restart", nil); err != ErrDone {
+		t.Errorf("expect ErrDone, but got '%v'", err)
+	}
+}
+
+func TestTestEventWith(t *testing.T) {
+	isPassed := func(f *FSM, data interface{}) bool { return data.(int) >= 60 }
+
+	fsm := New()
+	fsm.SetInitial("Pending")
+	fsm.AddJunction("Check", When("Approved", "isPassed", isPassed))
+	fsm.AddTransitions(
+		Source("Pending").WithTarget("Approved").WithEvent("Approve").WithGuard("isPassed", isPassed),
+		Source("Pending").WithTarget("Check").WithEvent("Review"),
+	)
+
+	for _, event := range []Event{"Approve", "Review"} {
+		if !fsm.TestEvent(event) {
+			t.Errorf("%s: expect the transition", event)
+		}
+		if fsm.TestEventWith(event, 50) {
+			t.Errorf("%s: expect the event to be rejected with 50", event)
+		} else if err := fsm.SendEvent(event, 50); err == nil {
+			t.Errorf("%s: expect SendEvent to reject the event with 50", event)
+		}
+		if !fsm.TestEventWith(event, 80) {
+			t.Errorf("%s: expect the event to be allowed with 80", event)
+		}
+	}
+
+	if fsm.TestEventWith("Missing", 80) {
+		t.Error("expect no transition for the event 'Missing'")
+	}
+}
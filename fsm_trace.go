@@ -0,0 +1,328 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceColor is the color of the path taken in the trace,
+// and TraceStateColor is the fill color of the visited states.
+const (
+	TraceColor      = "blue"
+	TraceStateColor = "lightblue"
+)
+
+// traceTimeLayout is the layout of the time in the trace diagrams.
+const traceTimeLayout = "2006-01-02 15:04:05.000"
+
+// TraceEntry is a transition applied by the state machine.
+//
+// For the internal transition, Target is the same as Source.
+// For the transition to a pseudo state, Target is the resolved state.
+type TraceEntry struct {
+	Event  Event     `json:"event"`
+	Source State     `json:"source"`
+	Target State     `json:"target"`
+	Time   time.Time `json:"time"`
+}
+
+// Trace is the recorded transitions in order.
+type Trace []TraceEntry
+
+// OnTrace sets a function that will be called after a transition is applied,
+// including the internal transition, which may be Recorder.Record.
+// Use MultiTracer to set more than one function, such as
+//
+//	fsm.OnTrace(MultiTracer(recorder.Record, metrics.Record))
+//
+// Notice: like the other hooks, it is not rolled back in the transaction.
+func (f *FSM) OnTrace(fn func(TraceEntry)) { f.tracer = fn }
+
+// MultiTracer returns a function to be used as the hook of OnTrace,
+// which calls the given functions in turn with the trace entry.
+func MultiTracer(fns ...func(TraceEntry)) func(TraceEntry) {
+	tracers := make([]func(TraceEntry), len(fns))
+	copy(tracers, fns)
+	return func(e TraceEntry) {
+		for _, fn := range tracers {
+			fn(e)
+		}
+	}
+}
+
+func (f *FSM) trace(event Event, source, target State) {
+	if f.tracer != nil {
+		f.tracer(TraceEntry{Event: event, Source: source, Target: target, Time: time.Now()})
+	}
+}
+
+// Recorder records the transitions of the state machines as the trace,
+// which is safe for the concurrent use.
+type Recorder struct {
+	lock  sync.Mutex
+	trace Trace
+	limit int
+}
+
+// NewRecorder returns a new recorder which keeps the last limit entries.
+// If limit is 0, all the entries are kept.
+func NewRecorder(limit int) *Recorder {
+	if limit < 0 {
+		panic("the limit of the recorder must not be negative")
+	}
+	return &Recorder{limit: limit}
+}
+
+// Record records the trace entry, which may be used as the hook of OnTrace.
+func (r *Recorder) Record(e TraceEntry) {
+	r.lock.Lock()
+	r.trace = append(r.trace, e)
+	if r.limit > 0 && len(r.trace) > r.limit {
+		r.trace = append(r.trace[:0], r.trace[len(r.trace)-r.limit:]...)
+	}
+	r.lock.Unlock()
+}
+
+// Trace returns the copy of the recorded trace.
+func (r *Recorder) Trace() Trace {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append(Trace(nil), r.trace...)
+}
+
+// Reset clears the recorded trace.
+func (r *Recorder) Reset() {
+	r.lock.Lock()
+	r.trace = nil
+	r.lock.Unlock()
+}
+
+// traceTimelineEntry is the entry of the JSON timeline.
+type traceTimelineEntry struct {
+	Step int `json:"step"`
+	TraceEntry
+	Elapsed string `json:"elapsed,omitempty"`
+}
+
+// MarshalTimeline returns the JSON timeline of the trace, each entry of which
+// has the step starting at 1, and the duration elapsed since the last entry.
+func (t Trace) MarshalTimeline() ([]byte, error) {
+	entries := make([]traceTimelineEntry, len(t))
+	for i, e := range t {
+		entries[i] = traceTimelineEntry{Step: i + 1, TraceEntry: e}
+		if i > 0 && !e.Time.IsZero() && !t[i-1].Time.IsZero() {
+			entries[i].Elapsed = e.Time.Sub(t[i-1].Time).String()
+		}
+	}
+	return json.MarshalIndent(entries, "", "  ")
+}
+
+// sequenceKeywords is the words which cannot be used as the participant
+// identifiers of the Mermaid sequence diagram.
+var sequenceKeywords = []string{"activate", "actor", "alt", "and", "as",
+	"autonumber", "box", "break", "create", "critical", "deactivate", "destroy",
+	"else", "end", "left", "link", "links", "loop", "note", "of", "opt",
+	"option", "over", "par", "participant", "rect", "right", "sequencediagram",
+	"title"}
+
+// isSequenceID reports whether the name can be used as the participant
+// identifier of the Mermaid sequence diagram.
+func isSequenceID(name string) bool { return isSafeID(name, sequenceKeywords) }
+
+// VisualizeMermaidSequenceDiagram outputs the trace in Mermaid sequence
+// diagram format, whose participants are the states in the order
+// of the first occurrence, and whose messages are the numbered events.
+//
+// See https://mermaid.js.org/syntax/sequenceDiagram.html
+func (t Trace) VisualizeMermaidSequenceDiagram() string {
+	var states []State
+	for _, e := range t {
+		states = appendStates(states, e.Source, e.Target)
+	}
+	ids := assignIDs(states, isSequenceID)
+
+	var buf bytes.Buffer
+	buf.Grow(256)
+	buf.WriteString("sequenceDiagram\n")
+	buf.WriteString("    autonumber\n")
+	for _, state := range states {
+		if id := ids[state]; id == string(state) {
+			fmt.Fprintf(&buf, "    participant %s\n", id)
+		} else {
+			fmt.Fprintf(&buf, "    participant %s as %s\n", id, escapeMermaid(string(state)))
+		}
+	}
+	for _, e := range t {
+		label := string(e.Event)
+		if !e.Time.IsZero() {
+			label += " (" + e.Time.Format(traceTimeLayout) + ")"
+		}
+		fmt.Fprintf(&buf, "    %s->>%s: %s\n", ids[e.Source], ids[e.Target], escapeMermaid(label))
+	}
+
+	return buf.String()
+}
+
+// VisualizeTraceGraphviz outputs a visualization of a FSM in Graphviz format
+// with the options, which highlights the path taken in the trace with
+// TraceColor, and the visited states with TraceStateColor. The label of
+// each taken edge has the numbers of the steps, such as "Pay (1, 3)".
+//
+// The transitions in the trace that are not in the state machine,
+// such as from the old version, are drawn as the dashed edges.
+func (f *FSM) VisualizeTraceGraphviz(t Trace, opts VisualizeOptions) string {
+	g := f.visualGraph(opts)
+
+	type edgeKey struct {
+		source, target State
+		event          Event
+	}
+
+	steps := make(map[edgeKey][]string, len(t))
+	visited := make(map[State]bool, len(t)*2)
+	var unknowns []edgeKey
+	for i, e := range t {
+		step := fmt.Sprint(i + 1)
+		visited[e.Source], visited[e.Target] = true, true
+
+		index := f.indexTransition(e.Source, e.Event)
+		if index < 0 {
+			key := edgeKey{source: e.Source, target: e.Target, event: e.Event}
+			if _, ok := steps[key]; !ok {
+				unknowns = append(unknowns, key)
+			}
+			steps[key] = append(steps[key], step)
+			continue
+		}
+
+		target := f.transitions[index].Target
+		key := edgeKey{source: e.Source, target: target, event: e.Event}
+		steps[key] = append(steps[key], step)
+
+		// The branches of the pseudo states to the resolved target.
+		for _, b := range f.pseudoPath(target, e.Target) {
+			visited[b.source], visited[b.target] = true, true
+			key := edgeKey{source: b.source, target: b.target}
+			steps[key] = append(steps[key], step)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(256)
+
+	writeHeaderLine(&buf, opts.Name)
+	if opts.Direction != "" {
+		fmt.Fprintf(&buf, "    rankdir = %s;\n", opts.Direction)
+	}
+
+	writeEdge := func(e visualEdge, steps []string, dashed bool) {
+		label := e.Label
+		if len(steps) > 0 {
+			label = strings.TrimSpace(label + " (" + strings.Join(steps, ", ") + ")")
+		}
+
+		fmt.Fprintf(&buf, `    "%s" -> "%s" [ label = "%s"`, escapeGraphviz(string(e.Source)),
+			escapeGraphviz(string(e.Target)), escapeGraphviz(label))
+		if len(steps) > 0 {
+			fmt.Fprintf(&buf, `, color = "%s", fontcolor = "%s", penwidth = 2`, TraceColor, TraceColor)
+		}
+		if dashed {
+			buf.WriteString(`, style = "dashed"`)
+		}
+		buf.WriteString(" ];\n")
+	}
+
+	for _, e := range g.edges {
+		key := edgeKey{source: e.Source, target: e.Target, event: e.Event}
+		writeEdge(e, steps[key], false)
+	}
+	for _, key := range unknowns {
+		if opts.visible(key.source) && opts.visible(key.target) {
+			e := visualEdge{Source: key.source, Target: key.target, Label: string(key.event)}
+			writeEdge(e, steps[key], true)
+		}
+	}
+
+	states := append([]State(nil), g.states...)
+	for _, key := range unknowns {
+		for _, state := range []State{key.source, key.target} {
+			if opts.visible(state) && !hasState(states, state) {
+				states = append(states, state)
+			}
+		}
+	}
+
+	buf.WriteString("\n")
+	for _, s := range states {
+		var attrs []string
+		if f.IsPseudo(s) {
+			attrs = append(attrs, "shape = diamond")
+		}
+
+		if _, color := g.highlight(s); color != "" {
+			attrs = append(attrs, fmt.Sprintf(`style = filled, fillcolor = "%s"`, escapeGraphviz(color)))
+		} else if visited[s] {
+			attrs = append(attrs, fmt.Sprintf(`style = filled, fillcolor = "%s"`, TraceStateColor))
+		}
+
+		if len(attrs) == 0 {
+			fmt.Fprintf(&buf, `    "%s";`+"\n", escapeGraphviz(string(s)))
+		} else {
+			fmt.Fprintf(&buf, `    "%s" [ %s ];`+"\n", escapeGraphviz(string(s)), strings.Join(attrs, ", "))
+		}
+	}
+	writeFooter(&buf)
+
+	return buf.String()
+}
+
+type pseudoEdge struct{ source, target State }
+
+// pseudoPath returns the branches from the pseudo state from to the state to,
+// which is empty if from is not a pseudo state or to is not reachable.
+func (f *FSM) pseudoPath(from, to State) []pseudoEdge {
+	if !f.IsPseudo(from) {
+		return nil
+	}
+
+	visited := map[State]bool{from: true}
+	var search func(State) []pseudoEdge
+	search = func(state State) []pseudoEdge {
+		_, branches := f.Pseudo(state)
+		for _, b := range branches {
+			if b.Target == to {
+				return []pseudoEdge{{source: state, target: to}}
+			}
+		}
+
+		for _, b := range branches {
+			if !visited[b.Target] && f.IsPseudo(b.Target) {
+				visited[b.Target] = true
+				if path := search(b.Target); path != nil {
+					return append([]pseudoEdge{{source: state, target: b.Target}}, path...)
+				}
+			}
+		}
+		return nil
+	}
+
+	return search(from)
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder(2)
+	for _, event := range []Event{"A", "B", "C"} {
+		r.Record(TraceEntry{Event: event, Source: "S", Target: "T"})
+	}
+
+	if trace := r.Trace(); len(trace) != 2 || trace[0].Event != "B" || trace[1].Event != "C" {
+		t.Errorf("expect the last 2 entries, but got %+v", trace)
+	}
+
+	r.Reset()
+	if trace := r.Trace(); len(trace) != 0 {
+		t.Errorf("expect no entries, but got %+v", trace)
+	}
+}
+
+func TestMultiTracer(t *testing.T) {
+	fsm := New()
+	fsm.SetInitial("Pending")
+	fsm.AddTransitions(Source("Pending").WithTarget("Paid").WithEvent("Pay"))
+
+	recorder, metrics := NewRecorder(0), NewMetrics()
+	fsm.OnTrace(MultiTracer(recorder.Record, metrics.Record))
+	if err := fsm.SendEvent("Pay", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if trace := recorder.Trace(); len(trace) != 1 || trace[0].Target != "Paid" {
+		t.Errorf("expect the recorded transition to Paid, but got %+v", trace)
+	}
+	if count := metrics.Count("Pending", "Pay"); count != 1 {
+		t.Errorf("expect the count 1, but got %d", count)
+	}
+}
+
+func TestTraceMarshalTimeline(t *testing.T) {
+	start := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	trace := Trace{
+		{Event: "Pay", Source: "Pending", Target: "Paid", Time: start},
+		{Event: "Ship", Source: "Paid", Target: "Shipped", Time: start.Add(90 * time.Second)},
+	}
+
+	data, err := trace.MarshalTimeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := `[
+  {
+    "step": 1,
+    "event": "Pay",
+    "source": "Pending",
+    "target": "Paid",
+    "time": "2022-05-01T10:00:00Z"
+  },
+  {
+    "step": 2,
+    "event": "Ship",
+    "source": "Paid",
+    "target": "Shipped",
+    "time": "2022-05-01T10:01:30Z",
+    "elapsed": "1m30s"
+  }
+]`
+	if string(data) != expect {
+		t.Errorf("expect\n%s\nbut got\n%s", expect, data)
+	}
+
+	sequence := trace.VisualizeMermaidSequenceDiagram()
+	if !strings.Contains(sequence, "Paid->>Shipped: Ship (2022-05-01 10:01:30.000)\n") {
+		t.Errorf("unexpected sequence diagram:\n%s", sequence)
+	}
+}
+
+func TestVisualizeMermaidSequenceDiagramKeywords(t *testing.T) {
+	trace := Trace{
+		{Event: "Start", Source: "Pending", Target: "loop"},
+		{Event: "Stop", Source: "loop", Target: "End"},
+	}
+
+	expect := `sequenceDiagram
+    autonumber
+    participant Pending
+    participant s0 as loop
+    participant s1 as End
+    Pending->>s0: Start
+    s0->>s1: Stop
+`
+	if output := trace.VisualizeMermaidSequenceDiagram(); output != expect {
+		t.Errorf("expect\n%s\nbut got\n%s", expect, output)
+	}
+}
+
+func TestVisualizeTraceGraphvizUnknown(t *testing.T) {
+	fsm := New()
+	Source("Pending").WithTarget("Paid").WithEvent("Pay").Add(fsm)
+
+	trace := Trace{
+		{Event: "Pay", Source: "Pending", Target: "Paid"},
+		{Event: "Refund", Source: "Paid", Target: "Refunded"},
+	}
+
+	expect := `digraph fsm {
+    "Pending" -> "Paid" [ label = "Pay (1)", color = "blue", fontcolor = "blue", penwidth = 2 ];
+    "Paid" -> "Refunded" [ label = "Refund (2)", color = "blue", fontcolor = "blue", penwidth = 2, style = "dashed" ];
+
+    "Paid" [ style = filled, fillcolor = "lightblue" ];
+    "Pending" [ style = filled, fillcolor = "lightblue" ];
+    "Refunded" [ style = filled, fillcolor = "lightblue" ];
+}
+`
+	if output := fsm.VisualizeTraceGraphviz(trace, VisualizeOptions{}); output != expect {
+		t.Errorf("expect\n%s\nbut got\n%s", expect, output)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// SetTransactional sets whether SendEvent is transactional, which is false
+// by default.
+//
+// In the transactional mode, all the transitions within one SendEvent call,
+// including the chained ones by SetEvent, are applied atomically. That's,
+// if any transition fails, such as being suspended by the action or no
+// transition for the chained event, the current state and the extended
+// state are rolled back to the snapshot before calling SendEvent, and all
+// the compensations registered by Compensate are called in the reverse order.
+//
+// Notice: the hooks, such as OnEnter and OnExit, have been called and are not
+// rolled back, and the extended state variables are copied shallowly.
+// And the done notification is deferred until the transaction is committed.
+func (f *FSM) SetTransactional(transactional bool) { f.transactional = transactional }
+
+// Transactional reports whether SendEvent is transactional.
+func (f *FSM) Transactional() bool { return f.transactional }
+
+// Compensate registers a compensation function, which will be called
+// when the current transactional SendEvent is rolled back.
+//
+// It should be called in the action. If not in the transaction, do nothing.
+func (f *FSM) Compensate(compensation func()) {
+	if f.intx && compensation != nil {
+		f.compensations = append(f.compensations, compensation)
+	}
+}
+
+func (f *FSM) sendEventTx(event Event, data interface{}) (err error) {
+	snapshot := f.Snapshot()
+
+	var committed bool
+	f.intx = true
+	defer func() {
+		compensations := f.compensations
+		f.intx, f.compensations = false, nil
+
+		if err != nil || !committed { // Failure or panic
+			for i := len(compensations) - 1; i >= 0; i-- {
+				compensations[i]()
+			}
+			f.current = snapshot.State
+			f.SetVars(snapshot.Vars)
+		} else if f.IsDone() && f.ondone != nil {
+			f.ondone(f.current)
+		}
+
+		f.updateDone()
+	}()
+
+	err = f.SendEvent(event, data)
+	committed = true
+	return
+}
@@ -0,0 +1,202 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTransactional(t *testing.T) {
+	fsm := New()
+	if fsm.Transactional() {
+		t.Errorf("expect non-transactional by default")
+	}
+
+	fsm.SetTransactional(true)
+	if !fsm.Transactional() {
+		t.Errorf("expect transactional")
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	var compensations []string
+	compensate := func(name string) func() {
+		return func() { compensations = append(compensations, name) }
+	}
+
+	fsm := New()
+	fsm.SetCurrent("A")
+	fsm.SetTransactional(true)
+	fsm.SetVars(map[string]interface{}{"count": 0, "keep": "value"})
+	fsm.AddTransitions(
+		Source("A").WithTarget("B").WithEvent("ToB").WithAction(func(fsm *FSM, _ interface{}) bool {
+			fsm.SetVar("count", 1)
+			fsm.SetVar("added", true)
+			fsm.DelVar("keep")
+			fsm.Compensate(compensate("ToB"))
+			fsm.SetEvent("ToC", nil)
+			return true
+		}),
+		Source("B").WithTarget("C").WithEvent("ToC").WithAction(func(fsm *FSM, _ interface{}) bool {
+			fsm.SetVar("count", 2)
+			fsm.Compensate(compensate("ToC"))
+			fsm.SetEvent("ToD", nil)
+			return true
+		}),
+		Source("C").WithTarget("D").WithEvent("ToD").WithAction(func(*FSM, interface{}) bool {
+			return false // Fail halfway.
+		}),
+	)
+
+	if err := fsm.SendEvent("ToB", nil); !IsSuspended(err) {
+		t.Errorf("expect the suspended error, but got %v", err)
+	}
+
+	if current := fsm.Current(); current != "A" {
+		t.Errorf("expect the state A, but got '%s'", current)
+	}
+	if expect := []string{"ToC", "ToB"}; !reflect.DeepEqual(compensations, expect) {
+		t.Errorf("expect the compensations %v, but got %v", expect, compensations)
+	}
+	if vars, expect := fsm.Vars(), map[string]interface{}{"count": 0, "keep": "value"}; !reflect.DeepEqual(vars, expect) {
+		t.Errorf("expect the vars %v, but got %v", expect, vars)
+	}
+
+	// Compensate does nothing out of the transaction.
+	compensations = nil
+	fsm.SetTransactional(false)
+	fsm.Compensate(compensate("none"))
+	if err := fsm.SendEvent("ToB", nil); !IsSuspended(err) {
+		t.Errorf("expect the suspended error, but got %v", err)
+	} else if current := fsm.Current(); current != "C" {
+		t.Errorf("expect the state C, but got '%s'", current)
+	} else if len(compensations) != 0 {
+		t.Errorf("expect no compensations, but got %v", compensations)
+	}
+}
+
+func TestTransactionChainNoTransition(t *testing.T) {
+	fsm := New()
+	fsm.SetCurrent("A")
+	fsm.SetTransactional(true)
+	fsm.AddTransitions(Source("A").WithTarget("B").WithEvent("ToB").
+		WithAction(func(fsm *FSM, _ interface{}) bool {
+			fsm.SetEvent("Missing", nil)
+			return true
+		}))
+
+	if err := fsm.SendEvent("ToB", nil); !IsNoTransition(err) {
+		t.Errorf("expect no transition, but got %v", err)
+	} else if current := fsm.Current(); current != "A" {
+		t.Errorf("expect the state A, but got '%s'", current)
+	}
+}
+
+func TestTransactionPanic(t *testing.T) {
+	var compensated bool
+	fsm := New()
+	fsm.SetCurrent("A")
+	fsm.SetTransactional(true)
+	fsm.SetVar("count", 0)
+	fsm.AddTransitions(Source("A").WithTarget("B").WithEvent("ToB").
+		WithAction(func(fsm *FSM, _ interface{}) bool {
+			fsm.SetVar("count", 1)
+			fsm.Compensate(func() { compensated = true })
+			panic("action panics")
+		}))
+
+	func() {
+		defer func() {
+			if r := recover(); r != "action panics" {
+				t.Errorf("expect the panic, but got %v", r)
+			}
+		}()
+		_ = fsm.SendEvent("ToB", nil)
+	}()
+
+	if !compensated {
+		t.Errorf("expect the compensation to be called")
+	}
+	if current := fsm.Current(); current != "A" {
+		t.Errorf("expect the state A, but got '%s'", current)
+	}
+	if count := fsm.Var("count"); count != 0 {
+		t.Errorf("expect the count 0, but got %v", count)
+	}
+
+	// The transaction is over, so it can be sent again.
+	fsm.AddTransitions(Source("A").WithTarget("B").WithEvent("ToB"))
+	if err := fsm.SendEvent("ToB", nil); err != nil {
+		t.Error(err)
+	} else if current := fsm.Current(); current != "B" {
+		t.Errorf("expect the state B, but got '%s'", current)
+	}
+}
+
+func TestTransactionDone(t *testing.T) {
+	isClosed := func(done <-chan struct{}) bool {
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}
+
+	var finals []State
+	var fail bool
+	fsm := New()
+	fsm.SetCurrent("A")
+	fsm.SetTransactional(true)
+	fsm.AddFinals("Z")
+	fsm.OnDone(func(final State) { finals = append(finals, final) })
+	fsm.AddTransitions(Source("A").WithTarget("Z").WithEvent("Finish"))
+
+	done := fsm.Done()
+	fsm.OnEnterState("Z", func(State) {
+		if isClosed(done) || len(finals) > 0 {
+			t.Errorf("expect the done notification to wait until the commit")
+		}
+		if fail {
+			panic("enter fails")
+		}
+	})
+
+	// Roll back by the panic after entering the final state.
+	fail = true
+	func() {
+		defer func() { _ = recover() }()
+		_ = fsm.SendEvent("Finish", nil)
+	}()
+	if current := fsm.Current(); current != "A" {
+		t.Errorf("expect the state A, but got '%s'", current)
+	}
+	if isClosed(done) || len(finals) > 0 {
+		t.Errorf("expect no done notification after the rollback")
+	}
+
+	// Commit.
+	fail = false
+	if err := fsm.SendEvent("Finish", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !isClosed(done) {
+		t.Errorf("expect the done channel to be closed after the commit")
+	}
+	if len(finals) != 1 || finals[0] != "Z" {
+		t.Errorf("expect OnDone to be called once with Z, but got %v", finals)
+	}
+}
@@ -0,0 +1,450 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FindingKind is the kind of the finding reported by Validate.
+type FindingKind uint8
+
+const (
+	// UnreachableState means that the state cannot be reached
+	// from the initial state.
+	UnreachableState FindingKind = iota + 1
+
+	// DeadEndState means that the state is not final but no transition
+	// leaves it, so the state machine is stuck once entering it.
+	DeadEndState
+
+	// UnusableEvent means that the event can never trigger any transition,
+	// because all its sources are unreachable or final.
+	UnusableEvent
+
+	// ShadowedBranch means that the branch of the pseudo state can never
+	// be taken, because an earlier branch always matches in its place.
+	ShadowedBranch
+
+	// PseudoLoop means that the pseudo states form a loop by the branches,
+	// which fails to resolve the target if the branches keep taking the loop.
+	PseudoLoop
+
+	// ShadowedTransition means that the transition is replaced by a later one
+	// with the same source and event, so it can never be taken, which is
+	// typically a duplicate in the definition.
+	ShadowedTransition
+
+	// ChainLoop means that the events declared by the Chains of the transitions
+	// form a loop, so SendEvent may never return if the actions keep setting
+	// the events by SetEvent.
+	ChainLoop
+)
+
+func (k FindingKind) String() string {
+	switch k {
+	case UnreachableState:
+		return "unreachable-state"
+	case DeadEndState:
+		return "dead-end-state"
+	case UnusableEvent:
+		return "unusable-event"
+	case ShadowedBranch:
+		return "shadowed-branch"
+	case PseudoLoop:
+		return "pseudo-loop"
+	case ShadowedTransition:
+		return "shadowed-transition"
+	case ChainLoop:
+		return "chain-loop"
+	default:
+		return fmt.Sprintf("FindingKind(%d)", k)
+	}
+}
+
+// Finding is a problem of the state machine found by Validate.
+type Finding struct {
+	Kind    FindingKind
+	State   State // The state that the finding is about, which may be empty.
+	Event   Event // The event that the finding is about, which may be empty.
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s", f.Kind, f.Message)
+}
+
+type sortedFindings []Finding
+
+func (fs sortedFindings) Len() int      { return len(fs) }
+func (fs sortedFindings) Swap(i, j int) { fs[i], fs[j] = fs[j], fs[i] }
+func (fs sortedFindings) Less(i, j int) bool {
+	switch {
+	case fs[i].Kind != fs[j].Kind:
+		return fs[i].Kind < fs[j].Kind
+	case fs[i].State != fs[j].State:
+		return fs[i].State < fs[j].State
+	default:
+		return fs[i].Event < fs[j].Event
+	}
+}
+
+// Validate checks the transitions of the state machine statically
+// and returns the findings sorted by the kind, the state and the event.
+//
+// The reachability is computed from the initial state, or the current state
+// if no initial state is set, and it is skipped if neither is set.
+// The dead-end states are only checked when the final states are declared,
+// because all the states without the outgoing transitions are regarded as
+// the terminations otherwise.
+//
+// Since there is neither the wildcard nor the priority of the transitions,
+// a transition is only shadowed by the later one with the same source and
+// event, which replaces it. See AddTransitions.
+//
+// The events set by SetEvent in the actions are decided by the code,
+// so the loops of them are only found by the events declared by the Chains
+// of the transitions. See Transition.WithChains.
+func (f *FSM) Validate() []Finding {
+	var findings []Finding
+	findings = f.validateReachability(findings)
+	findings = f.validateDeadEnds(findings)
+	findings = f.validateBranches(findings)
+	findings = f.validatePseudoLoops(findings)
+	findings = f.validateShadowedTransitions(findings)
+	findings = f.validateChainLoops(findings)
+	sort.Stable(sortedFindings(findings))
+	return findings
+}
+
+func (f *FSM) validateReachability(findings []Finding) []Finding {
+	start := f.startState()
+	if start == "" {
+		return findings
+	}
+
+	reachable := f.reachableStates(start)
+
+	for _, state := range f.validateStates() {
+		if _, ok := reachable[state]; !ok {
+			findings = append(findings, Finding{
+				Kind:    UnreachableState,
+				State:   state,
+				Message: fmt.Sprintf("the state '%s' is unreachable from '%s'", state, start),
+			})
+		}
+	}
+
+	var events []Event
+	usable := make(map[Event]struct{}, len(f.transitions))
+	for _, t := range f.transitions {
+		if !hasEvent(events, t.Event) {
+			events = append(events, t.Event)
+		}
+		if _, ok := reachable[t.Source]; ok && !f.IsFinal(t.Source) {
+			usable[t.Event] = struct{}{}
+		}
+	}
+
+	for _, event := range events {
+		if _, ok := usable[event]; !ok {
+			findings = append(findings, Finding{
+				Kind:    UnusableEvent,
+				Event:   event,
+				Message: fmt.Sprintf("the event '%s' can never trigger any transition", event),
+			})
+		}
+	}
+
+	return findings
+}
+
+func (f *FSM) validateDeadEnds(findings []Finding) []Finding {
+	if len(f.finals) == 0 {
+		return findings
+	}
+
+	leaving := make(map[State]struct{}, len(f.transitions))
+	for _, t := range f.transitions {
+		if t.Target != t.Source {
+			leaving[t.Source] = struct{}{}
+		}
+	}
+
+	for _, state := range f.validateStates() {
+		if f.IsPseudo(state) || f.IsFinal(state) {
+			continue
+		}
+		if _, ok := leaving[state]; !ok {
+			findings = append(findings, Finding{
+				Kind:    DeadEndState,
+				State:   state,
+				Message: fmt.Sprintf("the non-final state '%s' has no transition leaving it", state),
+			})
+		}
+	}
+
+	return findings
+}
+
+func (f *FSM) validateBranches(findings []Finding) []Finding {
+	for _, state := range f.Pseudos() {
+		var hasElse bool
+		guards := make(map[string]struct{}, 4)
+		for i, b := range f.pseudos[state].branches {
+			var reason string
+			switch {
+			case b.IsElse():
+				if hasElse {
+					reason = "follows another else branch"
+				}
+				hasElse = true
+
+			case b.GuardName != "":
+				if _, ok := guards[b.GuardName]; ok {
+					reason = fmt.Sprintf("has the same guard '%s' as an earlier branch", b.GuardName)
+				}
+				guards[b.GuardName] = struct{}{}
+			}
+
+			if reason != "" {
+				findings = append(findings, Finding{
+					Kind:  ShadowedBranch,
+					State: state,
+					Message: fmt.Sprintf("the branch #%d to '%s' of the pseudo state '%s' %s",
+						i, b.Target, state, reason),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+func (f *FSM) validatePseudoLoops(findings []Finding) []Finding {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	reported := make(map[State]struct{}, len(f.pseudos))
+	marks := make(map[State]int, len(f.pseudos))
+	var path []State
+
+	var visit func(State)
+	visit = func(state State) {
+		marks[state] = visiting
+		path = append(path, state)
+		for _, b := range f.pseudos[state].branches {
+			if !f.IsPseudo(b.Target) {
+				continue
+			}
+
+			switch marks[b.Target] {
+			case unvisited:
+				visit(b.Target)
+
+			case visiting:
+				start := len(path) - 1
+				for path[start] != b.Target {
+					start--
+				}
+
+				loop := make([]State, len(path)-start)
+				copy(loop, path[start:])
+				if _, ok := reported[loop[0]]; ok {
+					continue
+				}
+
+				names := make([]string, 0, len(loop)+1)
+				for _, s := range loop {
+					reported[s] = struct{}{}
+					names = append(names, string(s))
+				}
+				names = append(names, string(loop[0]))
+
+				findings = append(findings, Finding{
+					Kind:    PseudoLoop,
+					State:   loop[0],
+					Message: fmt.Sprintf("the pseudo states form a loop: %s", strings.Join(names, " -> ")),
+				})
+			}
+		}
+		path = path[:len(path)-1]
+		marks[state] = visited
+	}
+
+	for _, state := range f.Pseudos() {
+		if marks[state] == unvisited {
+			visit(state)
+		}
+	}
+
+	return findings
+}
+
+func (f *FSM) validateShadowedTransitions(findings []Finding) []Finding {
+	for index, shadowed := range f.shadowed {
+		t := f.transitions[index]
+		for _, s := range shadowed {
+			findings = append(findings, Finding{
+				Kind:  ShadowedTransition,
+				State: t.Source,
+				Event: t.Event,
+				Message: fmt.Sprintf("the transition '%s' from '%s' to '%s' is shadowed by the later one to '%s'",
+					t.Event, t.Source, s.Target, t.Target),
+			})
+		}
+	}
+	return findings
+}
+
+// chainedTransitions returns the indexes of the transitions that may be
+// triggered by the events chained by the transition of the index.
+func (f *FSM) chainedTransitions(index int) (indexes []int) {
+	t := f.transitions[index]
+	if len(t.Chains) == 0 {
+		return nil
+	}
+
+	targets := f.Query().targets(t.Target)
+	for _, event := range t.Chains {
+		for _, target := range targets {
+			if f.IsFinal(target) {
+				continue // SendEvent stops once the state machine is done.
+			}
+			if i := f.indexTransition(target, event); i > -1 {
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	return
+}
+
+func (f *FSM) validateChainLoops(findings []Finding) []Finding {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	reported := make(map[int]struct{}, len(f.transitions))
+	marks := make([]int, len(f.transitions))
+	var path []int
+
+	var visit func(int)
+	visit = func(index int) {
+		marks[index] = visiting
+		path = append(path, index)
+		for _, next := range f.chainedTransitions(index) {
+			switch marks[next] {
+			case unvisited:
+				visit(next)
+
+			case visiting:
+				start := len(path) - 1
+				for path[start] != next {
+					start--
+				}
+
+				loop := path[start:]
+				if _, ok := reported[loop[0]]; ok {
+					continue
+				}
+
+				var buf bytes.Buffer
+				for _, i := range loop {
+					reported[i] = struct{}{}
+					t := f.transitions[i]
+					fmt.Fprintf(&buf, "%s --%s--> ", t.Source, t.Event)
+				}
+				buf.WriteString(string(f.transitions[loop[0]].Source))
+
+				first := f.transitions[loop[0]]
+				findings = append(findings, Finding{
+					Kind:    ChainLoop,
+					State:   first.Source,
+					Event:   first.Event,
+					Message: fmt.Sprintf("the chained events form a loop: %s", buf.String()),
+				})
+			}
+		}
+		path = path[:len(path)-1]
+		marks[index] = visited
+	}
+
+	for index := range f.transitions {
+		if marks[index] == unvisited {
+			visit(index)
+		}
+	}
+
+	return findings
+}
+
+// validateStates returns all the sorted states including the pseudo states,
+// the initial state and the declared final states.
+func (f *FSM) validateStates() []State {
+	states := getAllSortedStatesFromTransitions(f.edges())
+	for _, state := range f.finals {
+		if !hasState(states, state) {
+			states = append(states, state)
+		}
+	}
+	if f.initial != "" && !hasState(states, f.initial) {
+		states = append(states, f.initial)
+	}
+	sortStates(states)
+	return states
+}
+
+// startState returns the initial state, or the current state if no initial
+// state is set, which is the start of the reachability.
+func (f *FSM) startState() State {
+	if f.initial != "" {
+		return f.initial
+	}
+	return f.current
+}
+
+// reachableStates returns the set of the states, including the pseudo states,
+// which can be reached from the start state by the transitions and branches
+// without leaving any final state.
+func (f *FSM) reachableStates(start State) map[State]struct{} {
+	edges := f.edges()
+	reachable := map[State]struct{}{start: {}}
+	queue := []State{start}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		if f.IsFinal(state) {
+			continue // The state machine is done.
+		}
+
+		for _, e := range edges {
+			if e.Source != state {
+				continue
+			}
+			if _, ok := reachable[e.Target]; !ok {
+				reachable[e.Target] = struct{}{}
+				queue = append(queue, e.Target)
+			}
+		}
+	}
+	return reachable
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "testing"
+
+func TestValidateShadowedTransitions(t *testing.T) {
+	fsm := New()
+	fsm.SetInitial("A")
+	fsm.AddTransitions(
+		Source("A").WithTarget("B").WithEvent("Next"),
+		Source("A").WithTarget("C").WithEvent("Next"),
+		Source("A").WithTarget("D").WithEvent("Next"),
+	)
+
+	var messages []string
+	for _, finding := range fsm.Validate() {
+		if finding.Kind == ShadowedTransition {
+			messages = append(messages, finding.Message)
+		}
+	}
+
+	expects := []string{
+		"the transition 'Next' from 'A' to 'B' is shadowed by the later one to 'D'",
+		"the transition 'Next' from 'A' to 'C' is shadowed by the later one to 'D'",
+	}
+	if len(messages) != len(expects) {
+		t.Fatalf("expect the findings %q, but got %q", expects, messages)
+	}
+	for i, message := range messages {
+		if message != expects[i] {
+			t.Errorf("%d: expect the finding '%s', but got '%s'", i, expects[i], message)
+		}
+	}
+}
+
+func TestValidateChainLoops(t *testing.T) {
+	fsm := New()
+	fsm.SetInitial("A")
+	fsm.AddFinals("Z")
+	fsm.AddChoice("P", Else("E"))
+	fsm.AddTransitions(
+		Source("A").WithTarget("B").WithEvent("Pay").WithChains("Retry"),
+		Source("B").WithTarget("A").WithEvent("Retry").WithChains("Pay"),
+		Source("B").WithEvent("Tick").WithKind(Internal).WithChains("Tick"),
+		Source("B").WithTarget("D").WithEvent("Next"),
+		Source("D").WithTarget("P").WithEvent("Go").WithChains("Back"),
+		Source("E").WithTarget("D").WithEvent("Back").WithChains("Go"),
+		Source("E").WithTarget("Z").WithEvent("End").WithChains("Missing"),
+		Source("D").WithTarget("Z").WithEvent("Stop").WithChains("Go"),
+	)
+
+	var messages []string
+	for _, finding := range fsm.Validate() {
+		if finding.Kind == ChainLoop {
+			messages = append(messages, finding.Message)
+		}
+	}
+
+	expects := []string{
+		"the chained events form a loop: A --Pay--> B --Retry--> A",
+		"the chained events form a loop: B --Tick--> B",
+		"the chained events form a loop: D --Go--> E --Back--> D",
+	}
+	if len(messages) != len(expects) {
+		t.Fatalf("expect the findings %q, but got %q", expects, messages)
+	}
+	for i, message := range messages {
+		if message != expects[i] {
+			t.Errorf("%d: expect the finding '%s', but got '%s'", i, expects[i], message)
+		}
+	}
+}
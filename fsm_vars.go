@@ -0,0 +1,63 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// Var returns the value of the extended state variable by the key.
+//
+// Return nil if the variable does not exist.
+func (f *FSM) Var(key string) interface{} { return f.vars[key] }
+
+// LookupVar is the same as Var, but also reports whether the variable exists.
+func (f *FSM) LookupVar(key string) (value interface{}, ok bool) {
+	value, ok = f.vars[key]
+	return
+}
+
+// SetVar sets the extended state variable with the key and the value,
+// which is owned by the state machine instance.
+func (f *FSM) SetVar(key string, value interface{}) {
+	if f.vars == nil {
+		f.vars = make(map[string]interface{}, 8)
+	}
+	f.vars[key] = value
+}
+
+// DelVar deletes the extended state variable by the key.
+func (f *FSM) DelVar(key string) { delete(f.vars, key) }
+
+// Vars returns a copy of all the extended state variables.
+func (f *FSM) Vars() map[string]interface{} { return cloneVars(f.vars) }
+
+// SetVars replaces all the extended state variables with a copy of vars.
+func (f *FSM) SetVars(vars map[string]interface{}) {
+	for key := range f.vars {
+		delete(f.vars, key)
+	}
+	for key, value := range vars {
+		f.SetVar(key, value)
+	}
+}
+
+func cloneVars(vars map[string]interface{}) map[string]interface{} {
+	if len(vars) == 0 {
+		return nil
+	}
+
+	_vars := make(map[string]interface{}, len(vars))
+	for key, value := range vars {
+		_vars[key] = value
+	}
+	return _vars
+}
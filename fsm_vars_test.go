@@ -0,0 +1,123 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	fsm := New()
+	fsm.SetInitial("A")
+	fsm.AddTransitions(Source("A").WithTarget("B").WithEvent("Next").
+		WithAction(func(fsm *FSM, data interface{}) bool {
+			fsm.SetVar("count", 1)
+			return true
+		}))
+
+	if err := fsm.SendEvent("Next", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(fsm.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var snapshot Snapshot
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := New()
+	restored.SetInitial("A")
+	restored.AddTransitions(Source("A").WithTarget("B").WithEvent("Next"))
+	if err = restored.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Current() != "B" {
+		t.Errorf("expect the state '%s', but got '%s'", "B", restored.Current())
+	}
+	if count := restored.Var("count"); count != float64(1) { // Decoded by JSON
+		t.Errorf("expect the variable 'count' to be 1, but got %v", count)
+	}
+
+	// The restored variables are not shared with the snapshot.
+	restored.SetVar("count", 2)
+	if count := snapshot.Vars["count"]; count != float64(1) {
+		t.Errorf("expect the snapshot is not changed, but got %v", count)
+	}
+
+	if err = restored.Restore(Snapshot{}); err == nil {
+		t.Error("expect an error for the empty state")
+	}
+}
+
+func TestResetClearsVars(t *testing.T) {
+	fsm := New()
+	fsm.SetVar("key", "value")
+	fsm.Reset()
+
+	if _, ok := fsm.LookupVar("key"); ok {
+		t.Error("expect the variables to be cleared by Reset")
+	}
+	if vars := fsm.Vars(); len(vars) != 0 {
+		t.Errorf("expect no variables, but got %v", vars)
+	}
+}
+
+func TestPoolVars(t *testing.T) {
+	fsm1, fsm2 := Acquire(), Acquire()
+
+	fsm1.SetVar("key", "value1")
+	if _, ok := fsm2.LookupVar("key"); ok {
+		t.Error("expect the variables not to be shared by the machines from the pool")
+	}
+
+	fsm2.SetVar("key", "value2")
+	if value := fsm1.Var("key"); value != "value1" {
+		t.Errorf("expect the variable 'value1', but got %v", value)
+	}
+}
+
+func TestRestoreRejectsPlannedFailures(t *testing.T) {
+	fsm := New()
+	fsm.SetVersion(2)
+	fsm.SetInitial("Draft")
+	fsm.AddChoice("Check", Else("Published"))
+	fsm.AddTransitions(Source("Draft").WithTarget("Check").WithEvent("Submit"))
+	fsm.SetMigrations(NewMigrations().Add(1, "Review", "Check"))
+
+	snapshots := []Snapshot{
+		{State: "Archived", Version: 2}, // Unknown
+		{State: "Review", Version: 1},   // Migrated to the pseudo state
+		{State: "", Version: 2},
+	}
+
+	report := fsm.PlanMigration(snapshots)
+	if report.Failed != len(snapshots) {
+		t.Fatalf("expect all the snapshots to fail, but got %d:\n%s", report.Failed, report)
+	}
+
+	for _, s := range snapshots {
+		if err := fsm.Restore(s); err == nil {
+			t.Errorf("expect Restore to reject the snapshot %+v rejected by the plan", s)
+		} else if current := fsm.Current(); current != "Draft" {
+			t.Errorf("expect the state unchanged, but got '%s'", current)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Version returns the version of the state machine definition, which is 0 by default.
+func (f *FSM) Version() int { return f.version }
+
+// SetVersion sets the version of the state machine definition,
+// which is recorded in the snapshot.
+func (f *FSM) SetVersion(version int) { f.version = version }
+
+// Migrations returns the migrations of the state machine, which may be nil.
+func (f *FSM) Migrations() *Migrations { return f.migrations }
+
+// SetMigrations sets the migrations to migrate the state in the snapshot
+// of the old version to the current version when restoring it.
+func (f *FSM) SetMigrations(m *Migrations) { f.migrations = m }
+
+// MigrationFunc decides the new state of the next version by the state
+// of a version and the variables of the snapshot, which must not be modified.
+type MigrationFunc func(state State, vars map[string]interface{}) State
+
+// Migrations is the registry of the migrations, each of which maps
+// a state of a version to the new state of the next version.
+//
+// Notice: the events are not persisted in the snapshot,
+// so renaming the events does not need the migration.
+type Migrations struct {
+	steps map[int]map[State]MigrationFunc
+}
+
+// NewMigrations returns a new migration registry.
+func NewMigrations() *Migrations {
+	return &Migrations{steps: make(map[int]map[State]MigrationFunc, 4)}
+}
+
+// Add adds the migration which maps the state from of the version fromVersion
+// to the state to of the version fromVersion+1, and returns itself.
+//
+// The state that is not added is unchanged when migrating to the next version.
+func (m *Migrations) Add(fromVersion int, from, to State) *Migrations {
+	if to == "" {
+		panic("the migration state must not be empty")
+	}
+	return m.AddFunc(fromVersion, from, func(State, map[string]interface{}) State { return to })
+}
+
+// AddFunc is the same as Add, but the state of the version fromVersion+1
+// is decided by the function with the variables of the snapshot, which is
+// used to split the state into several ones, for example,
+//
+//	m.AddFunc(2, "InReview", func(state State, vars map[string]interface{}) State {
+//		if vars["legal"] == true {
+//			return "LegalReview"
+//		}
+//		return "TechReview"
+//	})
+func (m *Migrations) AddFunc(fromVersion int, from State, fn MigrationFunc) *Migrations {
+	if from == "" {
+		panic("the migration state must not be empty")
+	} else if fn == nil {
+		panic("the migration function must not be nil")
+	}
+
+	step, ok := m.steps[fromVersion]
+	if !ok {
+		step = make(map[State]MigrationFunc, 4)
+		m.steps[fromVersion] = step
+	}
+	step[from] = fn
+	return m
+}
+
+// Migrate migrates the state with the variables of the snapshot
+// from the version fromVersion to toVersion step by step.
+//
+// If m is nil, the state is unchanged.
+func (m *Migrations) Migrate(state State, vars map[string]interface{},
+	fromVersion, toVersion int) (State, error) {
+	if fromVersion > toVersion {
+		return state, fmt.Errorf("cannot migrate the state '%s' from the newer version %d to %d",
+			state, fromVersion, toVersion)
+	}
+
+	if m != nil {
+		for version := fromVersion; version < toVersion; version++ {
+			if fn, ok := m.steps[version][state]; ok {
+				to := fn(state, vars)
+				if to == "" {
+					return state, fmt.Errorf("the migration of the state '%s' of the version %d returns the empty state",
+						state, version)
+				}
+				state = to
+			}
+		}
+	}
+	return state, nil
+}
+
+// Migrate migrates the snapshot to the version of the state machine
+// by the migrations, and returns the new snapshot.
+func (f *FSM) Migrate(s Snapshot) (Snapshot, error) {
+	state, err := f.migrations.Migrate(s.State, s.Vars, s.Version, f.version)
+	if err != nil {
+		return s, err
+	}
+
+	s.State, s.Version = state, f.version
+	return s, nil
+}
+
+// MigrationEntry is the number of the snapshots of a version in a state,
+// which are migrated to the same new state. The snapshots in the same state
+// may be migrated to the different states by the migration functions.
+type MigrationEntry struct {
+	FromVersion int
+	From        State
+	To          State
+	Count       int
+
+	// Error is the reason why the snapshots cannot be restored,
+	// which is empty if they can.
+	Error string
+}
+
+type migrationEntries []MigrationEntry
+
+func (es migrationEntries) Len() int      { return len(es) }
+func (es migrationEntries) Swap(i, j int) { es[i], es[j] = es[j], es[i] }
+func (es migrationEntries) Less(i, j int) bool {
+	switch {
+	case es[i].FromVersion != es[j].FromVersion:
+		return es[i].FromVersion < es[j].FromVersion
+	case es[i].From != es[j].From:
+		return es[i].From < es[j].From
+	default:
+		return es[i].To < es[j].To
+	}
+}
+
+// MigrationReport is the dry-run report of the migration of the snapshots.
+type MigrationReport struct {
+	Version int              // The version to migrate to.
+	Entries []MigrationEntry // Sorted by the version, the state and the new state.
+	Failed  int              // The number of the snapshots that cannot be restored.
+}
+
+func (r MigrationReport) String() string {
+	var buf bytes.Buffer
+	for _, e := range r.Entries {
+		fmt.Fprintf(&buf, "v%d %s -> v%d %s: %d", e.FromVersion, e.From, r.Version, e.To, e.Count)
+		if e.Error != "" {
+			fmt.Fprintf(&buf, " (%s)", e.Error)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// PlanMigration reports how the snapshots would be migrated when restoring
+// them, without changing the state machine.
+//
+// Besides the errors of the migrations, the snapshots that are migrated
+// to the pseudo states or the states unknown to the state machine are also
+// reported as failed.
+func (f *FSM) PlanMigration(snapshots []Snapshot) (r MigrationReport) {
+	r.Version = f.version
+	states := f.validateStates()
+	indexes := make(map[MigrationEntry]int, 16)
+	for _, s := range snapshots {
+		e := MigrationEntry{FromVersion: s.Version, From: s.State, To: s.State}
+		ms, err := f.Migrate(s)
+		if err == nil {
+			e.To = ms.State
+			err = f.checkRestoreState(e.To, states)
+		}
+		if err != nil {
+			e.Error = err.Error()
+		}
+
+		if index, ok := indexes[e]; ok {
+			r.Entries[index].Count++
+			continue
+		}
+
+		indexes[e] = len(r.Entries)
+		e.Count = 1
+		r.Entries = append(r.Entries, e)
+	}
+
+	for _, e := range r.Entries {
+		if e.Error != "" {
+			r.Failed += e.Count
+		}
+	}
+
+	sort.Sort(migrationEntries(r.Entries))
+
+	return
+}
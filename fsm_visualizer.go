@@ -0,0 +1,252 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VisualizeOptions is the options shared by the visualizers,
+// such as VisualizeGraphvizWith.
+//
+// The zero value is the default layout of each visualizer.
+type VisualizeOptions struct {
+	// Name is the name of the graph, which is "fsm" for Graphviz by default.
+	// If set, it is also the title of the Mermaid diagrams.
+	Name string
+
+	// Direction is the layout direction, such as "LR", "TB", "RL" or "BT",
+	// which is "LR" for the Mermaid flowchart and "TB" for others by default.
+	Direction string
+
+	// CurrentColor, InitialColor and FinalColor are the fill colors,
+	// such as "#aaaaaa", to highlight the current, initial and final states.
+	// If empty, the state is not highlighted.
+	//
+	// The current state takes precedence over the final states,
+	// which take precedence over the initial state.
+	CurrentColor string
+	InitialColor string
+	FinalColor   string
+
+	// ShowGuards and ShowActions add the names of the guard and the action
+	// into the label of the transition, such as "Event [guard] / action".
+	//
+	// The hook without the name is shown as "?".
+	ShowGuards  bool
+	ShowActions bool
+
+	// HideSelfLoops hides the transitions whose target is the source,
+	// including the internal and reentrant transitions.
+	HideSelfLoops bool
+
+	// StateClasses is the CSS classes of the states, and ClassStyles is
+	// the styles of the classes, such as "fill:#f96,stroke:#333".
+	//
+	// For Graphviz, the class is output as the "class" attribute, which is
+	// used by the SVG output, and ClassStyles is ignored.
+	StateClasses map[State]string
+	ClassStyles  map[string]string
+
+	// Include and Exclude filter the states to be rendered. If Include is
+	// not empty, only the states in it are rendered, and the states in Exclude
+	// are never rendered. The edges from or to the hidden states are hidden.
+	Include []State
+	Exclude []State
+
+	// Counts is the counters of the transitions, such as Metrics.Counts.
+	// If set, the edges are labelled with the counts, and styled by
+	// the traffic as the heatmap, where the edges never used are dashed.
+	//
+	// The Mermaid state diagram and the ASCII diagram only support the labels,
+	// and the ASCII table has the count column.
+	Counts map[TransitionKey]uint64
+}
+
+// visible reports whether the state is rendered by the filters.
+func (o VisualizeOptions) visible(state State) bool {
+	if len(o.Include) > 0 && !hasState(o.Include, state) {
+		return false
+	}
+	return !hasState(o.Exclude, state)
+}
+
+// transitionLabel returns the label of the transition,
+// which may contain the guard and the action.
+func (o VisualizeOptions) transitionLabel(t Transition) string {
+	label := string(t.Event)
+	if o.ShowGuards {
+		if guard := hookName(t.Guard != nil, t.GuardName); guard != "" {
+			label += " [" + guard + "]"
+		}
+	}
+	if o.ShowActions {
+		if action := hookName(t.Action != nil, t.ActionName); action != "" {
+			label += " / " + action
+		}
+	}
+	return label
+}
+
+// visualEdge is the edge to be rendered, which is either a transition,
+// or a branch of a pseudo state.
+type visualEdge struct {
+	Source   State
+	Target   State
+	Label    string
+	Internal bool
+	Branch   bool
+
+	Event  Event  // Empty for the branch.
+	Guard  string // The name of the guard, "else" for the else branch.
+	Action string // The name of the action.
+	Count  uint64 // The count of the edge if the counts are set.
+}
+
+// visualGraph is the graph of the state machine filtered by the options,
+// which is shared by the visualizers.
+type visualGraph struct {
+	fsm    *FSM
+	opts   VisualizeOptions
+	states []State      // The sorted states of all the edges.
+	edges  []visualEdge // The sorted transitions, then the branches.
+
+	maxCount uint64 // The maximum count of the edges.
+}
+
+func (f *FSM) visualGraph(opts VisualizeOptions) visualGraph {
+	g := visualGraph{fsm: f, opts: opts}
+	for _, state := range getAllSortedStatesFromTransitions(f.edges()) {
+		if opts.visible(state) {
+			g.states = append(g.states, state)
+		}
+	}
+
+	for _, t := range cloneAndSortTransitions(f.Transitions()) {
+		if g.visibleEdge(t.Source, t.Target) {
+			g.edges = append(g.edges, visualEdge{Source: t.Source, Target: t.Target,
+				Label: opts.transitionLabel(t), Internal: t.Kind == Internal, Event: t.Event,
+				Guard: hookName(t.Guard != nil, t.GuardName), Action: hookName(t.Action != nil, t.ActionName)})
+		}
+	}
+
+	for _, state := range f.Pseudos() {
+		_, branches := f.Pseudo(state)
+		for _, b := range branches {
+			if g.visibleEdge(state, b.Target) {
+				guard := "else"
+				if !b.IsElse() {
+					guard = hookName(true, b.GuardName)
+				}
+				g.edges = append(g.edges, visualEdge{Source: state,
+					Target: b.Target, Label: b.Label(), Branch: true, Guard: guard})
+			}
+		}
+	}
+
+	if opts.Counts != nil {
+		g.countEdges()
+	}
+	return g
+}
+
+func (g visualGraph) visibleEdge(source, target State) bool {
+	if g.opts.HideSelfLoops && source == target {
+		return false
+	}
+	return g.opts.visible(source) && g.opts.visible(target)
+}
+
+// terminations returns the visible terminations of the state machine.
+func (g visualGraph) terminations() (states []State) {
+	for _, state := range g.fsm.Terminations() {
+		if g.opts.visible(state) {
+			states = append(states, state)
+		}
+	}
+	return
+}
+
+// highlight returns the name and the fill color to highlight the state,
+// which are empty if the state is not highlighted.
+func (g visualGraph) highlight(state State) (name, color string) {
+	switch {
+	case g.opts.CurrentColor != "" && state == g.fsm.Current():
+		return "current", g.opts.CurrentColor
+	case g.opts.FinalColor != "" && g.fsm.IsFinal(state):
+		return "final", g.opts.FinalColor
+	case g.opts.InitialColor != "" && state == g.fsm.Initial():
+		return "initial", g.opts.InitialColor
+	default:
+		return "", ""
+	}
+}
+
+// yamlQuoter escapes the text to be used in the double-quoted YAML scalar,
+// which is in one line.
+var yamlQuoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", "", "\n", " ")
+
+// writeMermaidTitle writes the front matter of the Mermaid diagram
+// with the title if name is not empty, which is quoted as the YAML string.
+func writeMermaidTitle(buf *bytes.Buffer, name string) {
+	if name != "" {
+		fmt.Fprintf(buf, "---\ntitle: \"%s\"\n---\n", yamlQuoter.Replace(name))
+	}
+}
+
+// writeMermaidClasses writes the classes of the states, whose styles are
+// defined by "classDef", including the highlighted states if withHighlight.
+func writeMermaidClasses(buf *bytes.Buffer, g visualGraph, states []State,
+	ids map[State]string, withHighlight bool) {
+	styles := make(map[string]string, len(g.opts.ClassStyles)+3)
+	classes := make(map[string][]string, len(g.opts.StateClasses)+3)
+	for _, state := range states {
+		if withHighlight {
+			if name, color := g.highlight(state); name != "" {
+				styles[name] = "fill:" + color
+				classes[name] = append(classes[name], ids[state])
+			}
+		}
+		if class := g.opts.StateClasses[state]; class != "" {
+			classes[class] = append(classes[class], ids[state])
+		}
+	}
+	for class, style := range g.opts.ClassStyles {
+		if _, ok := styles[class]; !ok {
+			styles[class] = style
+		}
+	}
+
+	names := make([]string, 0, len(styles))
+	for name := range styles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(buf, "    classDef %s %s\n", name, styles[name])
+	}
+
+	names = names[:0]
+	for name := range classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(buf, "    class %s %s\n", strings.Join(classes[name], ","), name)
+	}
+}
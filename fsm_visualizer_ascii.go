@@ -0,0 +1,288 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ASCIIOptions is the options of VisualizeASCII.
+type ASCIIOptions struct {
+	VisualizeOptions
+
+	// Table outputs the compact table of the transitions and the branches
+	// instead of the diagram, which is suitable for the large state machine.
+	Table bool
+
+	// Unicode draws with the Unicode box-drawing characters instead of ASCII.
+	Unicode bool
+
+	// Color marks the highlighted states with the ANSI colors, and the current
+	// state is marked in bold green if CurrentColor is empty.
+	Color bool
+}
+
+type asciiCharset struct {
+	horizontal, vertical string
+	topLeft, topRight    string
+	bottomLeft           string
+	bottomRight, cross   string
+	branch, lastBranch   string
+	arrow                string
+}
+
+var (
+	asciiChars = asciiCharset{horizontal: "-", vertical: "|", topLeft: "+",
+		topRight: "+", bottomLeft: "+", bottomRight: "+", cross: "+",
+		branch: "|--", lastBranch: "`--", arrow: "-->"}
+
+	unicodeChars = asciiCharset{horizontal: "─", vertical: "│", topLeft: "┌",
+		topRight: "┐", bottomLeft: "└", bottomRight: "┘", cross: "┼",
+		branch: "├──", lastBranch: "└──", arrow: "──▶"}
+)
+
+// ansiColors is the ANSI codes of the basic color names.
+var ansiColors = map[string]string{"black": "30", "red": "31", "green": "32",
+	"yellow": "33", "blue": "34", "magenta": "35", "cyan": "36", "white": "37"}
+
+// ansiColor returns the ANSI escape code of the color, such as "#aaaaaa",
+// "#aaa" or "red", which is bold green if color is empty.
+func ansiColor(color string) string {
+	if color == "" {
+		return "\x1b[1;32m"
+	} else if code, ok := ansiColors[strings.ToLower(color)]; ok {
+		return "\x1b[1;" + code + "m"
+	}
+
+	hex := strings.TrimPrefix(color, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if rgb, err := strconv.ParseUint(hex, 16, 32); err == nil && len(hex) == 6 {
+		return fmt.Sprintf("\x1b[1;38;2;%d;%d;%dm", rgb>>16, rgb>>8&0xff, rgb&0xff)
+	}
+	return "\x1b[1m"
+}
+
+// VisualizeASCII outputs a visualization of a FSM in plain text for
+// the terminal, which draws the states as the boxes, each followed by
+// its transitions as the labelled arrows, or the compact table if Table.
+//
+// The states are in the order of the layered layout from the initial state,
+// and the direction of the options is ignored.
+func (f *FSM) VisualizeASCII(opts ASCIIOptions) string {
+	chars := asciiChars
+	if opts.Unicode {
+		chars = unicodeChars
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(512)
+
+	g := f.visualGraph(opts.VisualizeOptions)
+	if opts.Name != "" {
+		buf.WriteString(opts.Name)
+		buf.WriteString("\n\n")
+	}
+
+	if opts.Table {
+		writeASCIITable(&buf, g, opts, chars)
+	} else {
+		writeASCIIDiagram(&buf, g, opts, chars)
+	}
+	return buf.String()
+}
+
+// asciiColor returns the ANSI escape code to color the state,
+// which is empty if the state is not colored.
+func asciiColor(g visualGraph, opts ASCIIOptions, state State) string {
+	if !opts.Color {
+		return ""
+	} else if _, color := g.highlight(state); color != "" {
+		return ansiColor(color)
+	} else if state == g.fsm.Current() {
+		return ansiColor("")
+	}
+	return ""
+}
+
+// statesByPosition sorts the states by their positions in the layout,
+// from top to bottom, then from left to right.
+type statesByPosition struct {
+	states []State
+	layout *graphLayout
+}
+
+func (s statesByPosition) Len() int      { return len(s.states) }
+func (s statesByPosition) Swap(i, j int) { s.states[i], s.states[j] = s.states[j], s.states[i] }
+func (s statesByPosition) Less(i, j int) bool {
+	a, b := s.layout.Node(s.states[i]), s.layout.Node(s.states[j])
+	if a.Y == b.Y {
+		return a.X < b.X
+	}
+	return a.Y < b.Y
+}
+
+func writeASCIIDiagram(buf *bytes.Buffer, g visualGraph, opts ASCIIOptions, chars asciiCharset) {
+	f := g.fsm
+	initial := f.Initial()
+	if initial == "" {
+		initial = f.Current()
+	}
+	if !opts.visible(initial) {
+		initial = ""
+	}
+
+	states := appendStates(append([]State(nil), g.states...), g.terminations()...)
+	states = appendStates(states, initial)
+	sortStates(states)
+
+	l := layoutGraph(states, g.edges, layoutConfig{Root: initial, LayerGap: 1, NodeGap: 1,
+		Size: func(State) (float64, float64) { return 1, 1 }})
+	sort.Stable(statesByPosition{states: states, layout: l})
+
+	for i, state := range states {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+
+		var marks []string
+		switch {
+		case f.IsPseudo(state):
+			marks = append(marks, "choice")
+		case state == f.Initial():
+			marks = append(marks, "initial")
+		}
+		if f.IsFinal(state) {
+			marks = append(marks, "final")
+		}
+		if state == f.Current() {
+			marks = append(marks, "current")
+		}
+
+		var mark string
+		if len(marks) > 0 {
+			mark = "  (" + strings.Join(marks, ", ") + ")"
+		}
+
+		color, reset := asciiColor(g, opts, state), ""
+		if color != "" {
+			reset = "\x1b[0m"
+		}
+
+		if f.IsPseudo(state) {
+			fmt.Fprintf(buf, "%s< %s >%s%s\n", color, state, reset, mark)
+		} else {
+			line := strings.Repeat(chars.horizontal, displayWidth(string(state))+2)
+			fmt.Fprintf(buf, "%s%s%s%s%s\n", color, chars.topLeft, line, chars.topRight, reset)
+			fmt.Fprintf(buf, "%s%s %s %s%s%s\n", color, chars.vertical, state, chars.vertical, reset, mark)
+			fmt.Fprintf(buf, "%s%s%s%s%s\n", color, chars.bottomLeft, line, chars.bottomRight, reset)
+		}
+
+		var edges []visualEdge
+		for _, e := range g.edges {
+			if e.Source == state {
+				edges = append(edges, e)
+			}
+		}
+		for j, e := range edges {
+			branch := chars.branch
+			if j == len(edges)-1 {
+				branch = chars.lastBranch
+			}
+
+			switch {
+			case e.Internal:
+				fmt.Fprintf(buf, "  %s %s (internal)\n", branch, e.Label)
+			case e.Label == "":
+				fmt.Fprintf(buf, "  %s %s %s\n", branch, chars.arrow, e.Target)
+			default:
+				fmt.Fprintf(buf, "  %s %s %s %s\n", branch, e.Label, chars.arrow, e.Target)
+			}
+		}
+	}
+}
+
+func writeASCIITable(buf *bytes.Buffer, g visualGraph, opts ASCIIOptions, chars asciiCharset) {
+	header := []string{"SOURCE", "EVENT", "TARGET", "GUARD"}
+	if opts.ShowActions {
+		header = append(header, "ACTION")
+	}
+	if opts.Counts != nil {
+		header = append(header, "COUNT")
+	}
+
+	rows := [][]string{header}
+	for _, e := range g.edges {
+		event := string(e.Event)
+		if e.Branch {
+			event = "-"
+		}
+
+		row := []string{string(e.Source), event, string(e.Target), e.Guard}
+		if opts.ShowActions {
+			row = append(row, e.Action)
+		}
+		if opts.Counts != nil {
+			row = append(row, strconv.FormatUint(e.Count, 10))
+		}
+		rows = append(rows, row)
+	}
+
+	widths := make([]int, len(header))
+	for _, row := range rows {
+		for i, cell := range row {
+			if width := displayWidth(cell); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+
+	for r, row := range rows {
+		var line bytes.Buffer
+		for i, cell := range row {
+			if i > 0 {
+				line.WriteString(" " + chars.vertical + " ")
+			}
+
+			padding := strings.Repeat(" ", widths[i]-displayWidth(cell))
+			if r > 0 && (i == 0 || i == 2) {
+				if color := asciiColor(g, opts, State(cell)); color != "" {
+					cell = color + cell + "\x1b[0m"
+				}
+			}
+			line.WriteString(cell)
+			if i < len(row)-1 {
+				line.WriteString(padding)
+			}
+		}
+		buf.WriteString(strings.TrimRight(line.String(), " "))
+		buf.WriteString("\n")
+
+		if r == 0 {
+			for i, width := range widths {
+				if i > 0 {
+					buf.WriteString(chars.horizontal + chars.cross + chars.horizontal)
+				}
+				buf.WriteString(strings.Repeat(chars.horizontal, width))
+			}
+			buf.WriteString("\n")
+		}
+	}
+}
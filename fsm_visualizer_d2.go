@@ -0,0 +1,163 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// d2Directions maps the layout directions to the D2 directions.
+var d2Directions = map[string]string{"LR": "right", "RL": "left", "TB": "down", "BT": "up"}
+
+// d2ShapeClasses is the D2 classes to mark the special states.
+var d2ShapeClasses = map[string]string{
+	"choice":  "shape: diamond",
+	"final":   "style.double-border: true",
+	"initial": "style.stroke-width: 3",
+}
+
+// d2Value returns the D2 value, which is quoted unless it is a number or a bool.
+func d2Value(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil || value == "true" || value == "false" {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+// d2Styles converts the CSS styles, such as "fill:#f96,stroke-width:4px",
+// to the D2 styles.
+func d2Styles(css string) []string {
+	var styles []string
+	for _, decl := range strings.FieldsFunc(css, func(r rune) bool { return r == ',' || r == ';' }) {
+		if index := strings.IndexByte(decl, ':'); index > 0 {
+			key := strings.TrimSpace(decl[:index])
+			value := strings.TrimSuffix(strings.TrimSpace(decl[index+1:]), "px")
+			styles = append(styles, fmt.Sprintf("style.%s: %s", key, d2Value(value)))
+		}
+	}
+	return styles
+}
+
+// VisualizeD2 outputs a visualization of a FSM in D2 format with the options.
+//
+// The initial, final and pseudo states are marked by the classes "initial",
+// "final" and "choice", and the CSS styles of ClassStyles are converted
+// to the D2 styles, such as "fill:#f96" to "style.fill: "#f96"".
+//
+// See https://d2lang.com
+func (f *FSM) VisualizeD2(opts VisualizeOptions) string {
+	var buf bytes.Buffer
+	buf.Grow(256)
+
+	g := f.visualGraph(opts)
+	states := appendStates(append([]State(nil), g.states...), g.terminations()...)
+	if initial := f.Initial(); opts.visible(initial) {
+		states = appendStates(states, initial)
+	}
+	sortStates(states)
+
+	if direction, ok := d2Directions[opts.Direction]; ok {
+		fmt.Fprintf(&buf, "direction: %s\n", direction)
+	}
+	if opts.Name != "" {
+		key := "title"
+		for hasState(states, State(key)) {
+			key += "_"
+		}
+		fmt.Fprintf(&buf, "%s: %s {shape: text; near: top-center; style.font-size: 24}\n",
+			key, strconv.Quote(opts.Name))
+	}
+	writeD2Classes(&buf, opts.ClassStyles)
+
+	for _, state := range states {
+		var classes []string
+		switch {
+		case f.IsPseudo(state):
+			classes = append(classes, "choice")
+		case state == f.Initial():
+			classes = append(classes, "initial")
+		case f.IsFinal(state):
+			classes = append(classes, "final")
+		}
+		if class := opts.StateClasses[state]; class != "" {
+			classes = append(classes, class)
+		}
+
+		var attrs []string
+		switch len(classes) {
+		case 0:
+		case 1:
+			attrs = append(attrs, "class: "+classes[0])
+		default:
+			attrs = append(attrs, "class: ["+strings.Join(classes, "; ")+"]")
+		}
+		if _, color := g.highlight(state); color != "" {
+			attrs = append(attrs, "style.fill: "+strconv.Quote(color))
+		}
+
+		if len(attrs) == 0 {
+			fmt.Fprintf(&buf, "%s\n", strconv.Quote(string(state)))
+		} else {
+			fmt.Fprintf(&buf, "%s: {%s}\n", strconv.Quote(string(state)), strings.Join(attrs, "; "))
+		}
+	}
+
+	buf.WriteString("\n")
+	for _, e := range g.edges {
+		fmt.Fprintf(&buf, "%s -> %s", strconv.Quote(string(e.Source)), strconv.Quote(string(e.Target)))
+		if e.Label != "" {
+			fmt.Fprintf(&buf, ": %s", strconv.Quote(e.Label))
+		}
+		if h, ok := g.heat(e); ok {
+			fmt.Fprintf(&buf, " {style.stroke: %s; style.stroke-width: %d", strconv.Quote(h.Color), int(h.Width+0.5))
+			if h.Unused {
+				buf.WriteString("; style.stroke-dash: 3")
+			}
+			buf.WriteString("}")
+		}
+		buf.WriteString("\n")
+	}
+
+	return buf.String()
+}
+
+// writeD2Classes writes the shape classes and the classes of the styles.
+func writeD2Classes(buf *bytes.Buffer, classStyles map[string]string) {
+	classes := make(map[string][]string, len(d2ShapeClasses)+len(classStyles))
+	for class, style := range d2ShapeClasses {
+		classes[class] = []string{style}
+	}
+	for class, css := range classStyles {
+		if _, ok := classes[class]; !ok {
+			classes[class] = d2Styles(css)
+		}
+	}
+
+	names := make([]string, 0, len(classes))
+	for name := range classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf.WriteString("classes: {\n")
+	for _, name := range names {
+		fmt.Fprintf(buf, "  %s: {%s}\n", name, strings.Join(classes[name], "; "))
+	}
+	buf.WriteString("}\n\n")
+}
@@ -17,49 +17,105 @@ package fsm
 import (
 	"bytes"
 	"fmt"
+	"strings"
 )
 
+// graphvizKeywords is the words which cannot be used as the Graphviz identifiers.
+var graphvizKeywords = []string{"digraph", "edge", "graph", "node", "strict", "subgraph"}
+
+// isGraphvizID reports whether the name can be used as the Graphviz identifier.
+func isGraphvizID(name string) bool { return isSafeID(name, graphvizKeywords) }
+
 // VisualizeGraphviz outputs a visualization of a FSM in Graphviz format.
 func (f *FSM) VisualizeGraphviz() string {
-	transitions := cloneAndSortTransitions(f.Transitions())
+	return f.VisualizeGraphvizWith(VisualizeOptions{})
+}
+
+// VisualizeGraphvizWith is the same as VisualizeGraphviz,
+// but renders the FSM with the options.
+func (f *FSM) VisualizeGraphvizWith(opts VisualizeOptions) string {
+	g := f.visualGraph(opts)
 
 	var buf bytes.Buffer
 	buf.Grow(256)
 
-	writeHeaderLine(&buf)
-	writeTransitions(&buf, f.Current(), transitions)
-	writeStates(&buf, transitions)
+	writeHeaderLine(&buf, opts.Name)
+	if opts.Direction != "" {
+		fmt.Fprintf(&buf, "    rankdir = %s;\n", opts.Direction)
+	}
+	writeTransitions(&buf, g)
+	buf.WriteString("\n")
+	writeStates(&buf, g)
 	writeFooter(&buf)
 
 	return buf.String()
 }
 
-func writeHeaderLine(buf *bytes.Buffer) {
-	buf.WriteString(fmt.Sprintf(`digraph fsm {`))
-	buf.WriteString("\n")
+func writeHeaderLine(buf *bytes.Buffer, name string) {
+	switch {
+	case name == "":
+		name = "fsm"
+	case !isGraphvizID(name):
+		name = `"` + escapeGraphviz(name) + `"`
+	}
+	fmt.Fprintf(buf, "digraph %s {\n", name)
 }
 
-func writeTransitions(buf *bytes.Buffer, initial State, transitions []Transition) {
-	// make sure the initial state is at top
-	for _, t := range transitions {
-		if t.Source == initial {
-			fmt.Fprintf(buf, `    "%s" -> "%s" [ label = "%s" ];`+"\n", t.Source, t.Target, t.Event)
+func writeTransitions(buf *bytes.Buffer, g visualGraph) {
+	// make sure the transitions from the current state are at top
+	current := g.fsm.Current()
+	for _, e := range g.edges {
+		if !e.Branch && e.Source == current {
+			writeGraphvizHeatEdge(buf, g, e)
 		}
 	}
 
-	for _, t := range transitions {
-		if t.Source != initial {
-			fmt.Fprintf(buf, `    "%s" -> "%s" [ label = "%s" ];`+"\n", t.Source, t.Target, t.Event)
+	for _, e := range g.edges {
+		if e.Branch || e.Source != current {
+			writeGraphvizHeatEdge(buf, g, e)
 		}
 	}
+}
 
-	buf.WriteString("\n")
+func writeGraphvizHeatEdge(buf *bytes.Buffer, g visualGraph, e visualEdge) {
+	h, ok := g.heat(e)
+	if !ok {
+		writeGraphvizEdge(buf, e.Source, e.Target, e.Label)
+		return
+	}
+
+	fmt.Fprintf(buf, `    "%s" -> "%s" [ label = "%s", color = "%s", penwidth = %s`,
+		escapeGraphviz(string(e.Source)), escapeGraphviz(string(e.Target)),
+		escapeGraphviz(e.Label), h.Color, svgNum(h.Width))
+	if h.Unused {
+		buf.WriteString(`, style = "dashed"`)
+	}
+	buf.WriteString(" ];\n")
+}
+
+func writeGraphvizEdge(buf *bytes.Buffer, source, target State, label string) {
+	fmt.Fprintf(buf, `    "%s" -> "%s" [ label = "%s" ];`+"\n", escapeGraphviz(string(source)),
+		escapeGraphviz(string(target)), escapeGraphviz(label))
 }
 
-func writeStates(buf *bytes.Buffer, transitions []Transition) {
-	states := getAllSortedStatesFromTransitions(transitions)
-	for _, s := range states {
-		buf.WriteString(fmt.Sprintf(`    "%s";`+"\n", s))
+func writeStates(buf *bytes.Buffer, g visualGraph) {
+	for _, s := range g.states {
+		var attrs []string
+		if g.fsm.IsPseudo(s) {
+			attrs = append(attrs, "shape = diamond")
+		}
+		if _, color := g.highlight(s); color != "" {
+			attrs = append(attrs, fmt.Sprintf(`style = filled, fillcolor = "%s"`, escapeGraphviz(color)))
+		}
+		if class := g.opts.StateClasses[s]; class != "" {
+			attrs = append(attrs, fmt.Sprintf(`class = "%s"`, escapeGraphviz(class)))
+		}
+
+		if len(attrs) == 0 {
+			fmt.Fprintf(buf, `    "%s";`+"\n", escapeGraphviz(string(s)))
+		} else {
+			fmt.Fprintf(buf, `    "%s" [ %s ];`+"\n", escapeGraphviz(string(s)), strings.Join(attrs, ", "))
+		}
 	}
 }
 
@@ -24,19 +24,62 @@ import (
 //
 // See http://mermaid-js.github.io/mermaid/#/stateDiagram
 func (f *FSM) VisualizeMermaidStateDiagram() string {
+	return f.VisualizeMermaidStateDiagramWith(VisualizeOptions{})
+}
+
+// VisualizeMermaidStateDiagramWith is the same as VisualizeMermaidStateDiagram,
+// but renders the FSM with the options.
+func (f *FSM) VisualizeMermaidStateDiagramWith(opts VisualizeOptions) string {
 	var buf bytes.Buffer
 	buf.Grow(256)
 
-	transitions := cloneAndSortTransitions(f.Transitions())
+	g := f.visualGraph(opts)
+	initial := f.Initial()
+	if initial == "" {
+		initial = f.Current()
+	}
+	if !opts.visible(initial) {
+		initial = ""
+	}
+
+	terminations := g.terminations()
+	states := appendStates(g.states, terminations...)
+	states = appendStates(states, initial)
+	ids := mermaidIDs(states)
 
+	writeMermaidTitle(&buf, opts.Name)
 	buf.WriteString("stateDiagram-v2\n")
-	fmt.Fprintf(&buf, "    [*] --> %s\n", f.Current())
-	for _, t := range transitions {
-		fmt.Fprintf(&buf, "    %s --> %s: %s\n", t.Source, t.Target, t.Event)
+	if opts.Direction != "" {
+		fmt.Fprintf(&buf, "    direction %s\n", opts.Direction)
+	}
+	for _, state := range states {
+		if id := ids[state]; id != string(state) {
+			fmt.Fprintf(&buf, "    state \"%s\" as %s\n", escapeMermaid(string(state)), id)
+		}
+	}
+	for _, state := range f.Pseudos() {
+		if opts.visible(state) {
+			fmt.Fprintf(&buf, "    state %s <<choice>>\n", ids[state])
+		}
 	}
-	for _, s := range f.Terminations() {
-		fmt.Fprintf(&buf, "    %s --> [*]\n", s)
+	if initial != "" {
+		fmt.Fprintf(&buf, "    [*] --> %s\n", ids[initial])
 	}
+	for _, e := range g.edges {
+		switch {
+		case e.Internal:
+			// Show the internal transition inside the state box.
+			fmt.Fprintf(&buf, "    %s : %s\n", ids[e.Source], escapeMermaid(e.Label))
+		case e.Label == "":
+			fmt.Fprintf(&buf, "    %s --> %s\n", ids[e.Source], ids[e.Target])
+		default:
+			fmt.Fprintf(&buf, "    %s --> %s: %s\n", ids[e.Source], ids[e.Target], escapeMermaid(e.Label))
+		}
+	}
+	for _, s := range terminations {
+		fmt.Fprintf(&buf, "    %s --> [*]\n", ids[s])
+	}
+	writeMermaidClasses(&buf, g, states, ids, true)
 
 	return buf.String()
 }
@@ -46,40 +89,69 @@ func (f *FSM) VisualizeMermaidStateDiagram() string {
 //
 // See http://mermaid-js.github.io/mermaid/#/flowchart
 func (f *FSM) VisualizeMermaidFlowChart(currentStateRGB string) string {
+	return f.VisualizeMermaidFlowChartWith(VisualizeOptions{CurrentColor: currentStateRGB})
+}
+
+// VisualizeMermaidFlowChartWith is the same as VisualizeMermaidFlowChart,
+// but renders the FSM with the options.
+func (f *FSM) VisualizeMermaidFlowChartWith(opts VisualizeOptions) string {
 	var buf bytes.Buffer
 	buf.Grow(256)
 
-	transitions := cloneAndSortTransitions(f.Transitions())
-	states := getAllSortedStatesFromTransitions(transitions)
-	stateIDs := make(map[State]string, len(transitions))
-	for i, state := range states {
+	g := f.visualGraph(opts)
+	stateIDs := make(map[State]string, len(g.states))
+	for i, state := range g.states {
 		stateIDs[state] = fmt.Sprintf("id%d", i)
 	}
 
-	writeFlowChartGraphType(&buf)
-	writeFlowChartStates(&buf, states, stateIDs)
-	writeFlowChartTransitions(&buf, transitions, states, stateIDs)
-	writeFlowChartHighlight(&buf, stateIDs[f.Current()], currentStateRGB)
+	writeMermaidTitle(&buf, opts.Name)
+	writeFlowChartGraphType(&buf, opts.Direction)
+	writeFlowChartStates(&buf, f, g.states, stateIDs)
+	writeFlowChartTransitions(&buf, g, stateIDs)
+	for _, state := range g.states {
+		_, color := g.highlight(state)
+		writeFlowChartHighlight(&buf, stateIDs[state], color)
+	}
+	for i, e := range g.edges {
+		if h, ok := g.heat(e); ok {
+			fmt.Fprintf(&buf, "    linkStyle %d stroke:%s,stroke-width:%spx\n", i, h.Color, svgNum(h.Width))
+		}
+	}
+	writeMermaidClasses(&buf, g, g.states, stateIDs, false)
 
 	return buf.String()
 }
 
-func writeFlowChartGraphType(buf *bytes.Buffer) {
-	buf.WriteString("graph LR\n")
+func writeFlowChartGraphType(buf *bytes.Buffer, direction string) {
+	if direction == "" {
+		direction = "LR"
+	}
+	fmt.Fprintf(buf, "graph %s\n", direction)
 }
 
-func writeFlowChartStates(buf *bytes.Buffer, states []State, ids map[State]string) {
+func writeFlowChartStates(buf *bytes.Buffer, f *FSM, states []State, ids map[State]string) {
 	for _, state := range states {
-		fmt.Fprintf(buf, `    %s[%s]`+"\n", ids[state], state)
+		if f.IsPseudo(state) {
+			fmt.Fprintf(buf, `    %s{%s}`+"\n", ids[state], mermaidNodeText(string(state)))
+		} else {
+			fmt.Fprintf(buf, `    %s[%s]`+"\n", ids[state], mermaidNodeText(string(state)))
+		}
 	}
 	buf.WriteString("\n")
 }
 
-func writeFlowChartTransitions(buf *bytes.Buffer, transitions []Transition,
-	states []State, ids map[State]string) {
+func writeFlowChartTransitions(buf *bytes.Buffer, g visualGraph, ids map[State]string) {
+	for _, e := range g.edges {
+		arrow := "-->"
+		if h, _ := g.heat(e); h.Unused {
+			arrow = "-.->"
+		}
 
-	for _, t := range transitions {
-		fmt.Fprintf(buf, `    %s --> |%s| %s`+"\n", ids[t.Source], t.Event, ids[t.Target])
+		if e.Label == "" {
+			fmt.Fprintf(buf, `    %s %s %s`+"\n", ids[e.Source], arrow, ids[e.Target])
+		} else {
+			fmt.Fprintf(buf, `    %s %s |%s| %s`+"\n", ids[e.Source], arrow, escapeMermaid(e.Label), ids[e.Target])
+		}
 	}
 	buf.WriteString("\n")
 }
@@ -0,0 +1,180 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// plantumlKeywords is the words which cannot be used as the PlantUML identifiers.
+var plantumlKeywords = []string{"as", "bottom", "caption", "direction", "end",
+	"footer", "header", "hide", "left", "legend", "note", "of", "right",
+	"scale", "show", "skinparam", "state", "title", "top"}
+
+// isPlantUMLID reports whether the name can be used as the PlantUML identifier.
+func isPlantUMLID(name string) bool { return isSafeID(name, plantumlKeywords) }
+
+// escapePlantUML escapes s to be used as the PlantUML text,
+// such as the quoted name and the label.
+func escapePlantUML(s string) string {
+	if !strings.ContainsAny(s, "\\\"\r\n") {
+		return s
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(s) + 16)
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString("<U+005C>")
+		case '"':
+			b.WriteString("<U+0022>")
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// plantumlColor returns the PlantUML color, such as "#aaaaaa" or "#red".
+func plantumlColor(color string) string {
+	if strings.HasPrefix(color, "#") {
+		return color
+	}
+	return "#" + color
+}
+
+// VisualizePlantUML outputs a visualization of a FSM in PlantUML
+// state diagram format with the options.
+//
+// The metadata of the states are output as the notes, and the classes
+// of the states are output as the stereotypes, but ClassStyles is ignored.
+// Only the directions "LR" and "TB" are supported.
+//
+// Notice: the state machine is non-hierarchical, so there are no composite
+// states in the output.
+//
+// See https://plantuml.com/state-diagram
+func (f *FSM) VisualizePlantUML(opts VisualizeOptions) string {
+	var buf bytes.Buffer
+	buf.Grow(256)
+
+	g := f.visualGraph(opts)
+	initial := f.Initial()
+	if initial == "" {
+		initial = f.Current()
+	}
+	if !opts.visible(initial) {
+		initial = ""
+	}
+
+	terminations := g.terminations()
+	states := appendStates(append([]State(nil), g.states...), terminations...)
+	states = appendStates(states, initial)
+	sortStates(states)
+	ids := assignIDs(states, isPlantUMLID)
+
+	buf.WriteString("@startuml\n")
+	if opts.Name != "" {
+		fmt.Fprintf(&buf, "title %s\n", escapePlantUML(opts.Name))
+	}
+	switch opts.Direction {
+	case "LR":
+		buf.WriteString("left to right direction\n")
+	case "TB":
+		buf.WriteString("top to bottom direction\n")
+	}
+
+	for _, state := range states {
+		writePlantUMLState(&buf, g, state, ids[state])
+	}
+	if initial != "" {
+		fmt.Fprintf(&buf, "[*] --> %s\n", ids[initial])
+	}
+	for _, e := range g.edges {
+		arrow := "-->"
+		if h, ok := g.heat(e); ok && h.Unused {
+			arrow = "-[" + h.Color + ",dashed]->"
+		} else if ok {
+			arrow = fmt.Sprintf("-[%s,thickness=%d]->", h.Color, int(h.Width+0.5))
+		}
+
+		switch {
+		case e.Internal:
+			fmt.Fprintf(&buf, "%s : %s\n", ids[e.Source], escapePlantUML(e.Label))
+		case e.Label == "":
+			fmt.Fprintf(&buf, "%s %s %s\n", ids[e.Source], arrow, ids[e.Target])
+		default:
+			fmt.Fprintf(&buf, "%s %s %s : %s\n", ids[e.Source], arrow, ids[e.Target], escapePlantUML(e.Label))
+		}
+	}
+	for _, state := range terminations {
+		fmt.Fprintf(&buf, "%s --> [*]\n", ids[state])
+	}
+	for _, state := range states {
+		writePlantUMLNote(&buf, f.StateMetadata(state), ids[state])
+	}
+	buf.WriteString("@enduml\n")
+
+	return buf.String()
+}
+
+// writePlantUMLState declares the state if it has the alias,
+// the stereotype or the color.
+func writePlantUMLState(buf *bytes.Buffer, g visualGraph, state State, id string) {
+	decl := "state " + id
+	if id != string(state) {
+		decl = fmt.Sprintf(`state "%s" as %s`, escapePlantUML(string(state)), id)
+	}
+
+	if g.fsm.IsPseudo(state) {
+		decl += " <<choice>>"
+	} else if class := g.opts.StateClasses[state]; class != "" {
+		decl += " <<" + class + ">>"
+	}
+	if _, color := g.highlight(state); color != "" {
+		decl += " " + plantumlColor(color)
+	}
+
+	if decl != "state "+id {
+		buf.WriteString(decl)
+		buf.WriteString("\n")
+	}
+}
+
+// writePlantUMLNote writes the metadata of the state as the note.
+func writePlantUMLNote(buf *bytes.Buffer, metadata map[string]string, id string) {
+	if len(metadata) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(buf, "note right of %s\n", id)
+	for _, key := range keys {
+		fmt.Fprintf(buf, "  %s = %s\n", escapePlantUML(key), escapePlantUML(metadata[key]))
+	}
+	buf.WriteString("end note\n")
+}
@@ -0,0 +1,248 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// newTrickyFSM returns a state machine whose names break the naive visualizers.
+func newTrickyFSM() *FSM {
+	isOK := func(*FSM, interface{}) bool { return true }
+
+	fsm := New()
+	fsm.SetInitial(`Say "Hi"`)
+	fsm.AddFinals("end", "状态")
+	fsm.AddChoice("is ok?", When("x:y", `has "x"`, isOK), Else("[*]"))
+	fsm.AddTransitions(
+		Source(`Say "Hi"`).WithTarget("Foo Bar").WithEvent(`go "now"`),
+		Source("Foo Bar").WithTarget("a-b").WithEvent("a|b"),
+		Source("a-b").WithTarget("is ok?").WithEvent("x;y"),
+		Source("x:y").WithTarget(`back\slash`).WithEvent("#1"),
+		Source(`back\slash`).WithTarget("s0").WithEvent("<E>"),
+		Source("s0").WithTarget("end").WithEvent("Finish"),
+		Source("[*]").WithTarget("状态").WithEvent("完成"),
+		Source("s0").WithEvent("note: keep").WithKind(Internal),
+	)
+	return fsm
+}
+
+func checkGolden(t *testing.T, name, output string) {
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := ioutil.WriteFile(path, []byte(output), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expect, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(expect) != output {
+		t.Errorf("%s: expect\n%s\nbut got\n%s", name, expect, output)
+	}
+}
+
+func TestVisualizerGolden(t *testing.T) {
+	fsm := newTrickyFSM()
+	checkGolden(t, "tricky.dot", fsm.VisualizeGraphviz())
+	checkGolden(t, "tricky_state.mmd", fsm.VisualizeMermaidStateDiagram())
+	checkGolden(t, "tricky_flow.mmd", fsm.VisualizeMermaidFlowChart("#aaaaaa"))
+	checkGolden(t, "tricky.puml", fsm.VisualizePlantUML(VisualizeOptions{}))
+	checkGolden(t, "tricky.d2", fsm.VisualizeD2(VisualizeOptions{}))
+	checkGolden(t, "tricky.txt", fsm.VisualizeASCII(ASCIIOptions{}))
+}
+
+func TestVisualizerMermaidRoundTrip(t *testing.T) {
+	fsm := newTrickyFSM()
+	def, err := ParseDSL(strings.NewReader(fsm.VisualizeMermaidStateDiagram()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := Definition{
+		Initial: `Say "Hi"`,
+		Finals:  []State{"end", "状态"},
+		Pseudos: []PseudoDefinition{{
+			Name: "is ok?",
+			Kind: Choice,
+			Branches: []BranchDefinition{
+				{Target: "x:y", Guard: `has "x"`},
+				{Target: "[*]"},
+			},
+		}},
+		Transitions: []TransitionDefinition{
+			{Event: "完成", Source: "[*]", Target: "状态"},
+			{Event: "a|b", Source: "Foo Bar", Target: "a-b"},
+			{Event: `go "now"`, Source: `Say "Hi"`, Target: "Foo Bar"},
+			{Event: "x;y", Source: "a-b", Target: "is ok?"},
+			{Event: "<E>", Source: `back\slash`, Target: "s0"},
+			{Event: "Finish", Source: "s0", Target: "end"},
+			{Event: "note: keep", Source: "s0", Kind: Internal},
+			{Event: "#1", Source: "x:y", Target: `back\slash`},
+		},
+	}
+
+	if !reflect.DeepEqual(expect.Initial, def.Initial) ||
+		!reflect.DeepEqual(expect.Finals, def.Finals) ||
+		!reflect.DeepEqual(expect.Pseudos, def.Pseudos) {
+		t.Errorf("expect the definition %+v, but got %+v", expect, def)
+	}
+
+	for _, transition := range expect.Transitions {
+		var found bool
+		for _, t := range def.Transitions {
+			if reflect.DeepEqual(t, transition) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("missing the transition %+v in %+v", transition, def.Transitions)
+		}
+	}
+}
+
+func TestVisualizerGraphvizKeywordName(t *testing.T) {
+	fsm := New()
+	fsm.SetInitial("Pending")
+	fsm.AddTransitions(Source("Pending").WithTarget("Paid").WithEvent("Pay"))
+
+	checkGolden(t, "keyword_name.dot", fsm.VisualizeGraphvizWith(VisualizeOptions{Name: "Node"}))
+}
+
+func TestVisualizerMermaidTitle(t *testing.T) {
+	fsm := New()
+	fsm.SetInitial("Pending")
+	fsm.AddTransitions(Source("Pending").WithTarget("Paid").WithEvent("Pay"))
+
+	opts := VisualizeOptions{Name: "Order: v2 #1 \"beta\" C:\\orders\nnext"}
+	checkGolden(t, "title_state.mmd", fsm.VisualizeMermaidStateDiagramWith(opts))
+}
+
+func TestVisualizerOptions(t *testing.T) {
+	isOK := func(*FSM, interface{}) bool { return true }
+	pay := func(*FSM, interface{}) bool { return true }
+
+	fsm := New()
+	fsm.SetInitial("Pending")
+	fsm.AddFinals("Paid", "Canceled")
+	fsm.AddTransitions(
+		Source("Pending").WithTarget("Paying").WithEvent("Pay").WithGuard("canPay", isOK),
+		Source("Paying").WithTarget("Paid").WithEvent("Done").WithNamedAction("charge", pay),
+		Source("Paying").WithEvent("Retry").WithKind(Reentrant),
+		Source("Pending").WithTarget("Canceled").WithEvent("Cancel").WithAction(pay),
+		Source("Canceled").WithTarget("Archived").WithEvent("Archive"),
+	)
+	fsm.SetCurrent("Paying")
+	fsm.SetStateMetadata("Pending", "owner", "sales")
+	fsm.SetStateMetadata("Pending", "sla", "1d")
+
+	opts := VisualizeOptions{
+		Name:          "order flow",
+		Direction:     "TB",
+		CurrentColor:  "#aaaaaa",
+		InitialColor:  "#00ff00",
+		FinalColor:    "#ff0000",
+		ShowGuards:    true,
+		ShowActions:   true,
+		HideSelfLoops: true,
+		StateClasses:  map[State]string{"Paying": "busy", "Pending": "busy"},
+		ClassStyles:   map[string]string{"busy": "stroke-width:4px"},
+		Exclude:       []State{"Archived"},
+	}
+
+	checkGolden(t, "options.dot", fsm.VisualizeGraphvizWith(opts))
+	checkGolden(t, "options_state.mmd", fsm.VisualizeMermaidStateDiagramWith(opts))
+	checkGolden(t, "options_flow.mmd", fsm.VisualizeMermaidFlowChartWith(opts))
+	checkGolden(t, "options.puml", fsm.VisualizePlantUML(opts))
+	checkGolden(t, "options.d2", fsm.VisualizeD2(opts))
+
+	var svg bytes.Buffer
+	if err := fsm.RenderSVG(&svg, opts); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "options.svg", svg.String())
+	checkGolden(t, "options.txt", fsm.VisualizeASCII(ASCIIOptions{VisualizeOptions: opts, Unicode: true, Color: true}))
+	checkGolden(t, "options_table.txt", fsm.VisualizeASCII(ASCIIOptions{VisualizeOptions: opts, Table: true}))
+
+	def, err := ParseDSL(strings.NewReader(fsm.VisualizeMermaidStateDiagramWith(opts)))
+	if err != nil {
+		t.Fatal(err)
+	} else if def.Initial != "Pending" || !reflect.DeepEqual(def.Finals, []State{"Paid", "Canceled"}) {
+		t.Errorf("unexpected the initial '%s' and the finals %v", def.Initial, def.Finals)
+	}
+
+	opts = VisualizeOptions{Include: []State{"Pending", "Paying"}}
+	expect := "graph LR\n    id0[Paying]\n    id1[Pending]\n\n" +
+		"    id0 --> |Retry| id0\n    id1 --> |Pay| id0\n\n"
+	if output := fsm.VisualizeMermaidFlowChartWith(opts); output != expect {
+		t.Errorf("expect\n%s\nbut got\n%s", expect, output)
+	}
+}
+
+func TestVisualizerHeatmap(t *testing.T) {
+	isPassed := func(fsm *FSM, data interface{}) bool { return data == "pass" }
+
+	fsm := New()
+	fsm.SetInitial("Pending")
+	fsm.AddTransitions(
+		Source("Pending").WithTarget("Check").WithEvent("Review"),
+		Source("Pending").WithTarget("Canceled").WithEvent("Cancel"),
+		Source("Pending").WithEvent("Remind").WithKind(Internal),
+		Source("Rejected").WithTarget("Pending").WithEvent("Appeal"),
+	)
+	fsm.AddChoice("Check", When("Approved", "isPassed", isPassed), Else("Rejected"))
+
+	metrics := NewMetrics()
+	fsm.OnTrace(metrics.Record)
+	for _, data := range []string{"fail", "fail", "fail", "pass"} {
+		_ = fsm.SendEvent("Remind", nil)
+		_ = fsm.SendEvent("Review", data)
+		_ = fsm.SendEvent("Appeal", nil)
+	}
+
+	if count := metrics.Count("Pending", "Review"); count != 4 {
+		t.Errorf("expect the count 4 of Review, but got %d", count)
+	}
+
+	opts := VisualizeOptions{Counts: metrics.Counts()}
+	checkGolden(t, "heat.dot", fsm.VisualizeGraphvizWith(opts))
+	checkGolden(t, "heat_flow.mmd", fsm.VisualizeMermaidFlowChartWith(opts))
+	checkGolden(t, "heat.puml", fsm.VisualizePlantUML(opts))
+	checkGolden(t, "heat.d2", fsm.VisualizeD2(opts))
+	checkGolden(t, "heat_table.txt", fsm.VisualizeASCII(ASCIIOptions{VisualizeOptions: opts, Table: true}))
+
+	var svg bytes.Buffer
+	if err := fsm.RenderSVG(&svg, opts); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(svg.String(), "stroke-dasharray") {
+		t.Errorf("expect the unused transition is dashed:\n%s", svg.String())
+	}
+
+	metrics.Reset()
+	if counts := metrics.Counts(); len(counts) != 0 {
+		t.Errorf("expect no counts, but got %v", counts)
+	}
+}
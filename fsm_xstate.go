@@ -0,0 +1,541 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// FormatXState is the XState machine config JSON definition format.
+//
+// See https://stately.ai/docs/machines
+const FormatXState = "xstate"
+
+// xstatePseudoKey is the meta key of the state node with the "always"
+// transitions, whose value is the kind of the pseudo state.
+const xstatePseudoKey = "fsm.pseudo"
+
+var (
+	xstateIgnoredRootKeys = []string{"description",
+		"predictableActionArguments", "preserveActionOrder"}
+	xstateRootKeys  = []string{"id", "version", "initial", "states", "meta"}
+	xstateStateKeys = []string{"type", "on", "always", "entry", "exit", "meta", "description"}
+	xstateTransKeys = []string{"target", "guard", "cond", "actions", "internal", "reenter", "meta", "description"}
+)
+
+// ParseXState parses the XState machine config JSON into the definition.
+//
+// It only supports the flat machine, that's, the atomic and final state
+// nodes of the root "states", and the transitions in "on" and "always".
+// The guard ("guard" or "cond"), the actions ("actions"), and the hooks
+// ("entry" and "exit") are referenced by the name, and at most one action
+// or hook is supported. A state node only with the "always" transitions
+// is parsed as the choice pseudo state, or the junction pseudo state if
+// its meta "fsm.pseudo" is "junction".
+//
+// Any other construct, such as the nested or parallel states, "invoke",
+// "after", or the multiple guarded transitions for one event, returns
+// an error.
+func ParseXState(r io.Reader) (def Definition, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	keys, root, err := decodeJSONObject(data)
+	if err != nil {
+		return def, fmt.Errorf("xstate: %v", err)
+	}
+	for _, key := range keys {
+		if !hasString(xstateRootKeys, key) && !hasString(xstateIgnoredRootKeys, key) {
+			return def, fmt.Errorf("xstate: unsupported machine key '%s'", key)
+		}
+	}
+
+	if err = decodeJSONValue(root, "id", &def.Name); err != nil {
+		return
+	}
+	if err = decodeJSONValue(root, "initial", &def.Initial); err != nil {
+		return
+	}
+
+	var version string
+	if err = decodeJSONValue(root, "version", &version); err != nil {
+		return
+	} else if version != "" {
+		if def.Version, err = strconv.Atoi(version); err != nil {
+			return def, fmt.Errorf("xstate: unsupported version '%s', which must be an integer", version)
+		}
+	}
+	if def.Metadata, err = decodeXStateMeta(root["meta"]); err != nil {
+		return def, fmt.Errorf("xstate: %v of the machine", err)
+	}
+
+	states, nodes, err := decodeJSONObject(root["states"])
+	if err != nil {
+		return def, fmt.Errorf("xstate: %v in 'states'", err)
+	}
+
+	for _, state := range states {
+		if err = parseXStateNode(&def, State(state), nodes[state]); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func parseXStateNode(def *Definition, state State, data []byte) (err error) {
+	keys, node, err := decodeJSONObject(data)
+	if err != nil {
+		return fmt.Errorf("xstate: %v of the state '%s'", err, state)
+	}
+	for _, key := range keys {
+		if !hasString(xstateStateKeys, key) {
+			return fmt.Errorf("xstate: unsupported key '%s' of the state '%s'", key, state)
+		}
+	}
+
+	var kind string
+	if err = decodeJSONValue(node, "type", &kind); err != nil {
+		return fmt.Errorf("xstate: %v of the state '%s'", err, state)
+	}
+
+	s := StateDefinition{Name: state}
+	if s.Metadata, err = decodeXStateMeta(node["meta"]); err != nil {
+		return fmt.Errorf("xstate: %v of the state '%s'", err, state)
+	}
+	if s.OnEnter, err = decodeXStateName(node["entry"]); err != nil {
+		return fmt.Errorf("xstate: %v in 'entry' of the state '%s'", err, state)
+	}
+	if s.OnExit, err = decodeXStateName(node["exit"]); err != nil {
+		return fmt.Errorf("xstate: %v in 'exit' of the state '%s'", err, state)
+	}
+
+	switch kind {
+	case "", "atomic":
+	case "final":
+		def.Finals = append(def.Finals, state)
+	default:
+		return fmt.Errorf("xstate: unsupported type '%s' of the state '%s'", kind, state)
+	}
+
+	if _, ok := node["always"]; ok {
+		if _, ok := node["on"]; ok {
+			return fmt.Errorf("xstate: unsupported state '%s' mixing 'always' and 'on'", state)
+		}
+		return parseXStatePseudo(def, s, node["always"])
+	}
+
+	if s.OnEnter != "" || s.OnExit != "" || len(s.Metadata) > 0 {
+		def.States = append(def.States, s)
+	}
+
+	events, on, err := decodeJSONObject(node["on"])
+	if err != nil {
+		return fmt.Errorf("xstate: %v in 'on' of the state '%s'", err, state)
+	}
+
+	for _, event := range events {
+		t, err := parseXStateTransition(def, on[event])
+		if err != nil {
+			return fmt.Errorf("xstate: %v of the event '%s' in the state '%s'", err, event, state)
+		}
+
+		t.Event, t.Source = Event(event), state
+		switch {
+		case t.Target == "":
+			if t.Kind == Reentrant {
+				return fmt.Errorf("xstate: the reentrant transition of the event '%s' in the state '%s' has no target", event, state)
+			}
+			t.Kind = Internal
+		case t.Kind == Reentrant:
+			if t.Target != state {
+				return fmt.Errorf("xstate: the reentrant transition of the event '%s' in the state '%s' has another target", event, state)
+			}
+			t.Target = ""
+		}
+
+		def.Transitions = append(def.Transitions, t)
+	}
+
+	return
+}
+
+func parseXStatePseudo(def *Definition, s StateDefinition, data []byte) (err error) {
+	if s.OnEnter != "" || s.OnExit != "" {
+		return fmt.Errorf("xstate: unsupported hooks of the pseudo state '%s'", s.Name)
+	}
+
+	p := PseudoDefinition{Name: s.Name, Kind: Choice}
+	if kind, ok := s.Metadata[xstatePseudoKey]; ok {
+		if err = p.Kind.UnmarshalText([]byte(kind)); err != nil {
+			return fmt.Errorf("xstate: %v of the state '%s'", err, s.Name)
+		}
+		if delete(s.Metadata, xstatePseudoKey); len(s.Metadata) > 0 {
+			return fmt.Errorf("xstate: unsupported metadata of the pseudo state '%s'", s.Name)
+		}
+	}
+
+	var branches []json.RawMessage
+	if json.Unmarshal(data, &branches) != nil {
+		branches = []json.RawMessage{data}
+	}
+
+	for _, branch := range branches {
+		t, err := parseXStateTransition(def, branch)
+		if err != nil {
+			return fmt.Errorf("xstate: %v in 'always' of the state '%s'", err, s.Name)
+		}
+		if t.Target == "" || t.Action != "" || t.Kind != External || len(t.Metadata) > 0 {
+			return fmt.Errorf("xstate: unsupported 'always' transition of the state '%s'", s.Name)
+		}
+		p.Branches = append(p.Branches, BranchDefinition{Target: t.Target, Guard: t.Guard})
+	}
+
+	def.Pseudos = append(def.Pseudos, p)
+	return
+}
+
+func parseXStateTransition(def *Definition, data []byte) (t TransitionDefinition, err error) {
+	var target string
+	if json.Unmarshal(data, &target) == nil {
+		t.Target, err = parseXStateTarget(def, target)
+		return
+	}
+
+	var transitions []json.RawMessage
+	if json.Unmarshal(data, &transitions) == nil {
+		if len(transitions) != 1 {
+			err = fmt.Errorf("unsupported multiple transitions")
+			return
+		}
+		data = transitions[0]
+	}
+
+	keys, obj, err := decodeJSONObject(data)
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		if !hasString(xstateTransKeys, key) {
+			err = fmt.Errorf("unsupported transition key '%s'", key)
+			return
+		}
+	}
+
+	if err = decodeJSONValue(obj, "target", &target); err != nil {
+		return
+	} else if t.Target, err = parseXStateTarget(def, target); err != nil {
+		return
+	}
+
+	if err = decodeJSONValue(obj, "guard", &t.Guard); err != nil {
+		return
+	} else if t.Guard == "" {
+		if err = decodeJSONValue(obj, "cond", &t.Guard); err != nil {
+			return
+		}
+	}
+
+	if t.Action, err = decodeXStateName(obj["actions"]); err != nil {
+		return
+	} else if t.Metadata, err = decodeXStateMeta(obj["meta"]); err != nil {
+		return
+	}
+
+	var internal, reenter *bool
+	if err = decodeJSONValue(obj, "internal", &internal); err != nil {
+		return
+	} else if err = decodeJSONValue(obj, "reenter", &reenter); err != nil {
+		return
+	}
+
+	if (reenter != nil && *reenter) || (internal != nil && !*internal) {
+		t.Kind = Reentrant
+	}
+
+	return
+}
+
+func parseXStateTarget(def *Definition, target string) (State, error) {
+	switch {
+	case target == "":
+		return "", nil
+	case strings.HasPrefix(target, "."):
+		return "", fmt.Errorf("unsupported child target '%s'", target)
+	case strings.HasPrefix(target, "#"):
+		// Support the target "#machineId.State".
+		if prefix := "#" + def.Name + "."; def.Name != "" && strings.HasPrefix(target, prefix) {
+			target = target[len(prefix):]
+		} else {
+			return "", fmt.Errorf("unsupported target '%s'", target)
+		}
+	}
+
+	if strings.Contains(target, ".") {
+		return "", fmt.Errorf("unsupported nested target '%s'", target)
+	}
+	return State(target), nil
+}
+
+func decodeXStateName(data []byte) (name string, err error) {
+	if len(data) == 0 {
+		return
+	}
+
+	if json.Unmarshal(data, &name) == nil {
+		return
+	}
+
+	var names []string
+	if err = json.Unmarshal(data, &names); err != nil {
+		return "", fmt.Errorf("invalid names: %v", err)
+	}
+
+	switch len(names) {
+	case 0:
+	case 1:
+		name = names[0]
+	default:
+		err = fmt.Errorf("unsupported multiple names %v", names)
+	}
+	return
+}
+
+func decodeXStateMeta(data []byte) (meta map[string]string, err error) {
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &meta); err != nil {
+			err = fmt.Errorf("unsupported meta: %v", err)
+		} else if len(meta) == 0 {
+			meta = nil
+		}
+	}
+	return
+}
+
+// xstateTarget returns the target of the state used by MarshalXState,
+// which is qualified by the machine id if the state starts with "#".
+func xstateTarget(def Definition, state State) (string, error) {
+	switch {
+	case strings.Contains(string(state), "."):
+		return "", fmt.Errorf("xstate: unsupported target state '%s' containing '.'", state)
+	case !strings.HasPrefix(string(state), "#"):
+		return string(state), nil
+	case def.Name == "":
+		return "", fmt.Errorf("xstate: the target state '%s' starting with '#' requires the machine name", state)
+	default:
+		return "#" + def.Name + "." + string(state), nil
+	}
+}
+
+// MarshalXState marshals the definition to the XState machine config JSON.
+//
+// The target state starting with "#" is qualified as "#<name>.<state>",
+// so the name of the definition must not be empty. It returns an error
+// if the target state contains ".", which XState regards as the nested state.
+func MarshalXState(def Definition) ([]byte, error) {
+	hooks := make(map[State]StateDefinition, len(def.States))
+	for _, s := range def.States {
+		hooks[s.Name] = s
+	}
+
+	transitions := make(map[State][]TransitionDefinition, len(def.Transitions))
+	for _, t := range def.Transitions {
+		transitions[t.Source] = append(transitions[t.Source], t)
+	}
+
+	var states jsonObject
+	for _, state := range getDefinitionStates(def) {
+		var node jsonObject
+		if hasState(def.Finals, state) {
+			if len(transitions[state]) > 0 {
+				return nil, fmt.Errorf("xstate: the final state '%s' has the transitions", state)
+			}
+			node = node.Add("type", "final")
+		}
+
+		s := hooks[state]
+		node = node.AddNotEmpty("entry", s.OnEnter)
+		node = node.AddNotEmpty("exit", s.OnExit)
+		if len(s.Metadata) > 0 {
+			node = node.Add("meta", s.Metadata)
+		}
+
+		var on jsonObject
+		for _, t := range transitions[state] {
+			var trans jsonObject
+			switch t.Kind {
+			case Internal:
+			case Reentrant:
+				target, err := xstateTarget(def, t.Source)
+				if err != nil {
+					return nil, err
+				}
+				trans = trans.Add("target", target).Add("reenter", true)
+			default:
+				target, err := xstateTarget(def, t.Target)
+				if err != nil {
+					return nil, err
+				}
+				trans = trans.Add("target", target)
+			}
+			trans = trans.AddNotEmpty("guard", t.Guard)
+			trans = trans.AddNotEmpty("actions", t.Action)
+			if len(t.Metadata) > 0 {
+				trans = trans.Add("meta", t.Metadata)
+			}
+			on = on.Add(string(t.Event), trans)
+		}
+		if len(on) > 0 {
+			node = node.Add("on", on)
+		}
+
+		states = states.Add(string(state), node)
+	}
+
+	for _, p := range def.Pseudos {
+		var node jsonObject
+		if p.Kind == Junction {
+			node = node.Add("meta", map[string]string{xstatePseudoKey: p.Kind.String()})
+		}
+
+		always := make([]jsonObject, len(p.Branches))
+		for i, b := range p.Branches {
+			target, err := xstateTarget(def, b.Target)
+			if err != nil {
+				return nil, err
+			}
+			always[i] = always[i].Add("target", target).AddNotEmpty("guard", b.Guard)
+		}
+		states = states.Add(string(p.Name), node.Add("always", always))
+	}
+
+	var root jsonObject
+	root = root.AddNotEmpty("id", def.Name)
+	if def.Version != 0 {
+		root = root.Add("version", strconv.Itoa(def.Version))
+	}
+	root = root.AddNotEmpty("initial", string(def.Initial))
+	if len(def.Metadata) > 0 {
+		root = root.Add("meta", def.Metadata)
+	}
+	root = root.Add("states", states)
+
+	return json.MarshalIndent(root, "", "  ")
+}
+
+type jsonField struct {
+	Key   string
+	Value interface{}
+}
+
+// jsonObject is a JSON object keeping the order of the keys.
+type jsonObject []jsonField
+
+func (o jsonObject) Add(key string, value interface{}) jsonObject {
+	return append(o, jsonField{Key: key, Value: value})
+}
+
+func (o jsonObject) AddNotEmpty(key, value string) jsonObject {
+	if value == "" {
+		return o
+	}
+	return o.Add(key, value)
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(field.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// decodeJSONObject decodes the JSON object, and returns its keys in order.
+func decodeJSONObject(data []byte) (keys []string, obj map[string]json.RawMessage, err error) {
+	if len(data) == 0 {
+		return
+	}
+
+	if err = json.Unmarshal(data, &obj); err != nil {
+		return
+	}
+
+	keys = make([]string, 0, len(obj))
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err = dec.Token(); err != nil { // '{'
+		return
+	}
+
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+
+		if key := token.(string); !hasString(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	return
+}
+
+func decodeJSONValue(obj map[string]json.RawMessage, key string, value interface{}) error {
+	if data, ok := obj[key]; ok {
+		if err := json.Unmarshal(data, value); err != nil {
+			return fmt.Errorf("invalid '%s': %v", key, err)
+		}
+	}
+	return nil
+}
+
+func hasString(ss []string, s string) bool {
+	for _, _s := range ss {
+		if s == _s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testXState = `{
+  "id": "order",
+  "version": "2",
+  "initial": "Pending",
+  "meta": {"owner": "product"},
+  "states": {
+    "Pending": {
+      "entry": ["logState"],
+      "meta": {"note": "waiting for the review"},
+      "on": {
+        "Review": {"target": "Check", "actions": ["review"]},
+        "Remind": {"cond": "canRemind"},
+        "Restart": {"target": "Pending", "reenter": true},
+        "Cancel": "#order.Rejected"
+      }
+    },
+    "Check": {
+      "always": [
+        {"target": "Approved", "guard": "isPassed"},
+        {"target": "Rejected"}
+      ]
+    },
+    "Approved": {"type": "final"},
+    "Rejected": {"type": "final"}
+  }
+}`
+
+func TestXStateRoundTrip(t *testing.T) {
+	def, err := LoadDefinition(strings.NewReader(testXState), FormatXState)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := Definition{
+		Name:     "order",
+		Version:  2,
+		Initial:  "Pending",
+		Finals:   []State{"Approved", "Rejected"},
+		Metadata: map[string]string{"owner": "product"},
+		States: []StateDefinition{{
+			Name:     "Pending",
+			OnEnter:  "logState",
+			Metadata: map[string]string{"note": "waiting for the review"},
+		}},
+		Pseudos: []PseudoDefinition{{
+			Name: "Check",
+			Kind: Choice,
+			Branches: []BranchDefinition{
+				{Target: "Approved", Guard: "isPassed"},
+				{Target: "Rejected"},
+			},
+		}},
+		Transitions: []TransitionDefinition{
+			{Event: "Review", Source: "Pending", Target: "Check", Action: "review"},
+			{Event: "Remind", Source: "Pending", Kind: Internal, Guard: "canRemind"},
+			{Event: "Restart", Source: "Pending", Kind: Reentrant},
+			{Event: "Cancel", Source: "Pending", Target: "Rejected"},
+		},
+	}
+	if !reflect.DeepEqual(expect, def) {
+		t.Fatalf("expect the definition %+v, but got %+v", expect, def)
+	}
+
+	fsm, err := def.Build(testRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := MarshalDefinition(fsm, FormatXState)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newdef, err := ParseXState(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(def, newdef) {
+		t.Errorf("expect the definition %+v, but got %+v", def, newdef)
+	}
+
+	// The exported JSON is stable.
+	if _data, err := MarshalXState(newdef); err != nil {
+		t.Fatal(err)
+	} else if string(_data) != string(data) {
+		t.Errorf("expect the xstate config %s, but got %s", data, _data)
+	}
+}
+
+func TestXStateMarshalTarget(t *testing.T) {
+	def := Definition{
+		Name:    "order",
+		Initial: "#new",
+		Pseudos: []PseudoDefinition{{
+			Name:     "#check",
+			Kind:     Choice,
+			Branches: []BranchDefinition{{Target: "#new"}},
+		}},
+		Transitions: []TransitionDefinition{
+			{Event: "Check", Source: "#new", Target: "#check"},
+			{Event: "Restart", Source: "#new", Kind: Reentrant},
+		},
+	}
+
+	data, err := MarshalXState(def)
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(data), `"#order.#check"`) {
+		t.Errorf("expect the qualified target, but got %s", data)
+	}
+
+	newdef, err := ParseXState(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(def, newdef) {
+		t.Errorf("expect the definition %+v, but got %+v", def, newdef)
+	}
+
+	def.Name = ""
+	if _, err := MarshalXState(def); err == nil {
+		t.Errorf("expect an error for the target starting with '#' without the name")
+	}
+
+	def = Definition{Name: "order", Initial: "a", Transitions: []TransitionDefinition{
+		{Event: "Next", Source: "a", Target: "b.c"},
+	}}
+	if _, err := MarshalXState(def); err == nil {
+		t.Errorf("expect an error for the target containing '.'")
+	}
+}
+
+func TestXStateUnsupported(t *testing.T) {
+	configs := map[string]string{
+		"context":  `{"context": {}, "states": {}}`,
+		"nested":   `{"states": {"a": {"initial": "b", "states": {"b": {}}}}}`,
+		"parallel": `{"states": {"a": {"type": "parallel"}}}`,
+		"invoke":   `{"states": {"a": {"invoke": {"src": "x"}}}}`,
+		"multiple": `{"states": {"a": {"on": {"e": [{"target": "b", "guard": "g"}, {"target": "c"}]}}}}`,
+		"actions":  `{"states": {"a": {"on": {"e": {"target": "b", "actions": ["x", "y"]}}}}}`,
+		"child":    `{"states": {"a": {"on": {"e": ".b"}}}}`,
+		"version":  `{"version": "1.0.2", "states": {}}`,
+	}
+
+	for name, config := range configs {
+		if _, err := ParseXState(strings.NewReader(config)); err == nil {
+			t.Errorf("%s: expect an error, but got nil", name)
+		} else if !strings.Contains(err.Error(), "unsupported") {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+}
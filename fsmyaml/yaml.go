@@ -0,0 +1,42 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fsmyaml registers the YAML format of the state machine definition,
+// which is used by importing it for the side effect, for example,
+//
+//	import _ "github.com/xgfone/go-fsm/fsmyaml"
+//
+// Then, fsm.LoadDefinition and fsm.MarshalDefinition support fsm.FormatYAML
+// and its alias "yml".
+package fsmyaml
+
+import (
+	"github.com/xgfone/go-fsm"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	fsm.RegisterFormat(fsm.FormatYAML, Unmarshal, Marshal)
+	fsm.RegisterFormat("yml", Unmarshal, Marshal)
+}
+
+// Unmarshal decodes the definition of the state machine from the YAML data.
+func Unmarshal(data []byte, def *fsm.Definition) error {
+	return yaml.Unmarshal(data, def)
+}
+
+// Marshal encodes the definition of the state machine to the YAML data.
+func Marshal(def fsm.Definition) ([]byte, error) {
+	return yaml.Marshal(def)
+}
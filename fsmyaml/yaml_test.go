@@ -0,0 +1,92 @@
+// Copyright 2022 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsmyaml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xgfone/go-fsm"
+)
+
+const testDefinition = `
+name: order
+initial: Pending
+finals: [Approved, Rejected]
+metadata:
+  owner: product
+states:
+  - name: Pending
+    onEnter: logState
+    metadata:
+      note: waiting for the review
+pseudos:
+  - name: Check
+    kind: choice
+    branches:
+      - target: Approved
+        guard: isPassed
+      - target: Rejected
+transitions:
+  - event: Review
+    source: Pending
+    target: Check
+    action: review
+  - event: Remind
+    source: Pending
+    kind: internal
+    guard: canRemind
+`
+
+func TestYAMLRoundTrip(t *testing.T) {
+	def, err := fsm.LoadDefinition(strings.NewReader(testDefinition), fsm.FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := fsm.NewRegistry().
+		RegisterAction("review", func(*fsm.FSM, interface{}) bool { return true }).
+		RegisterGuard("isPassed", func(f *fsm.FSM, data interface{}) bool { return data.(int) >= 60 }).
+		RegisterGuard("canRemind", func(*fsm.FSM, interface{}) bool { return true }).
+		RegisterHook("logState", func(fsm.State) {})
+
+	machine, err := def.Build(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := machine.SendEvent("Review", 80); err != nil {
+		t.Fatal(err)
+	} else if current := machine.Current(); current != "Approved" {
+		t.Errorf("expect the state '%s', but got '%s'", "Approved", current)
+	}
+
+	for _, format := range []string{fsm.FormatYAML, "yml"} {
+		data, err := fsm.MarshalDefinition(machine, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		newdef, err := fsm.LoadDefinition(strings.NewReader(string(data)), format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(def, newdef) {
+			t.Errorf("%s: expect the definition %+v, but got %+v", format, def, newdef)
+		}
+	}
+}
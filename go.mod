@@ -1,3 +1,5 @@
 module github.com/xgfone/go-fsm
 
 go 1.11
+
+require gopkg.in/yaml.v3 v3.0.1